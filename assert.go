@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AssertionError is returned when an assert_* command does not hold.
+// The test runner reports it as a failure rather than an error.
+type AssertionError struct {
+	Assertion string
+	Message   string
+}
+
+func (e *AssertionError) Error() string {
+	return e.Message
+}
+
+// Every assertion passes its input through unchanged, so assertions can
+// sit in the middle of a pipeline:
+//
+//	search "golang" -> assert_contains "Go" -> summarize -> assert_rubric "mentions concurrency"
+
+// assertContains checks that the input contains text
+func (r *Runtime) assertContains(text, input string) (string, error) {
+	if !strings.Contains(input, text) {
+		return "", &AssertionError{"assert_contains", fmt.Sprintf("output does not contain %q\noutput: %s", text, preview(input))}
+	}
+	fmt.Printf("✅ assert_contains %q\n", text)
+	return input, nil
+}
+
+// assertRegex checks that the input matches a regular expression
+func (r *Runtime) assertRegex(pattern, input string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if !re.MatchString(input) {
+		return "", &AssertionError{"assert_regex", fmt.Sprintf("output does not match /%s/\noutput: %s", pattern, preview(input))}
+	}
+	fmt.Printf("✅ assert_regex /%s/\n", pattern)
+	return input, nil
+}
+
+// assertJSON checks a value in JSON output. The argument is a path,
+// optionally followed by "== value", e.g. "items[0].name == Go" or
+// "count == 3". Values are parsed as JSON when possible and compared as
+// strings otherwise. Without a value it only checks that the path exists.
+func (r *Runtime) assertJSON(expr, input string) (string, error) {
+	path, want, hasWant := strings.Cut(expr, "==")
+	path = strings.TrimSpace(path)
+
+	var doc any
+	if err := json.Unmarshal([]byte(stripCodeFence(input)), &doc); err != nil {
+		return "", &AssertionError{"assert_json", fmt.Sprintf("output is not valid JSON: %v\noutput: %s", err, preview(input))}
+	}
+
+	got, err := lookupJSONPath(doc, path)
+	if err != nil {
+		return "", &AssertionError{"assert_json", err.Error()}
+	}
+
+	if hasWant {
+		want = strings.TrimSpace(want)
+		var wantValue any
+		if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+			// Bare words compare as strings
+			wantValue = want
+		}
+		if !reflect.DeepEqual(got, wantValue) {
+			gotJSON, _ := json.Marshal(got)
+			return "", &AssertionError{"assert_json", fmt.Sprintf("%s is %s, want %s", path, gotJSON, want)}
+		}
+	}
+
+	fmt.Printf("✅ assert_json %s\n", expr)
+	return input, nil
+}
+
+// assertFile checks that the input names an existing, non-empty file and,
+// if a MIME type is given, that the file has that type. A type without a
+// subtype (e.g. "image") matches any subtype.
+func (r *Runtime) assertFile(mimeType, input string) (string, error) {
+	path := strings.TrimPrefix(strings.TrimSpace(input), "IMAGEFILE:")
+	if err := r.checkPath(path, "read"); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", &AssertionError{"assert_file", fmt.Sprintf("file %q does not exist", preview(path))}
+	}
+	if info.IsDir() || info.Size() == 0 {
+		return "", &AssertionError{"assert_file", fmt.Sprintf("%s is empty or not a regular file", path)}
+	}
+
+	if mimeType != "" {
+		detected, err := detectMimeType(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !mimeMatches(mimeType, detected) && !mimeMatches(mimeType, getMimeType(path)) {
+			return "", &AssertionError{"assert_file", fmt.Sprintf("%s has type %s, want %s", path, detected, mimeType)}
+		}
+	}
+
+	fmt.Printf("✅ assert_file %s %s\n", path, mimeType)
+	return input, nil
+}
+
+// assertRubric asks the model to grade the input against a rubric. The
+// fake provider cannot grade, so under it the assertion is skipped and
+// reported as such rather than passed.
+func (r *Runtime) assertRubric(ctx context.Context, rubric, input string) (string, error) {
+	if r.stepProvider(ctx) == "fake" {
+		r.mu.Lock()
+		r.skipped = append(r.skipped, fmt.Sprintf("assert_rubric %q needs a model (record a cassette with -update)", rubric))
+		r.mu.Unlock()
+		fmt.Printf("⏭️  assert_rubric %q skipped: the fake provider cannot grade\n", rubric)
+		return input, nil
+	}
+
+	prompt := fmt.Sprintf(`You are grading the output of an automated pipeline.
+
+RUBRIC:
+%s
+
+OUTPUT TO GRADE:
+%s
+
+Reply with PASS or FAIL on the first line, followed by a one sentence reason.`, rubric, input)
+
+	verdict, err := r.llmCall(ctx, prompt)
+	if err != nil {
+		return "", fmt.Errorf("grading failed: %w", err)
+	}
+
+	verdict = strings.TrimSpace(verdict)
+	first, reason, _ := strings.Cut(verdict, "\n")
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(first)), "PASS") {
+		if reason == "" {
+			reason = first
+		}
+		return "", &AssertionError{"assert_rubric", fmt.Sprintf("%q not met: %s", rubric, strings.TrimSpace(reason))}
+	}
+
+	fmt.Printf("✅ assert_rubric %q\n", rubric)
+	return input, nil
+}
+
+// lookupJSONPath resolves a dotted path with [n] indexes, such as
+// "items[0].name" (a leading "$" or "." is optional), in a decoded document
+func lookupJSONPath(doc any, path string) (any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, nil
+	}
+
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		name := segment
+		var indexes []string
+		if i := strings.Index(segment, "["); i != -1 {
+			name = segment[:i]
+			for _, idx := range strings.Split(segment[i+1:], "[") {
+				indexes = append(indexes, strings.TrimSuffix(idx, "]"))
+			}
+		}
+
+		if name != "" {
+			obj, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: %q is not an object", path, name)
+			}
+			if current, ok = obj[name]; !ok {
+				return nil, fmt.Errorf("%s: key %q not found", path, name)
+			}
+		}
+
+		for _, idx := range indexes {
+			n, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid index [%s]", path, idx)
+			}
+			arr, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: [%d] applied to a non-array", path, n)
+			}
+			if n < 0 {
+				n += len(arr)
+			}
+			if n < 0 || n >= len(arr) {
+				return nil, fmt.Errorf("%s: index %d out of range (length %d)", path, n, len(arr))
+			}
+			current = arr[n]
+		}
+	}
+	return current, nil
+}
+
+// stripCodeFence removes a surrounding markdown code fence from model output
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
+
+// detectMimeType sniffs the content type of a file
+func detectMimeType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// mimeMatches reports whether got satisfies want, ignoring parameters
+func mimeMatches(want, got string) bool {
+	got, _, _ = strings.Cut(got, ";")
+	if !strings.Contains(want, "/") {
+		return strings.HasPrefix(got, want+"/")
+	}
+	if want == "audio/wav" && (got == "audio/wave" || got == "audio/x-wav") {
+		return true
+	}
+	return got == want
+}
+
+// preview shortens long output for assertion messages
+func preview(s string) string {
+	const max = 300
+	if len(s) > max {
+		return s[:max] + "..."
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLookupJSONPath(t *testing.T) {
+	var doc any
+	err := json.Unmarshal([]byte(`{
+		"name": "report",
+		"items": [{"name": "a", "tags": ["x", "y"]}, {"name": "b", "tags": []}],
+		"grid": [[1, 2], [3, 4]],
+		"meta": {"count": 2, "empty": null}
+	}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want any
+		err  string
+	}{
+		{"name", "report", ""},
+		{"$.name", "report", ""},
+		{".name", "report", ""},
+		{"$", doc, ""},
+		{"", doc, ""},
+		{"meta.count", 2.0, ""},
+		{"meta.empty", nil, ""},
+		{"items[0].name", "a", ""},
+		{"items[1].name", "b", ""},
+		{"items[-1].name", "b", ""},
+		{"items[0].tags[1]", "y", ""},
+		{"grid[1][0]", 3.0, ""},
+		{"items", doc.(map[string]any)["items"], ""},
+		{"missing", nil, `missing: key "missing" not found`},
+		{"meta.missing", nil, `meta.missing: key "missing" not found`},
+		{"name.first", nil, `name.first: "first" is not an object`},
+		{"items[2]", nil, "items[2]: index 2 out of range (length 2)"},
+		{"items[-3]", nil, "items[-3]: index -1 out of range (length 2)"},
+		{"items[x]", nil, "items[x]: invalid index [x]"},
+		{"name[0]", nil, "name[0]: [0] applied to a non-array"},
+		{"items[1].tags[0]", nil, "items[1].tags[0]: index 0 out of range (length 0)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := lookupJSONPath(doc, tt.path)
+			gotErr := ""
+			if err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.err {
+				t.Fatalf("lookupJSONPath(%q) error = %q, want %q", tt.path, gotErr, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupJSONPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMimeMatches(t *testing.T) {
+	tests := []struct {
+		want, got string
+		match     bool
+	}{
+		{"image/png", "image/png", true},
+		{"image/png", "image/jpeg", false},
+		{"image", "image/png", true},
+		{"image", "imagery/png", false},
+		{"video", "image/png", false},
+		{"text/plain", "text/plain; charset=utf-8", true},
+		{"text", "text/html; charset=utf-8", true},
+		{"text/plain", "text/html; charset=utf-8", false},
+		{"audio/wav", "audio/wave", true},
+		{"audio/wav", "audio/x-wav", true},
+		{"audio/wav", "audio/wav", true},
+		{"audio/wave", "audio/wav", false},
+		{"application/pdf", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		if got := mimeMatches(tt.want, tt.got); got != tt.match {
+			t.Errorf("mimeMatches(%q, %q) = %v, want %v", tt.want, tt.got, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the response cache
+const (
+	defaultCacheDir     = ".agentscript/cache"
+	defaultCacheTTL     = 7 * 24 * time.Hour
+	defaultCacheMaxSize = 500 // MB
+)
+
+// ResponseCache is an on-disk, content-addressed cache of model responses.
+// Entries are keyed by a hash of the provider, model, endpoint and the full
+// request body (which includes the generation parameters), so any change
+// to the prompt or settings results in a fresh call.
+type ResponseCache struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	refresh  bool // skip reads but still store fresh responses
+
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+// cacheEntry is the on-disk representation of a cached response
+type cacheEntry struct {
+	Provider  string          `json:"provider"`
+	Model     string          `json:"model"`
+	Endpoint  string          `json:"endpoint"`
+	CreatedAt time.Time       `json:"created_at"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// CacheStats summarizes the contents of the cache directory
+type CacheStats struct {
+	Dir     string
+	Entries int
+	Expired int
+	Bytes   int64
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// NewResponseCache creates a cache rooted at dir. A ttl of zero means
+// entries never expire; a maxBytes of zero means no size limit.
+func NewResponseCache(dir string, ttl time.Duration, maxBytes int64, refresh bool) (*ResponseCache, error) {
+	if dir == "" {
+		dir = defaultCacheDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &ResponseCache{
+		dir:      dir,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		refresh:  refresh,
+	}, nil
+}
+
+// cacheKey derives the content address for a request
+func cacheKey(provider, model, endpoint string, body []byte) string {
+	h := sha256.New()
+	for _, s := range []string{provider, model, endpoint} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached response body for key if present and not expired
+func (c *ResponseCache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if c.refresh {
+		c.record(false)
+		return nil, false
+	}
+
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.record(false)
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || c.expired(entry.CreatedAt) {
+		os.Remove(path)
+		c.record(false)
+		return nil, false
+	}
+
+	// Touch the entry so size-based eviction drops least recently used first
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	c.record(true)
+	return entry.Response, true
+}
+
+// Put stores a response body under key and enforces the size limit
+func (c *ResponseCache) Put(key, provider, model, endpoint string, response []byte) error {
+	if c == nil {
+		return nil
+	}
+	if !json.Valid(response) {
+		return fmt.Errorf("refusing to cache non-JSON response")
+	}
+
+	entry := cacheEntry{
+		Provider:  provider,
+		Model:     model,
+		Endpoint:  endpoint,
+		CreatedAt: time.Now(),
+		Response:  response,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return c.evict()
+}
+
+// Session returns the hit and miss counts for this process
+func (c *ResponseCache) Session() (hits, misses int) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Stats walks the cache directory and reports its contents
+func (c *ResponseCache) Stats() (CacheStats, error) {
+	stats := CacheStats{Dir: c.dir}
+	err := c.walk(func(path string, info fs.FileInfo) {
+		stats.Entries++
+		stats.Bytes += info.Size()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		var entry cacheEntry
+		if json.Unmarshal(data, &entry) != nil {
+			return
+		}
+		if c.expired(entry.CreatedAt) {
+			stats.Expired++
+		}
+		if stats.Oldest.IsZero() || entry.CreatedAt.Before(stats.Oldest) {
+			stats.Oldest = entry.CreatedAt
+		}
+		if entry.CreatedAt.After(stats.Newest) {
+			stats.Newest = entry.CreatedAt
+		}
+	})
+	return stats, err
+}
+
+// Clear removes every entry from the cache and returns how many were removed
+func (c *ResponseCache) Clear() (int, error) {
+	var paths []string
+	if err := c.walk(func(path string, _ fs.FileInfo) {
+		paths = append(paths, path)
+	}); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// evict removes least recently used entries until the cache fits maxBytes
+func (c *ResponseCache) evict() error {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []file
+	var total int64
+	if err := c.walk(func(path string, info fs.FileInfo) {
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}); err != nil {
+		return err
+	}
+
+	if total <= c.maxBytes {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every cache entry file
+func (c *ResponseCache) walk(fn func(path string, info fs.FileInfo)) error {
+	return filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(path, info)
+		return nil
+	})
+}
+
+func (c *ResponseCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+func (c *ResponseCache) expired(created time.Time) bool {
+	return c.ttl > 0 && time.Since(created) > c.ttl
+}
+
+func (c *ResponseCache) record(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
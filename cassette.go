@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// httpTransport is the RoundTripper behind every outbound HTTP client
+// (Gemini, Imagen, Veo, Claude, SerpAPI, GitHub and the Google APIs).
+// main replaces it with a Cassette in record or replay mode.
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+// newHTTPClient returns an HTTP client that uses the shared transport
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: httpTransport}
+}
+
+// redacted replaces secrets in recorded requests and responses
+const redacted = "REDACTED"
+
+// Query parameters, headers and JSON/form fields that carry secrets
+var (
+	secretParams  = []string{"key", "api_key", "access_token", "client_secret", "refresh_token", "device_code", "code"}
+	secretHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "X-Subscription-Token", "Ocp-Apim-Subscription-Key", "Cookie", "Set-Cookie"}
+	secretFields  = regexp.MustCompile(`("(?:access_token|refresh_token|id_token|client_secret|device_code|api_key)"\s*:\s*)"[^"]*"`)
+)
+
+// Cassette modes
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// Cassette records every outbound HTTP interaction to a JSON file, or
+// serves previously recorded interactions back without touching the
+// network. Secrets are redacted before anything is written to disk.
+type Cassette struct {
+	path     string
+	mode     string
+	upstream http.RoundTripper
+
+	mu    sync.Mutex
+	data  cassetteFile
+	used  []bool
+	saved int   // interactions on disk; 0 means the file must be rewritten
+	size  int64 // length of the file on disk
+}
+
+// cassetteFile is the on-disk format
+type cassetteFile struct {
+	RecordedAt   time.Time      `json:"recorded_at"`
+	Services     []string       `json:"services,omitempty"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request/response pair
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a redacted outbound request
+type RecordedRequest struct {
+	Method   string              `json:"method"`
+	URL      string              `json:"url"`
+	Headers  map[string][]string `json:"headers,omitempty"`
+	Body     string              `json:"body,omitempty"`
+	BodyHash string              `json:"body_hash,omitempty"`
+}
+
+// RecordedResponse is a redacted response
+type RecordedResponse struct {
+	Status   int                 `json:"status"`
+	Headers  map[string][]string `json:"headers,omitempty"`
+	Body     string              `json:"body,omitempty"`
+	Encoding string              `json:"encoding,omitempty"` // "base64" for binary bodies
+}
+
+// NewRecordingCassette creates a cassette that forwards requests to the
+// network and records them to path
+func NewRecordingCassette(path string) *Cassette {
+	return &Cassette{
+		path:     path,
+		mode:     cassetteRecord,
+		upstream: http.DefaultTransport,
+		data:     cassetteFile{RecordedAt: time.Now()},
+	}
+}
+
+// LoadCassette opens a recorded cassette for replay
+func LoadCassette(path string) (*Cassette, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	c := &Cassette{path: path, mode: cassetteReplay}
+	if err := json.Unmarshal(raw, &c.data); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	c.used = make([]bool, len(c.data.Interactions))
+	return c, nil
+}
+
+// Replaying reports whether the cassette serves recorded responses
+func (c *Cassette) Replaying() bool {
+	return c != nil && c.mode == cassetteReplay
+}
+
+// HasService reports whether a service was configured when recording
+func (c *Cassette) HasService(name string) bool {
+	for _, s := range c.data.Services {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NoteService records that a service was configured for this run, so a
+// replay can configure the same clients without real credentials
+func (c *Cassette) NoteService(name string) {
+	if c == nil || c.mode != cassetteRecord {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.data.Services {
+		if s == name {
+			return
+		}
+	}
+	c.data.Services = append(c.data.Services, name)
+	sort.Strings(c.data.Services)
+	c.saved = 0
+}
+
+// RoundTrip implements http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cassette: failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	recorded := recordRequest(req, body)
+
+	if c.mode == cassetteReplay {
+		return c.replay(req, recorded)
+	}
+	return c.record(req, recorded)
+}
+
+// record forwards the request and appends the interaction to the cassette
+func (c *Cassette) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := c.upstream.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request:  recorded,
+		Response: recordResponse(resp, respBody),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data.Interactions = append(c.data.Interactions, interaction)
+	if err := c.appendLocked(interaction); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write cassette: %v\n", err)
+	}
+
+	return resp, nil
+}
+
+// replay finds the recorded response for a request. Interactions are
+// consumed in order so that repeated requests (e.g. Veo operation polls)
+// get their successive responses. A request whose body differs from the
+// recording (prompts that embed today's date, for instance) falls back to
+// the next unused interaction with the same method and URL.
+func (c *Cassette) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	match := -1
+	last := -1
+	for pass := 0; pass < 2 && match == -1; pass++ {
+		for i, it := range c.data.Interactions {
+			if it.Request.Method != recorded.Method || it.Request.URL != recorded.URL {
+				continue
+			}
+			if pass == 0 && it.Request.BodyHash != recorded.BodyHash {
+				continue
+			}
+			last = i
+			if !c.used[i] {
+				match = i
+				break
+			}
+		}
+	}
+
+	// Every matching interaction was consumed: repeat the last one
+	if match == -1 {
+		match = last
+	}
+	if match == -1 {
+		return nil, fmt.Errorf("cassette %s: no recorded interaction for %s %s", c.path, recorded.Method, recorded.URL)
+	}
+	c.used[match] = true
+
+	rec := c.data.Interactions[match].Response
+	body := []byte(rec.Body)
+	if rec.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(rec.Body)
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: corrupt response body: %w", c.path, err)
+		}
+		body = decoded
+	}
+
+	header := http.Header{}
+	for k, v := range rec.Headers {
+		header[k] = v
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Save writes the cassette to disk
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveLocked()
+}
+
+func (c *Cassette) saveLocked() error {
+	data, err := json.MarshalIndent(c.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		c.saved = 0
+		return err
+	}
+	c.saved, c.size = len(c.data.Interactions), int64(len(data))
+	return nil
+}
+
+// cassetteEnd closes the interactions array and the file, as written by
+// json.MarshalIndent
+const cassetteEnd = "\n  ]\n}"
+
+// appendLocked adds the latest interaction to the file on disk by
+// overwriting its closing brackets, so recording a long run does not
+// rewrite every earlier interaction each time. The file is valid JSON
+// after every call. It falls back to a full save when the file is not
+// known to be up to date.
+func (c *Cassette) appendLocked(it *Interaction) error {
+	if c.saved == 0 || c.saved != len(c.data.Interactions)-1 {
+		return c.saveLocked()
+	}
+	data, err := json.MarshalIndent(it, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	chunk := append(append([]byte(",\n    "), data...), cassetteEnd...)
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY, 0)
+	if err != nil {
+		return c.saveLocked()
+	}
+	offset := c.size - int64(len(cassetteEnd))
+	if _, err := f.WriteAt(chunk, offset); err != nil {
+		f.Close()
+		c.saved = 0
+		return err
+	}
+	if err := f.Close(); err != nil {
+		c.saved = 0
+		return err
+	}
+	c.saved++
+	c.size = offset + int64(len(chunk))
+	return nil
+}
+
+// recordRequest builds the redacted form of a request used both for
+// storage and for matching during replay
+func recordRequest(req *http.Request, body []byte) RecordedRequest {
+	redactedBody := redactBody(body)
+	sum := sha256.Sum256(redactedBody)
+
+	rec := RecordedRequest{
+		Method:   req.Method,
+		URL:      redactURL(req.URL),
+		Headers:  redactHeaders(req.Header),
+		BodyHash: hex.EncodeToString(sum[:]),
+	}
+	if len(body) > 0 {
+		rec.Body, _ = encodeBody(redactedBody)
+	}
+	return rec
+}
+
+func recordResponse(resp *http.Response, body []byte) RecordedResponse {
+	rec := RecordedResponse{
+		Status:  resp.StatusCode,
+		Headers: redactHeaders(resp.Header),
+	}
+	rec.Body, rec.Encoding = encodeBody(redactBody(body))
+	return rec
+}
+
+// encodeBody stores text bodies as-is and binary bodies as base64
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func redactURL(u *url.URL) string {
+	copied := *u
+	query := copied.Query()
+	for _, p := range secretParams {
+		if query.Has(p) {
+			query.Set(p, redacted)
+		}
+	}
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
+
+func redactHeaders(h http.Header) map[string][]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		out[k] = v
+	}
+	for _, name := range secretHeaders {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out[http.CanonicalHeaderKey(name)] = []string{redacted}
+		}
+	}
+	return out
+}
+
+// redactBody masks secrets in JSON and form-encoded bodies
+func redactBody(body []byte) []byte {
+	if len(body) == 0 || !utf8.Valid(body) {
+		return body
+	}
+
+	text := string(body)
+	if strings.HasPrefix(strings.TrimSpace(text), "{") || strings.HasPrefix(strings.TrimSpace(text), "[") {
+		return []byte(secretFields.ReplaceAllString(text, `${1}"`+redacted+`"`))
+	}
+
+	if form, err := url.ParseQuery(text); err == nil && strings.Contains(text, "=") {
+		changed := false
+		for _, p := range secretParams {
+			if form.Has(p) {
+				form.Set(p, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			return []byte(form.Encode())
+		}
+	}
+	return body
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s <%s>", r.Method, r.URL.Path, body)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "run.cassette.json")
+	rec := NewRecordingCassette(path)
+	client := &http.Client{Transport: rec}
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			rec.NoteService("gemini") // forces a full rewrite
+		}
+		resp, err := client.Post(fmt.Sprintf("%s/step/%d?key=secret", server.URL, i), "application/json", bytes.NewBufferString(`{"n":1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// The file is complete after every interaction
+		onDisk, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := json.MarshalIndent(rec.data, "", "  ")
+		if !bytes.Equal(onDisk, want) {
+			t.Fatalf("after request %d the cassette file is\n%s\nwant\n%s", i, onDisk, want)
+		}
+	}
+	if bytes.Contains(mustRead(t, path), []byte("secret")) {
+		t.Error("cassette contains an unredacted secret")
+	}
+
+	replay, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replay.HasService("gemini") {
+		t.Error("replayed cassette lost its services")
+	}
+	server.Close() // replay must not touch the network
+	client = &http.Client{Transport: replay}
+	resp, err := client.Post(server.URL+"/step/3?key=other", "application/json", bytes.NewBufferString(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got, want := string(body), `POST /step/3 <{"n":1}>`; got != want {
+		t.Errorf("replayed body = %q, want %q", got, want)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
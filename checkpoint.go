@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRunDir is where run checkpoints are stored unless overridden
+const defaultRunDir = ".agentscript/runs"
+
+// Run status values stored in the manifest
+const (
+	runStatusRunning   = "running"
+	runStatusFailed    = "failed"
+	runStatusCompleted = "completed"
+)
+
+// Checkpoint persists the output of each completed step of a run so that
+// a failed pipeline can be resumed without re-running (and re-paying for)
+// the steps that already succeeded.
+//
+// Layout of a run directory:
+//
+//	<runDir>/<run-id>/run.json        manifest (script hash, status, ...)
+//	<runDir>/<run-id>/script.as       copy of the script that was executed
+//	<runDir>/<run-id>/steps/<id>.json output of each completed step
+type Checkpoint struct {
+	dir      string
+	manifest runManifest
+	mu       sync.Mutex
+}
+
+// runManifest describes a single run
+type runManifest struct {
+	RunID      string    `json:"run_id"`
+	ScriptPath string    `json:"script_path,omitempty"`
+	ScriptHash string    `json:"script_hash"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Fallbacks  []string  `json:"fallbacks,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// stepRecord is the checkpointed output of one command
+type stepRecord struct {
+	StepID      string     `json:"step_id"`
+	Action      string     `json:"action"`
+	Arg         string     `json:"arg,omitempty"`
+	Output      string     `json:"output"`
+	Sources     []Citation `json:"sources,omitempty"`
+	CompletedAt time.Time  `json:"completed_at"`
+}
+
+// hashScript returns the content hash used to detect script changes
+func hashScript(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRunID generates a sortable, unique run identifier
+func newRunID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// NewCheckpoint creates a new run directory for the given script
+func NewCheckpoint(runDir, script, scriptPath string) (*Checkpoint, error) {
+	if runDir == "" {
+		runDir = defaultRunDir
+	}
+
+	runID := newRunID()
+	dir := filepath.Join(runDir, runID)
+	if err := os.MkdirAll(filepath.Join(dir, "steps"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	if scriptPath != "" {
+		if abs, err := filepath.Abs(scriptPath); err == nil {
+			scriptPath = abs
+		}
+	}
+
+	now := time.Now()
+	cp := &Checkpoint{
+		dir: dir,
+		manifest: runManifest{
+			RunID:      runID,
+			ScriptPath: scriptPath,
+			ScriptHash: hashScript(script),
+			Status:     runStatusRunning,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "script.as"), []byte(script), 0644); err != nil {
+		return nil, fmt.Errorf("failed to save script: %w", err)
+	}
+	if err := cp.saveManifest(); err != nil {
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// LoadCheckpoint opens an existing run directory
+func LoadCheckpoint(runDir, runID string) (*Checkpoint, error) {
+	if runDir == "" {
+		runDir = defaultRunDir
+	}
+
+	dir := filepath.Join(runDir, runID)
+	data, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run %q not found in %s", runID, runDir)
+		}
+		return nil, fmt.Errorf("failed to read run manifest: %w", err)
+	}
+
+	cp := &Checkpoint{dir: dir}
+	if err := json.Unmarshal(data, &cp.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse run manifest: %w", err)
+	}
+	return cp, nil
+}
+
+// ListRuns returns the manifests of all runs in runDir, newest first
+func ListRuns(runDir string) ([]runManifest, error) {
+	if runDir == "" {
+		runDir = defaultRunDir
+	}
+
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []runManifest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		cp, err := LoadCheckpoint(runDir, entry.Name())
+		if err != nil {
+			continue
+		}
+		runs = append(runs, cp.manifest)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	return runs, nil
+}
+
+// RunID returns the identifier of this run
+func (c *Checkpoint) RunID() string {
+	return c.manifest.RunID
+}
+
+// Script returns the script for this run. If the run was started from a
+// file that still exists, the current file contents are returned so that
+// edits can be detected by Validate.
+func (c *Checkpoint) Script() (string, error) {
+	if c.manifest.ScriptPath != "" {
+		if data, err := os.ReadFile(c.manifest.ScriptPath); err == nil {
+			return string(data), nil
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, "script.as"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read saved script: %w", err)
+	}
+	return string(data), nil
+}
+
+// Validate compares the script against the hash recorded for this run.
+// If the script changed, every stored step is stale: the checkpoints are
+// discarded and the run starts over with the new script. It returns the
+// number of checkpoints that were invalidated.
+func (c *Checkpoint) Validate(script string) (int, error) {
+	hash := hashScript(script)
+	if hash == c.manifest.ScriptHash {
+		return 0, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stepsDir := filepath.Join(c.dir, "steps")
+	entries, _ := os.ReadDir(stepsDir)
+	if err := os.RemoveAll(stepsDir); err != nil {
+		return 0, fmt.Errorf("failed to clear stale checkpoints: %w", err)
+	}
+	if err := os.MkdirAll(stepsDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create steps directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, "script.as"), []byte(script), 0644); err != nil {
+		return 0, fmt.Errorf("failed to save script: %w", err)
+	}
+
+	c.manifest.ScriptHash = hash
+	return len(entries), c.saveManifestLocked()
+}
+
+// Lookup returns the checkpointed output and sources for a step, if it
+// completed
+func (c *Checkpoint) Lookup(stepID string) (string, []Citation, bool) {
+	data, err := os.ReadFile(c.stepPath(stepID))
+	if err != nil {
+		return "", nil, false
+	}
+
+	var rec stepRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return "", nil, false
+	}
+	return rec.Output, rec.Sources, true
+}
+
+// Save records the output of a completed step and the sources behind it
+func (c *Checkpoint) Save(stepID string, cmd *Command, output string, sources []Citation) error {
+	rec := stepRecord{
+		StepID:      stepID,
+		Action:      cmd.Action,
+		Arg:         cmd.Arg,
+		Output:      output,
+		Sources:     sources,
+		CompletedAt: time.Now(),
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	return writeFileAtomic(c.stepPath(stepID), data)
+}
+
+// MarkFailed records that the run stopped with an error
+func (c *Checkpoint) MarkFailed(runErr error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manifest.Status = runStatusFailed
+	c.manifest.Error = runErr.Error()
+	return c.saveManifestLocked()
+}
+
+// NoteFallback records that a step fell back to another provider
+func (c *Checkpoint) NoteFallback(note string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manifest.Fallbacks = append(c.manifest.Fallbacks, note)
+	return c.saveManifestLocked()
+}
+
+// MarkCompleted records that every step of the run finished
+func (c *Checkpoint) MarkCompleted() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manifest.Status = runStatusCompleted
+	c.manifest.Error = ""
+	return c.saveManifestLocked()
+}
+
+// MarkRunning records that the run is (re)starting
+func (c *Checkpoint) MarkRunning() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.manifest.Status = runStatusRunning
+	c.manifest.Error = ""
+	return c.saveManifestLocked()
+}
+
+func (c *Checkpoint) stepPath(stepID string) string {
+	return filepath.Join(c.dir, "steps", stepID+".json")
+}
+
+func (c *Checkpoint) saveManifest() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveManifestLocked()
+}
+
+func (c *Checkpoint) saveManifestLocked() error {
+	c.manifest.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(c.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run manifest: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(c.dir, "run.json"), data)
+}
+
+// writeFileAtomic writes data to a temp file and renames it into place so
+// an interrupted run never leaves a half-written checkpoint behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// assignStepIDs gives every command in the program a stable identifier
+// based on its position in the script, e.g. "003-summarize". The same
+// script always yields the same IDs, which is what lets a resumed run
+// match commands to their checkpoints.
+func assignStepIDs(program *Program) map[*Command]string {
+	ids := make(map[*Command]string)
+	n := 0
+
+	var walk func(stmt *Statement)
+	walk = func(stmt *Statement) {
+		for ; stmt != nil; stmt = stmt.Pipe {
+			if stmt.Parallel != nil {
+				for _, branch := range stmt.Parallel.Branches {
+					walk(branch)
+				}
+			} else if stmt.Command != nil {
+				n++
+				ids[stmt.Command] = fmt.Sprintf("%03d-%s", n, strings.ToLower(stmt.Command.Action))
+			}
+		}
+	}
+
+	for _, stmt := range program.Statements {
+		walk(stmt)
+	}
+	return ids
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// value is what flows between steps: the text plus the web sources it was
+// built from, so sinks can list references however many steps later
+type value struct {
+	text    string
+	sources []Citation
+}
+
+// mergeSources combines source lists, keeping the first of each URL
+func mergeSources(lists ...[]Citation) []Citation {
+	var merged []Citation
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, src := range list {
+			if !seen[src.URL] {
+				seen[src.URL] = true
+				merged = append(merged, src)
+			}
+		}
+	}
+	return merged
+}
+
+// stepSources are the sources a step received, plus those it found
+type stepSources struct {
+	input []Citation
+
+	mu    sync.Mutex
+	found []Citation
+}
+
+type sourcesKey struct{}
+
+func withSources(ctx context.Context, input []Citation) (context.Context, *stepSources) {
+	s := &stepSources{input: input}
+	return context.WithValue(ctx, sourcesKey{}, s), s
+}
+
+func sourcesFrom(ctx context.Context) *stepSources {
+	s, _ := ctx.Value(sourcesKey{}).(*stepSources)
+	return s
+}
+
+// inputSources returns the sources behind the current step's input
+func inputSources(ctx context.Context) []Citation {
+	if s := sourcesFrom(ctx); s != nil {
+		return s.input
+	}
+	return nil
+}
+
+// output returns the sources to carry with the step's result
+func (s *stepSources) output() []Citation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return mergeSources(s.input, s.found)
+}
+
+// addSources numbers new sources for the run and attaches them to the
+// current step's result. The returned citations carry their ids.
+func (r *Runtime) addSources(ctx context.Context, sources []Citation) []Citation {
+	numbered := make([]Citation, len(sources))
+	r.mu.Lock()
+	if r.sourceIDs == nil {
+		r.sourceIDs = make(map[string]int)
+	}
+	for i, src := range sources {
+		id, ok := r.sourceIDs[src.URL]
+		if !ok {
+			id = len(r.sourceIDs) + 1
+			r.sourceIDs[src.URL] = id
+		}
+		src.ID = id
+		numbered[i] = src
+	}
+	r.mu.Unlock()
+
+	if s := sourcesFrom(ctx); s != nil {
+		s.mu.Lock()
+		s.found = mergeSources(s.found, numbered)
+		s.mu.Unlock()
+	}
+	return numbered
+}
+
+// restoreSources re-registers the ids of sources restored from a
+// checkpoint so that sources found later do not reuse them
+func (r *Runtime) restoreSources(sources []Citation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sourceIDs == nil {
+		r.sourceIDs = make(map[string]int)
+	}
+	for _, src := range sources {
+		r.sourceIDs[src.URL] = src.ID
+	}
+}
+
+// citationMarker matches [n] citation markers
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// renumberCitations rewrites the [n] markers of a grounded answer, which
+// count from 1 per answer, to the run-wide ids of its sources
+func renumberCitations(text string, sources []Citation) string {
+	return citationMarker.ReplaceAllStringFunc(text, func(marker string) string {
+		n, _ := strconv.Atoi(marker[1 : len(marker)-1])
+		if n < 1 || n > len(sources) {
+			return marker
+		}
+		return fmt.Sprintf("[%d]", sources[n-1].ID)
+	})
+}
+
+// citingSteps are the steps told to cite the sources of their input
+var citingSteps = map[string]bool{"ask": true, "summarize": true, "analyze": true, "translate": true}
+
+// citing adds the input's sources to the prompt of a citing step, with
+// instructions to cite them by id
+func (r *Runtime) citing(ctx context.Context, prompt string) string {
+	sources := inputSources(ctx)
+	cmd := stepFrom(ctx)
+	if len(sources) == 0 || cmd == nil || !citingSteps[cmd.Action] {
+		return prompt
+	}
+	return prompt + "\n\n" + formatCitations("Sources", sources) + `
+
+When a statement comes from one of these sources, cite it by its id in square brackets, e.g. [1], right after the statement. Keep any [n] citation markers already in the text. Do not cite anything else and do not add a source list.`
+}
+
+// references returns the sources to list after text: those it cites by id,
+// or all of them when it cites none, leaving out any whose URL the text
+// already contains
+func references(text string, sources []Citation) []Citation {
+	cited := make(map[int]bool)
+	for _, m := range citationMarker.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.Atoi(m[1])
+		cited[n] = true
+	}
+	citesAny := false
+	for _, src := range sources {
+		if cited[src.ID] {
+			citesAny = true
+			break
+		}
+	}
+
+	var refs []Citation
+	for _, src := range sources {
+		if (citesAny && !cited[src.ID]) || strings.Contains(text, src.URL) {
+			continue
+		}
+		refs = append(refs, src)
+	}
+	return refs
+}
+
+// withReferences appends a references section for the current step's
+// sources to text, formatted for the file it is saved to. Only prose files
+// (Markdown, text, HTML or no extension) get one; data files such as JSON
+// or CSV are left exactly as they are.
+func (r *Runtime) withReferences(ctx context.Context, text, path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case "", ".md", ".markdown", ".txt", ".text", ".html", ".htm":
+	default:
+		return text
+	}
+	refs := references(text, inputSources(ctx))
+	if len(refs) == 0 {
+		return text
+	}
+	switch ext {
+	case ".md", ".markdown":
+		var b strings.Builder
+		b.WriteString(strings.TrimRight(text, "\n"))
+		b.WriteString("\n\n## References\n")
+		for _, src := range refs {
+			fmt.Fprintf(&b, "\n%d. [%s](%s)", src.ID, citationTitle(src), src.URL)
+		}
+		return b.String() + "\n"
+	case ".html", ".htm":
+		return htmlWithReferences(text, refs)
+	}
+	return strings.TrimRight(text, "\n") + "\n\n" + formatCitations("References", refs) + "\n"
+}
+
+// htmlWithReferences inserts a references section before </body>, or
+// appends it to an HTML fragment
+func htmlWithReferences(page string, refs []Citation) string {
+	if len(refs) == 0 {
+		return page
+	}
+	var b strings.Builder
+	b.WriteString(`<section id="references" style="padding:20px 30px;font-size:14px;"><h2>References</h2><ol>`)
+	for _, src := range refs {
+		fmt.Fprintf(&b, `<li value="%d"><a href="%s">%s</a></li>`, src.ID, html.EscapeString(src.URL), html.EscapeString(citationTitle(src)))
+	}
+	b.WriteString("</ol></section>\n")
+
+	if i := strings.LastIndex(strings.ToLower(page), "</body>"); i != -1 {
+		return page[:i] + b.String() + page[i:]
+	}
+	return page + "\n" + b.String()
+}
+
+// htmlReferences adds the current step's references to an HTML page
+func (r *Runtime) htmlReferences(ctx context.Context, page string) string {
+	return htmlWithReferences(page, references(page, inputSources(ctx)))
+}
+
+func citationTitle(src Citation) string {
+	if src.Title == "" {
+		return src.URL
+	}
+	return src.Title
+}
@@ -3,18 +3,24 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 )
 
+const defaultClaudeBaseURL = "https://api.anthropic.com"
+
 // ClaudeClient handles Anthropic Claude API
 type ClaudeClient struct {
 	apiKey     string
 	model      string
+	baseURL    string
 	httpClient *http.Client
+	cache      *ResponseCache
 }
 
 // NewClaudeClient creates a new Claude API client
@@ -23,14 +29,15 @@ func NewClaudeClient(apiKey string) *ClaudeClient {
 	return &ClaudeClient{
 		apiKey:     apiKey,
 		model:      model,
-		httpClient: &http.Client{},
+		baseURL:    defaultClaudeBaseURL,
+		httpClient: newHTTPClient(),
 	}
 }
 
 // Message represents a Claude message
 type claudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // a string or a list of content blocks
 }
 
 // GenerateReactSPA generates a React SPA using Claude
@@ -75,33 +82,9 @@ No markdown code fences, no explanation, just the raw HTML.`, title, content)
 		},
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := c.doRequest(ctx, reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Claude API error: status %d - %s", resp.StatusCode, string(body))
+		return "", err
 	}
 
 	// Parse response
@@ -150,45 +133,151 @@ No markdown code fences, no explanation, just the raw HTML.`, title, content)
 	return result, nil
 }
 
-// Chat sends a message to Claude and returns the response
-func (c *ClaudeClient) Chat(ctx context.Context, prompt string) (string, error) {
+// Name implements Provider
+func (c *ClaudeClient) Name() string {
+	return "claude"
+}
+
+// Generate sends a prompt to Claude and returns the reply
+func (c *ClaudeClient) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return c.messages(ctx, prompt, opts, nil)
+}
+
+// Stream sends a prompt and calls onChunk with text as it arrives
+func (c *ClaudeClient) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	return c.messages(ctx, prompt, opts, onChunk)
+}
+
+// GenerateWithFiles sends images along with the prompt. Claude does not
+// accept video input.
+func (c *ClaudeClient) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	var content []map[string]interface{}
+	for _, path := range files {
+		mimeType := getMimeType(path)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return "", fmt.Errorf("claude cannot analyze %s files (%s)", mimeType, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		content = append(content, map[string]interface{}{
+			"type": "image",
+			"source": map[string]string{
+				"type":       "base64",
+				"media_type": mimeType,
+				"data":       base64.StdEncoding.EncodeToString(data),
+			},
+		})
+	}
+	content = append(content, map[string]interface{}{"type": "text", "text": prompt})
+	return c.messages(ctx, content, opts, nil)
+}
+
+// GenerateStructured forces a tool call whose input schema is the
+// requested schema, so the reply is always JSON of that shape. Tool inputs
+// must be objects, so other schemas are wrapped in a "value" property.
+func (c *ClaudeClient) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	inputSchema := schema
+	wrapped := schema["type"] != "object"
+	if wrapped {
+		inputSchema = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"value": schema},
+			"required":   []string{"value"},
+		}
+	}
+
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	maxTokens := 4096
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
 	reqBody := map[string]interface{}{
-		"model":      c.model,
-		"max_tokens": 4096,
-		"messages": []claudeMessage{
-			{Role: "user", Content: prompt},
-		},
+		"model":      model,
+		"max_tokens": maxTokens,
+		"messages":   []claudeMessage{{Role: "user", Content: prompt}},
+		"tools": []map[string]any{{
+			"name":         "respond",
+			"description":  "Return the requested data",
+			"input_schema": inputSchema,
+		}},
+		"tool_choice": map[string]string{"type": "tool", "name": "respond"},
+	}
+	if opts.Temperature != nil {
+		reqBody["temperature"] = *opts.Temperature
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
+	body, err := c.doRequest(ctx, reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(jsonBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	var claudeResp struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &claudeResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
+	for _, block := range claudeResp.Content {
+		if block.Type != "tool_use" {
+			continue
+		}
+		if !wrapped {
+			return string(block.Input), nil
+		}
+		var input struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(block.Input, &input); err != nil {
+			return "", fmt.Errorf("failed to parse tool input: %w", err)
+		}
+		return string(input.Value), nil
+	}
+	return "", fmt.Errorf("no structured output in Claude response")
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// messages sends a single user message and returns the text of the reply
+func (c *ClaudeClient) messages(ctx context.Context, content interface{}, opts GenOptions, onChunk func(string)) (string, error) {
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	maxTokens := 4096
+	if opts.MaxTokens > 0 {
+		maxTokens = opts.MaxTokens
+	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+	reqBody := map[string]interface{}{
+		"model":      model,
+		"max_tokens": maxTokens,
+		"messages": []claudeMessage{
+			{Role: "user", Content: content},
+		},
+	}
+	if opts.Temperature != nil {
+		reqBody["temperature"] = *opts.Temperature
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	if onChunk != nil {
+		return c.doStream(ctx, reqBody, onChunk)
 	}
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Claude API error: status %d - %s", resp.StatusCode, string(body))
+	body, err := c.doRequest(ctx, reqBody)
+	if err != nil {
+		return "", err
 	}
+	return claudeText(body)
+}
 
+// claudeText extracts the reply text from a Messages API response
+func claudeText(body []byte) (string, error) {
 	var claudeResp struct {
 		Content []struct {
 			Type string `json:"type"`
@@ -206,3 +295,137 @@ func (c *ClaudeClient) Chat(ctx context.Context, prompt string) (string, error)
 
 	return claudeResp.Content[0].Text, nil
 }
+
+// doRequest posts a Messages API request and returns the raw response body.
+// Successful responses are served from and stored in the response cache.
+func (c *ClaudeClient) doRequest(ctx context.Context, reqBody map[string]interface{}) ([]byte, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	model, _ := reqBody["model"].(string)
+	key := cacheKey("claude", model, "messages", jsonBody)
+	if cached, ok := c.cache.Get(key); ok {
+		return cached, nil
+	}
+
+	resp, err := c.post(ctx, jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	c.cache.Put(key, "claude", model, "messages", body)
+	return body, nil
+}
+
+// doStream is doRequest with server-sent events: text deltas are passed
+// to onChunk as they arrive. The assembled reply is cached like a
+// non-streamed response.
+func (c *ClaudeClient) doStream(ctx context.Context, reqBody map[string]interface{}, onChunk func(string)) (string, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	model, _ := reqBody["model"].(string)
+	key := cacheKey("claude", model, "messages", jsonBody)
+	if cached, ok := c.cache.Get(key); ok {
+		text, err := claudeText(cached)
+		if err == nil {
+			onChunk(text)
+		}
+		return text, err
+	}
+
+	reqBody["stream"] = true
+	defer delete(reqBody, "stream")
+	streamBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.post(ctx, streamBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event string, data []byte) error {
+		switch event {
+		case "content_block_delta":
+			var delta struct {
+				Delta struct {
+					Text string `json:"text"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal(data, &delta); err != nil {
+				return fmt.Errorf("failed to parse stream: %w", err)
+			}
+			text.WriteString(delta.Delta.Text)
+			onChunk(delta.Delta.Text)
+		case "error":
+			return claudeError(http.StatusInternalServerError, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return text.String(), err
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text.String()}},
+	})
+	c.cache.Put(key, "claude", model, "messages", body)
+	return text.String(), nil
+}
+
+// post sends a Messages API request and returns the successful response
+func (c *ClaudeClient) post(ctx context.Context, jsonBody []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/messages", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, claudeError(resp.StatusCode, body)
+	}
+	return resp, nil
+}
+
+// claudeError builds the APIError for a failed call. An "overloaded_error"
+// (sent mid-stream as well as with status 529) counts as a server error.
+func claudeError(status int, body []byte) error {
+	var apiErr struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := string(body)
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		message = apiErr.Error.Message
+		if apiErr.Error.Type == "overloaded_error" {
+			status = 529
+		}
+	}
+	return &APIError{Provider: "Claude", StatusCode: status, Message: message}
+}
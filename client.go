@@ -16,13 +16,27 @@ import (
 	"time"
 )
 
-const baseURL = "https://generativelanguage.googleapis.com/v1beta/models"
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// MediaClient generates images, video and speech. It is implemented by
+// GeminiClient and, for offline runs, FakeClient. Text generation goes
+// through the Provider interface instead.
+type MediaClient interface {
+	GenerateImage(ctx context.Context, prompt string) ([]byte, error)
+	GenerateVideo(ctx context.Context, prompt string, vertical bool) (string, error)
+	GenerateVideoFromImages(ctx context.Context, imagePaths []string, prompt string) (string, error)
+	TextToSpeech(ctx context.Context, text string, voice string) (string, error)
+	IsFileURI(s string) bool
+	DownloadFile(ctx context.Context, fileURI string, outputPath string) (string, error)
+}
 
 // GeminiClient is a simple HTTP client for the Gemini API
 type GeminiClient struct {
 	apiKey     string
 	model      string
+	baseURL    string
 	httpClient *http.Client
+	cache      *ResponseCache
 }
 
 // NewGeminiClient creates a new Gemini client
@@ -33,16 +47,49 @@ func NewGeminiClient(apiKey, model string) *GeminiClient {
 	return &GeminiClient{
 		apiKey:     apiKey,
 		model:      model,
-		httpClient: &http.Client{},
+		baseURL:    defaultGeminiBaseURL,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// modelURL builds the endpoint URL for a model method
+func (c *GeminiClient) modelURL(model, method string) string {
+	return fmt.Sprintf("%s/models/%s:%s?key=%s", c.baseURL, model, method, c.apiKey)
+}
+
+// IsFileURI reports whether s is a Gemini Files API URI (e.g. a Veo video)
+func (c *GeminiClient) IsFileURI(s string) bool {
+	if !strings.Contains(s, "/files/") {
+		return false
+	}
+	if strings.HasPrefix(s, apiOrigin(defaultGeminiBaseURL)+"/") {
+		return true
+	}
+	return c != nil && strings.HasPrefix(s, apiOrigin(c.baseURL)+"/")
+}
+
+// apiOrigin returns the scheme and host of a base URL
+func apiOrigin(base string) string {
+	if i := strings.Index(base, "://"); i != -1 {
+		if j := strings.Index(base[i+3:], "/"); j != -1 {
+			return base[:i+3+j]
+		}
 	}
+	return base
 }
 
 // Request structures
 type generateRequest struct {
 	Contents         []content         `json:"contents"`
+	Tools            []geminiTool      `json:"tools,omitempty"`
 	GenerationConfig *generationConfig `json:"generationConfig,omitempty"`
 }
 
+// geminiTool enables a built-in tool such as Google Search grounding
+type geminiTool struct {
+	GoogleSearch *struct{} `json:"google_search,omitempty"`
+}
+
 type content struct {
 	Parts []part `json:"parts"`
 }
@@ -64,7 +111,10 @@ type fileData struct {
 }
 
 type generationConfig struct {
-	ResponseMimeType string `json:"response_mime_type,omitempty"`
+	ResponseMimeType string         `json:"response_mime_type,omitempty"`
+	ResponseSchema   map[string]any `json:"response_schema,omitempty"`
+	Temperature      *float64       `json:"temperature,omitempty"`
+	MaxOutputTokens  int            `json:"max_output_tokens,omitempty"`
 }
 
 // Response structures
@@ -74,7 +124,8 @@ type generateResponse struct {
 }
 
 type candidate struct {
-	Content content `json:"content"`
+	Content           content            `json:"content"`
+	GroundingMetadata *groundingMetadata `json:"groundingMetadata,omitempty"`
 }
 
 type apiError struct {
@@ -82,104 +133,147 @@ type apiError struct {
 	Code    int    `json:"code"`
 }
 
-// GenerateContent sends a prompt to Gemini and returns the response text
-func (c *GeminiClient) GenerateContent(ctx context.Context, prompt string) (string, error) {
-	url := fmt.Sprintf("%s/%s:generateContent?key=%s", baseURL, c.model, c.apiKey)
-
-	reqBody := generateRequest{
-		Contents: []content{
-			{
-				Parts: []part{
-					{Text: prompt},
-				},
-			},
-		},
+// geminiError builds the APIError for a failed Gemini call
+func geminiError(status int, apiErr *apiError, body []byte) error {
+	if apiErr == nil {
+		var errResp struct {
+			Error *apiError `json:"error,omitempty"`
+		}
+		json.Unmarshal(body, &errResp)
+		apiErr = errResp.Error
 	}
-
-	return c.doRequest(ctx, url, reqBody)
+	if apiErr != nil {
+		return &APIError{Provider: "Gemini", StatusCode: status, Message: apiErr.Message}
+	}
+	return &APIError{Provider: "Gemini", StatusCode: status, Message: string(body)}
 }
 
-// AnalyzeImage analyzes an image file with a prompt
-func (c *GeminiClient) AnalyzeImage(ctx context.Context, imagePath, prompt string) (string, error) {
-	url := fmt.Sprintf("%s/%s:generateContent?key=%s", baseURL, c.model, c.apiKey)
+// Name implements Provider
+func (c *GeminiClient) Name() string { return "gemini" }
 
-	// Read and encode image
-	imageData, err := os.ReadFile(imagePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read image: %w", err)
-	}
+// Generate implements Provider
+func (c *GeminiClient) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return c.generate(ctx, []part{{Text: prompt}}, opts, nil, nil)
+}
 
-	mimeType := getMimeType(imagePath)
-	encoded := base64.StdEncoding.EncodeToString(imageData)
+// Stream uses streamGenerateContent and calls onChunk as text arrives
+func (c *GeminiClient) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	return c.generate(ctx, []part{{Text: prompt}}, opts, nil, onChunk)
+}
 
-	reqBody := generateRequest{
-		Contents: []content{
-			{
-				Parts: []part{
-					{
-						InlineData: &inlineData{
-							MimeType: mimeType,
-							Data:     encoded,
-						},
-					},
-					{Text: prompt},
-				},
+// GenerateWithFiles sends images or videos inline with the prompt
+func (c *GeminiClient) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	var parts []part
+	for _, path := range files {
+		// For videos we'd need the File API; support small files inline (< 20MB)
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.Size() > 20*1024*1024 {
+			return "", fmt.Errorf("%s too large for inline processing (max 20MB)", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		parts = append(parts, part{
+			InlineData: &inlineData{
+				MimeType: getMimeType(path),
+				Data:     base64.StdEncoding.EncodeToString(data),
 			},
-		},
+		})
 	}
+	parts = append(parts, part{Text: prompt})
 
-	return c.doRequest(ctx, url, reqBody)
+	return c.generate(ctx, parts, opts, nil, nil)
 }
 
-// AnalyzeVideo analyzes a video with a prompt (using File API for larger files)
-func (c *GeminiClient) AnalyzeVideo(ctx context.Context, videoPath, prompt string) (string, error) {
-	// For videos, we need to upload to File API first, then reference
-	// For now, support small videos via inline data (< 20MB)
+// GenerateStructured uses Gemini's JSON mode with a response schema
+func (c *GeminiClient) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	return c.generate(ctx, []part{{Text: prompt}}, opts, &generationConfig{
+		ResponseMimeType: "application/json",
+		ResponseSchema:   geminiSchema(schema),
+	}, nil)
+}
 
-	fileInfo, err := os.Stat(videoPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to stat video: %w", err)
-	}
+// geminiSchemaKeys are the schema keywords Gemini accepts
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "description": true, "nullable": true,
+	"enum": true, "properties": true, "required": true, "items": true,
+	"minItems": true, "maxItems": true, "minimum": true, "maximum": true,
+	"propertyOrdering": true, "anyOf": true, "title": true,
+}
 
-	// Check file size (limit to 20MB for inline)
-	if fileInfo.Size() > 20*1024*1024 {
-		return "", fmt.Errorf("video too large for inline processing (max 20MB). Use File API for larger videos")
+// geminiSchema converts a JSON schema to Gemini's OpenAPI subset, which
+// spells types in upper case
+func geminiSchema(schema map[string]any) map[string]any {
+	if schema == nil {
+		return nil
 	}
+	out := make(map[string]any, len(schema))
+	for key, value := range schema {
+		if !geminiSchemaKeys[key] {
+			// Gemini rejects keywords such as $schema and additionalProperties
+			continue
+		}
+		switch key {
+		case "type":
+			if t, ok := value.(string); ok {
+				value = strings.ToUpper(t)
+			}
+		case "items":
+			if items, ok := value.(map[string]any); ok {
+				value = geminiSchema(items)
+			}
+		case "properties":
+			if props, ok := value.(map[string]any); ok {
+				converted := make(map[string]any, len(props))
+				for name, prop := range props {
+					if propSchema, ok := prop.(map[string]any); ok {
+						converted[name] = geminiSchema(propSchema)
+					}
+				}
+				value = converted
+			}
+		}
+		out[key] = value
+	}
+	return out
+}
 
-	url := fmt.Sprintf("%s/%s:generateContent?key=%s", baseURL, c.model, c.apiKey)
-
-	// Read and encode video
-	videoData, err := os.ReadFile(videoPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read video: %w", err)
+// generate sends a generateContent request with the given parts, streaming
+// the reply to onChunk when set
+func (c *GeminiClient) generate(ctx context.Context, parts []part, opts GenOptions, cfg *generationConfig, onChunk func(string)) (string, error) {
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
 	}
 
-	mimeType := getMimeType(videoPath)
-	encoded := base64.StdEncoding.EncodeToString(videoData)
+	if opts.Temperature != nil || opts.MaxTokens > 0 {
+		if cfg == nil {
+			cfg = &generationConfig{}
+		}
+		cfg.Temperature = opts.Temperature
+		cfg.MaxOutputTokens = opts.MaxTokens
+	}
 
 	reqBody := generateRequest{
-		Contents: []content{
-			{
-				Parts: []part{
-					{
-						InlineData: &inlineData{
-							MimeType: mimeType,
-							Data:     encoded,
-						},
-					},
-					{Text: prompt},
-				},
-			},
-		},
+		Contents:         []content{{Parts: parts}},
+		GenerationConfig: cfg,
 	}
 
-	return c.doRequest(ctx, url, reqBody)
+	if onChunk != nil {
+		return c.doStream(ctx, model, reqBody, onChunk)
+	}
+	return c.doRequest(ctx, model, reqBody)
 }
 
 // GenerateImage generates an image using Imagen model
 func (c *GeminiClient) GenerateImage(ctx context.Context, prompt string) ([]byte, error) {
 	// Use Imagen 4 - Imagen 3 has been shut down
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/imagen-4.0-generate-001:predict?key=%s", c.apiKey)
+	url := c.modelURL("imagen-4.0-generate-001", "predict")
 
 	reqBody := map[string]interface{}{
 		"instances": []map[string]string{
@@ -218,10 +312,7 @@ func (c *GeminiClient) GenerateImage(ctx context.Context, prompt string) ([]byte
 			Error *apiError `json:"error,omitempty"`
 		}
 		json.Unmarshal(body, &errResp)
-		if errResp.Error != nil {
-			return nil, fmt.Errorf("API error: %s (code %d)", errResp.Error.Message, errResp.Error.Code)
-		}
-		return nil, fmt.Errorf("API error: status %d - %s", resp.StatusCode, string(body))
+		return nil, geminiError(resp.StatusCode, errResp.Error, body)
 	}
 
 	// Parse response
@@ -248,12 +339,187 @@ func (c *GeminiClient) GenerateImage(ctx context.Context, prompt string) ([]byte
 	return imageBytes, nil
 }
 
-func (c *GeminiClient) doRequest(ctx context.Context, url string, reqBody generateRequest) (string, error) {
+// CountTokens asks Gemini how many tokens text is for the model (the
+// client's default when model is empty)
+func (c *GeminiClient) CountTokens(ctx context.Context, text, model string) (int, error) {
+	if model == "" {
+		model = c.model
+	}
+	jsonBody, err := json.Marshal(generateRequest{Contents: []content{{Parts: []part{{Text: text}}}}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	key := cacheKey("gemini", model, "countTokens", jsonBody)
+	body, ok := c.cache.Get(key)
+	if !ok {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.modelURL(model, "countTokens"), bytes.NewReader(jsonBody))
+		if err != nil {
+			return 0, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return 0, fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, geminiError(resp.StatusCode, nil, body)
+		}
+		c.cache.Put(key, "gemini", model, "countTokens", body)
+	}
+
+	var countResp struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	if err := json.Unmarshal(body, &countResp); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return countResp.TotalTokens, nil
+}
+
+// Embed returns an embedding per text using batchEmbedContents. Queries
+// and documents are embedded with their own retrieval task types.
+func (c *GeminiClient) Embed(ctx context.Context, texts []string, model string, query bool) ([][]float32, error) {
+	taskType := "RETRIEVAL_DOCUMENT"
+	if query {
+		taskType = "RETRIEVAL_QUERY"
+	}
+	type embedRequest struct {
+		Model    string  `json:"model"`
+		Content  content `json:"content"`
+		TaskType string  `json:"taskType"`
+	}
+	var reqBody struct {
+		Requests []embedRequest `json:"requests"`
+	}
+	for _, text := range texts {
+		reqBody.Requests = append(reqBody.Requests, embedRequest{
+			Model:    "models/" + model,
+			Content:  content{Parts: []part{{Text: text}}},
+			TaskType: taskType,
+		})
+	}
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.modelURL(model, "batchEmbedContents"), bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, geminiError(resp.StatusCode, nil, body)
+	}
+
+	var embedResp struct {
+		Embeddings []struct {
+			Values []float32 `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(body, &embedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embedResp.Embeddings))
+	}
+	vectors := make([][]float32, len(texts))
+	for i, e := range embedResp.Embeddings {
+		vectors[i] = e.Values
+	}
+	return vectors, nil
+}
+
+func (c *GeminiClient) doRequest(ctx context.Context, model string, reqBody generateRequest) (string, error) {
+	body, err := c.doRaw(ctx, model, reqBody)
+	if err != nil {
+		return "", err
+	}
+	return parseGenerateResponse(body)
+}
+
+// doRaw sends a generateContent request and returns the response body,
+// which has been checked for errors
+func (c *GeminiClient) doRaw(ctx context.Context, model string, reqBody generateRequest) ([]byte, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := c.modelURL(model, "generateContent")
+	key := cacheKey("gemini", model, "generateContent", jsonBody)
+	if cached, ok := c.cache.Get(key); ok {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	// Proxies answer 5xx with HTML, which would otherwise fail to parse
+	// and hide that the request can be retried elsewhere
+	if resp.StatusCode != http.StatusOK {
+		return nil, geminiError(resp.StatusCode, nil, body)
+	}
+
+	if _, err := parseGenerateResponse(body); err != nil {
+		return nil, err
+	}
+
+	// Only successful responses are cached
+	c.cache.Put(key, "gemini", model, "generateContent", body)
+	return body, nil
+}
+
+// doStream is doRequest over streamGenerateContent. The assembled reply
+// is cached as if it came from generateContent, and a cached reply is
+// passed to onChunk in one piece.
+func (c *GeminiClient) doStream(ctx context.Context, model string, reqBody generateRequest, onChunk func(string)) (string, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	key := cacheKey("gemini", model, "generateContent", jsonBody)
+	if cached, ok := c.cache.Get(key); ok {
+		text, err := parseGenerateResponse(cached)
+		if err == nil {
+			onChunk(text)
+		}
+		return text, err
+	}
+
+	url := c.modelURL(model, "streamGenerateContent") + "&alt=sse"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
@@ -266,18 +532,46 @@ func (c *GeminiClient) doRequest(ctx context.Context, url string, reqBody genera
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", geminiError(resp.StatusCode, nil, body)
+	}
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(_ string, data []byte) error {
+		var chunk generateResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream: %w", err)
+		}
+		if chunk.Error != nil {
+			return geminiError(chunk.Error.Code, chunk.Error, data)
+		}
+		if len(chunk.Candidates) > 0 {
+			for _, p := range chunk.Candidates[0].Content.Parts {
+				text.WriteString(p.Text)
+				onChunk(p.Text)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return text.String(), err
 	}
 
+	body, _ := json.Marshal(generateResponse{Candidates: []candidate{{Content: content{Parts: []part{{Text: text.String()}}}}}})
+	c.cache.Put(key, "gemini", model, "generateContent", body)
+	return text.String(), nil
+}
+
+// parseGenerateResponse extracts the text of the first candidate
+func parseGenerateResponse(body []byte) (string, error) {
 	var genResp generateResponse
 	if err := json.Unmarshal(body, &genResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	if genResp.Error != nil {
-		return "", fmt.Errorf("API error: %s (code %d)", genResp.Error.Message, genResp.Error.Code)
+		return "", geminiError(genResp.Error.Code, genResp.Error, body)
 	}
 
 	if len(genResp.Candidates) == 0 || len(genResp.Candidates[0].Content.Parts) == 0 {
@@ -308,6 +602,8 @@ func getMimeType(path string) string {
 		return "video/x-msvideo"
 	case ".webm":
 		return "video/webm"
+	case ".pdf":
+		return "application/pdf"
 	default:
 		return "application/octet-stream"
 	}
@@ -316,7 +612,7 @@ func getMimeType(path string) string {
 // GenerateVideo generates a video using Veo model
 func (c *GeminiClient) GenerateVideo(ctx context.Context, prompt string, vertical bool) (string, error) {
 	// Use Veo 3.1 for video generation with predictLongRunning endpoint
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/veo-3.1-generate-preview:predictLongRunning?key=%s", c.apiKey)
+	url := c.modelURL("veo-3.1-generate-preview", "predictLongRunning")
 
 	aspectRatio := "16:9"
 	if vertical {
@@ -362,10 +658,7 @@ func (c *GeminiClient) GenerateVideo(ctx context.Context, prompt string, vertica
 			Error *apiError `json:"error,omitempty"`
 		}
 		json.Unmarshal(body, &errResp)
-		if errResp.Error != nil {
-			return "", fmt.Errorf("API error: %s (code %d)", errResp.Error.Message, errResp.Error.Code)
-		}
-		return "", fmt.Errorf("API error: status %d - %s", resp.StatusCode, string(body))
+		return "", geminiError(resp.StatusCode, errResp.Error, body)
 	}
 
 	// Parse response - this returns an operation name for polling
@@ -379,7 +672,7 @@ func (c *GeminiClient) GenerateVideo(ctx context.Context, prompt string, vertica
 	}
 
 	if opResp.Error != nil {
-		return "", fmt.Errorf("API error: %s (code %d)", opResp.Error.Message, opResp.Error.Code)
+		return "", geminiError(opResp.Error.Code, opResp.Error, nil)
 	}
 
 	if opResp.Name == "" {
@@ -392,7 +685,7 @@ func (c *GeminiClient) GenerateVideo(ctx context.Context, prompt string, vertica
 
 // pollVideoOperation polls for video generation completion
 func (c *GeminiClient) pollVideoOperation(ctx context.Context, operationName string) (string, error) {
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/%s?key=%s", operationName, c.apiKey)
+	url := fmt.Sprintf("%s/%s?key=%s", c.baseURL, operationName, c.apiKey)
 
 	for i := 0; i < 120; i++ { // Poll for up to 10 minutes
 		select {
@@ -475,7 +768,7 @@ func (c *GeminiClient) pollVideoOperation(ctx context.Context, operationName str
 // GenerateVideoFromImages generates a video from multiple images
 func (c *GeminiClient) GenerateVideoFromImages(ctx context.Context, imagePaths []string, prompt string) (string, error) {
 	// Use Veo 3.1 with first frame (and optionally last frame)
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/veo-3.1-generate-preview:predictLongRunning?key=%s", c.apiKey)
+	url := c.modelURL("veo-3.1-generate-preview", "predictLongRunning")
 
 	if len(imagePaths) == 0 {
 		return "", fmt.Errorf("no images provided")
@@ -548,10 +841,7 @@ func (c *GeminiClient) GenerateVideoFromImages(ctx context.Context, imagePaths [
 			Error *apiError `json:"error,omitempty"`
 		}
 		json.Unmarshal(body, &errResp)
-		if errResp.Error != nil {
-			return "", fmt.Errorf("API error: %s (code %d)", errResp.Error.Message, errResp.Error.Code)
-		}
-		return "", fmt.Errorf("API error: status %d - %s", resp.StatusCode, string(body))
+		return "", geminiError(resp.StatusCode, errResp.Error, body)
 	}
 
 	var opResp struct {
@@ -564,7 +854,7 @@ func (c *GeminiClient) GenerateVideoFromImages(ctx context.Context, imagePaths [
 	}
 
 	if opResp.Error != nil {
-		return "", fmt.Errorf("API error: %s (code %d)", opResp.Error.Message, opResp.Error.Code)
+		return "", geminiError(opResp.Error.Code, opResp.Error, nil)
 	}
 
 	if opResp.Name == "" {
@@ -576,8 +866,14 @@ func (c *GeminiClient) GenerateVideoFromImages(ctx context.Context, imagePaths [
 
 // DownloadFile downloads a file from the Gemini API and saves it locally
 func (c *GeminiClient) DownloadFile(ctx context.Context, fileURI string, outputPath string) (string, error) {
-	// Add API key to the URI
+	// The API returns URIs on its public host; route them through the
+	// configured endpoint when it has been overridden
 	downloadURL := fileURI
+	if origin := apiOrigin(defaultGeminiBaseURL); origin != apiOrigin(c.baseURL) && strings.HasPrefix(downloadURL, origin) {
+		downloadURL = apiOrigin(c.baseURL) + strings.TrimPrefix(downloadURL, origin)
+	}
+
+	// Add API key to the URI
 	if strings.Contains(downloadURL, "?") {
 		downloadURL += "&key=" + c.apiKey
 	} else {
@@ -618,7 +914,7 @@ func (c *GeminiClient) DownloadFile(ctx context.Context, fileURI string, outputP
 
 // TextToSpeech converts text to speech using Gemini TTS
 func (c *GeminiClient) TextToSpeech(ctx context.Context, text string, voice string) (string, error) {
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash-preview-tts:generateContent?key=%s", c.apiKey)
+	url := c.modelURL("gemini-2.5-flash-preview-tts", "generateContent")
 
 	reqBody := map[string]interface{}{
 		"contents": []map[string]interface{}{
@@ -671,14 +967,14 @@ func (c *GeminiClient) TextToSpeech(ctx context.Context, text string, voice stri
 		}
 
 		if resp.StatusCode == 500 || resp.StatusCode == 503 {
-			lastErr = fmt.Errorf("TTS API error: status %d (attempt %d/3)", resp.StatusCode, attempt)
+			lastErr = geminiError(resp.StatusCode, nil, body)
 			fmt.Printf("⚠️ TTS API returned %d, retrying in %d seconds...\n", resp.StatusCode, attempt*2)
 			time.Sleep(time.Duration(attempt) * 2 * time.Second)
 			continue
 		}
 
 		if resp.StatusCode != 200 {
-			return "", fmt.Errorf("TTS API error: status %d - %s", resp.StatusCode, string(body))
+			return "", geminiError(resp.StatusCode, nil, body)
 		}
 
 		// Success
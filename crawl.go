@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crawl defaults, overridable with depth=, max_pages=, concurrency= and rpm=
+const (
+	defaultCrawlDepth       = 2
+	defaultCrawlPages       = 50
+	defaultCrawlConcurrency = 4
+	defaultCrawlRPM         = 120
+)
+
+// crawledPage is one page of a crawl
+type crawledPage struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Depth    int    `json:"depth"`
+	Markdown string `json:"markdown"`
+}
+
+// skippedExtensions are links that are never pages
+var skippedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true,
+	".ico": true, ".css": true, ".js": true, ".mjs": true, ".map": true, ".woff": true,
+	".woff2": true, ".ttf": true, ".eot": true, ".zip": true, ".gz": true, ".tgz": true,
+	".tar": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true, ".exe": true,
+	".dmg": true, ".pkg": true, ".deb": true, ".rpm": true, ".iso": true, ".mp3": true,
+	".mp4": true, ".wav": true, ".webm": true, ".mov": true, ".avi": true,
+}
+
+// crawl reads a site breadth-first from start, following links up to
+// depth hops away while they stay on the same host (scope=domain) or under
+// the start page's directory (scope=prefix, the default). It obeys
+// robots.txt, fetches pages concurrently under a rate limiter and returns
+// a JSON array of pages with their Markdown.
+func (r *Runtime) crawl(ctx context.Context, cmd *Command, start, input string) (string, error) {
+	if start == "" {
+		start = firstURL.FindString(input)
+	}
+	startURL, err := url.Parse(start)
+	if err != nil || (startURL.Scheme != "http" && startURL.Scheme != "https") || startURL.Host == "" {
+		return "", fmt.Errorf("invalid start URL %q - only http and https are supported", start)
+	}
+
+	depth, err := intOption(cmd, "depth", defaultCrawlDepth, 0)
+	if err != nil {
+		return "", err
+	}
+	maxPages, err := intOption(cmd, "max_pages", defaultCrawlPages, 1)
+	if err != nil {
+		return "", err
+	}
+	concurrency, err := intOption(cmd, "concurrency", defaultCrawlConcurrency, 1)
+	if err != nil {
+		return "", err
+	}
+	rpm, err := intOption(cmd, "rpm", defaultCrawlRPM, 1)
+	if err != nil {
+		return "", err
+	}
+	timeout := defaultFetchTimeout
+	if v, ok := cmd.Option("timeout"); ok {
+		if timeout, err = parseTimeout(v); err != nil {
+			return "", err
+		}
+	}
+	maxBytes := int64(defaultFetchMaxBytes)
+	if v, ok := cmd.Option("max_size"); ok {
+		if maxBytes, err = parseSize(v); err != nil {
+			return "", err
+		}
+	}
+
+	inScope := scopeFilter(startURL, "prefix")
+	if v, ok := cmd.Option("scope"); ok {
+		if v != "domain" && v != "prefix" {
+			return "", fmt.Errorf("invalid scope %q (expected domain or prefix)", v)
+		}
+		inScope = scopeFilter(startURL, v)
+	}
+
+	robots := fetchRobots(ctx, startURL)
+	if !robots.allowed(startURL) {
+		return "", fmt.Errorf("robots.txt disallows %s", startURL)
+	}
+	// A Crawl-delay slows the crawl down, never speeds it up
+	if robots.delay > 0 && time.Minute/robots.delay < time.Duration(rpm) {
+		rpm = max(int(time.Minute/robots.delay), 1)
+	}
+	limiter := NewRateLimiter(rpm, concurrency)
+
+	fmt.Printf("🕸️  Crawling %s (depth %d, up to %d pages)...\n", startURL, depth, maxPages)
+
+	queued := map[string]bool{crawlKey(startURL): true}
+	emitted := make(map[string]bool) // canonical keys of pages returned
+	var pages []crawledPage
+	level := []string{startURL.String()}
+
+	for d := 0; d <= depth && len(level) > 0 && len(pages) < maxPages; d++ {
+		level = level[:min(len(level), maxPages-len(pages))]
+		fetched := make([]*fetchedPage, len(level))
+		errs := make([]error, len(level))
+
+		var wg sync.WaitGroup
+		for i, link := range level {
+			wg.Add(1)
+			go func(i int, link string) {
+				defer wg.Done()
+				release, err := limiter.Acquire(ctx)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				defer release()
+				fetched[i], errs[i] = fetchPage(ctx, link, timeout, maxBytes)
+			}(i, link)
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		var next []string
+		for i, page := range fetched {
+			if errs[i] != nil {
+				if d == 0 {
+					return "", errs[i]
+				}
+				fmt.Printf("   ⚠️  %s: %v\n", level[i], errs[i])
+				continue
+			}
+
+			// Redirects may leave the scope the link was checked against
+			final, err := url.Parse(page.URL)
+			if err != nil || !inScope(final) {
+				if d == 0 {
+					return "", fmt.Errorf("%s redirected to %s, outside the crawl scope", level[i], page.URL)
+				}
+				fmt.Printf("   ⚠️  %s: redirected out of scope to %s\n", level[i], page.URL)
+				continue
+			}
+
+			// Pages reached by several URLs are kept once, by canonical URL
+			key := crawlKey(final)
+			if canonical, err := url.Parse(page.Canonical); err == nil && page.Canonical != "" && canonical.Host == final.Host {
+				key = crawlKey(canonical)
+			}
+			if emitted[key] || len(pages) >= maxPages {
+				continue
+			}
+			emitted[key] = true
+			queued[crawlKey(final)] = true
+			pages = append(pages, crawledPage{URL: page.URL, Title: page.Title, Depth: d, Markdown: page.Text})
+			fmt.Printf("   ✓ %s\n", page.URL)
+
+			if d == depth {
+				continue
+			}
+			for _, link := range page.Links {
+				u, err := url.Parse(link)
+				if err != nil || !inScope(u) || skippedExtensions[strings.ToLower(path.Ext(u.Path))] {
+					continue
+				}
+				if k := crawlKey(u); !queued[k] && robots.allowed(u) {
+					queued[k] = true
+					next = append(next, link)
+				}
+			}
+		}
+		level = next
+	}
+
+	sources := make([]Citation, len(pages))
+	for i, page := range pages {
+		sources[i] = Citation{Title: page.Title, URL: page.URL}
+	}
+	r.addSources(ctx, sources)
+
+	fmt.Printf("✅ Crawled %d pages\n", len(pages))
+	return toJSON(pages), nil
+}
+
+// intOption reads an integer option of at least lo
+func intOption(cmd *Command, key string, def, lo int) (int, error) {
+	v, ok := cmd.Option(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < lo {
+		return 0, fmt.Errorf("invalid %s %q (expected a whole number of at least %d)", key, v, lo)
+	}
+	return n, nil
+}
+
+// scopeFilter returns a check for URLs on the start URL's host, or, for
+// scope "prefix", also under its directory
+func scopeFilter(start *url.URL, scope string) func(*url.URL) bool {
+	host := strings.TrimPrefix(strings.ToLower(start.Hostname()), "www.")
+	prefix := start.Path
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = path.Dir(prefix)
+		if !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+	}
+	return func(u *url.URL) bool {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return false
+		}
+		if strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != host {
+			return false
+		}
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		return scope == "domain" || strings.HasPrefix(p, prefix) || p+"/" == prefix
+	}
+}
+
+// trackingParams are query parameters that do not change a page
+var trackingParams = regexp.MustCompile(`^(utm_\w+|fbclid|gclid|mc_cid|mc_eid|ref|ref_src)$`)
+
+// crawlKey normalizes a URL for de-duplication: lower-case host without
+// default port or www, no fragment, no tracking parameters, sorted query
+// and no trailing slash
+func crawlKey(u *url.URL) string {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	query := u.Query()
+	for key := range query {
+		if trackingParams.MatchString(key) {
+			query.Del(key)
+		}
+	}
+	p := strings.TrimSuffix(u.EscapedPath(), "/")
+	p = strings.TrimSuffix(p, "/index.html")
+	key := host + p
+	if len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key
+}
+
+// robotsRules are the robots.txt rules that apply to agentscript
+type robotsRules struct {
+	rules []robotsRule
+	delay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern *regexp.Regexp
+	length  int // pattern length; the longest match wins
+}
+
+// fetchRobots loads the site's robots.txt. A missing or unreadable file
+// allows everything.
+func fetchRobots(ctx context.Context, site *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: site.Scheme, Host: site.Host, Path: "/robots.txt"}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL.String(), nil)
+	if err != nil {
+		return &robotsRules{}
+	}
+	req.Header.Set("User-Agent", fetchUserAgent)
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		fmt.Printf("⚠️  Could not read robots.txt (%v) - crawling without it\n", err)
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512<<10))
+	if err != nil {
+		return &robotsRules{}
+	}
+	return parseRobots(string(body), "agentscript")
+}
+
+// parseRobots reads the groups of a robots.txt that name agent, or the
+// "*" groups when none does
+func parseRobots(text, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+		delay  time.Duration
+	}
+	var groups []*group
+	var current *group
+	inAgents := false
+
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(val))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			if current != nil && val != "" {
+				current.rules = append(current.rules, robotsRule{
+					allow:   key == "allow",
+					pattern: robotsPattern(val),
+					length:  len(val),
+				})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+					current.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+		inAgents = false
+	}
+
+	rules := &robotsRules{}
+	for _, wanted := range []string{strings.ToLower(agent), "*"} {
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == wanted {
+					rules.rules = append(rules.rules, g.rules...)
+					rules.delay = max(rules.delay, g.delay)
+					break
+				}
+			}
+		}
+		if len(rules.rules) > 0 || rules.delay > 0 {
+			break
+		}
+	}
+	return rules
+}
+
+// robotsPattern compiles a robots.txt path pattern, where * matches
+// anything and a trailing $ anchors the end
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	parts := strings.Split(p, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed applies the most specific matching rule; Allow wins ties
+func (rr *robotsRules) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allow, best := true, -1
+	for _, rule := range rr.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			allow, best = rule.allow, rule.length
+		}
+	}
+	return allow
+}
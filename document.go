@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxInlinePDF is the largest PDF that can be sent inline to a model
+const maxInlinePDF = 20 << 20
+
+// pdfTranscribePrompt asks a model to read a PDF the way a person would,
+// layout included
+const pdfTranscribePrompt = `Transcribe this PDF document into Markdown.
+Follow the reading order a person would use, including multi-column layouts.
+Keep headings, lists and tables (as Markdown tables). Describe charts, figures and
+images in one short bracketed sentence each. Output only the Markdown.`
+
+// readFormats are the formats read understands, for format=
+var readFormats = []string{"text", "pdf", "docx", "html", "csv", "tsv", "xlsx", "json", "jsonl"}
+
+// read loads a file as text, or with a glob such as "src/**/*.go" every
+// matching file as a JSON array of {path, content}
+func (r *Runtime) read(ctx context.Context, cmd *Command, path string) (string, error) {
+	if hasGlob(path) {
+		if _, err := os.Stat(path); err != nil {
+			return r.readGlob(ctx, cmd, path)
+		}
+	}
+	return r.readFile(ctx, cmd, path)
+}
+
+// readFile loads one file as text. PDF, DOCX and HTML become Markdown, CSV
+// and XLSX a JSON array of records and JSON is validated; other text files
+// are returned as they are. The format comes from format=, else the
+// extension, else the content.
+func (r *Runtime) readFile(ctx context.Context, cmd *Command, path string) (string, error) {
+	if err := r.checkPath(path, "read"); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	format := detectFormat(path, data)
+	if v, ok := cmd.Option("format"); ok {
+		format = strings.ToLower(v)
+		if !slices.Contains(readFormats, format) {
+			return "", fmt.Errorf("unknown format %q (expected %s)", v, strings.Join(readFormats, ", "))
+		}
+	}
+	r.log("READ: %s as %s", path, format)
+
+	switch format {
+	case "pdf":
+		if cmd.Flag("inline") {
+			return r.readPDFInline(ctx, path, data)
+		}
+		text, err := pdfText(data)
+		if err != nil {
+			return "", fmt.Errorf("failed to read PDF %s: %w (try inline=true)", path, err)
+		}
+		return text, nil
+
+	case "docx":
+		return docxText(data)
+
+	case "html":
+		page, err := toUTF8(data, "text/html")
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		title, text, err := htmlToMarkdown(page, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		if title != "" && !strings.HasPrefix(text, "# ") {
+			text = "# " + title + "\n\n" + text
+		}
+		return text, nil
+
+	case "csv", "tsv":
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		if format == "tsv" {
+			reader.Comma = '\t'
+		} else if v, ok := cmd.Option("delimiter"); ok && v != "" {
+			reader.Comma = []rune(v)[0]
+		}
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return "", fmt.Errorf("invalid CSV in %s: %w", path, err)
+		}
+		return recordsJSON(rows), nil
+
+	case "xlsx":
+		sheet, _ := cmd.Option("sheet")
+		rows, err := xlsxRows(data, sheet)
+		if err != nil {
+			return "", err
+		}
+		if len(rows) > 0 {
+			// Unnamed columns are named by their letter
+			for i, name := range rows[0] {
+				if strings.TrimSpace(name) == "" {
+					rows[0][i] = xlsxColumnName(i)
+				}
+			}
+		}
+		return recordsJSON(rows), nil
+
+	case "json":
+		data = bytes.TrimPrefix(data, utf8BOM)
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return "", fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+		return string(data), nil
+
+	case "jsonl":
+		var records []json.RawMessage
+		for i, line := range strings.Split(string(bytes.TrimPrefix(data, utf8BOM)), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if !json.Valid([]byte(line)) {
+				return "", fmt.Errorf("invalid JSON on line %d of %s", i+1, path)
+			}
+			records = append(records, json.RawMessage(line))
+		}
+		if records == nil {
+			return "[]", nil
+		}
+		return toJSON(records), nil
+	}
+
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1 {
+		return "", fmt.Errorf("%s is a binary file (%s) - read handles text, PDF, DOCX, XLSX, HTML, CSV and JSON",
+			path, http.DetectContentType(data))
+	}
+	return string(data), nil
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// detectFormat names a file's format from its extension, or for unknown
+// extensions from its content
+func detectFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return "pdf"
+	case ".docx":
+		return "docx"
+	case ".html", ".htm", ".xhtml":
+		return "html"
+	case ".csv":
+		return "csv"
+	case ".tsv", ".tab":
+		return "tsv"
+	case ".xlsx", ".xlsm":
+		return "xlsx"
+	case ".json":
+		return "json"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".txt", ".md", ".markdown":
+		return "text"
+	}
+
+	switch {
+	case isPDF(data):
+		return "pdf"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && zipHas(data, "word/document.xml"):
+		return "docx"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) && zipHas(data, "xl/workbook.xml"):
+		return "xlsx"
+	case strings.HasPrefix(http.DetectContentType(data), "text/html"):
+		return "html"
+	}
+	if trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM)); len(trimmed) > 0 &&
+		(trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "json"
+	}
+	return "text"
+}
+
+// readPDFInline sends the PDF itself to the model, Gemini when it is
+// configured, which sees the layout, tables and figures that text
+// extraction loses
+func (r *Runtime) readPDFInline(ctx context.Context, path string, data []byte) (string, error) {
+	if len(data) > maxInlinePDF {
+		return "", fmt.Errorf("%s is too large to send inline (max %d MB)", path, maxInlinePDF>>20)
+	}
+	p, opts, err := r.llmPreferring(ctx, "gemini")
+	if err != nil {
+		return "", fmt.Errorf("inline PDF: %w", err)
+	}
+	fmt.Printf("📄 Sending %s to the model (%d KB)...\n", path, len(data)>>10)
+	text, err := p.GenerateWithFiles(ctx, pdfTranscribePrompt, []string{path}, opts)
+	if err != nil {
+		return "", fmt.Errorf("inline PDF reading failed: %w", err)
+	}
+	return stripMarkdownFence(text), nil
+}
+
+// markdownFence matches a reply wrapped in a ```markdown code block
+var markdownFence = regexp.MustCompile("(?s)^```(?:markdown|md)?[ \t]*\n(.*?)\n?```$")
+
+func stripMarkdownFence(s string) string {
+	s = strings.TrimSpace(s)
+	if m := markdownFence.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return s
+}
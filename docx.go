@@ -0,0 +1,311 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// zipFile returns the contents of a file inside a zip archive
+func zipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if strings.EqualFold(strings.TrimPrefix(f.Name, "/"), name) {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, 256<<20))
+		}
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+// zipHas reports whether a zip archive contains a file
+func zipHas(data []byte, name string) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	_, err = zipFile(zr, name)
+	return err == nil
+}
+
+// zipRelationships reads an OOXML .rels part: relationship id -> target
+func zipRelationships(zr *zip.Reader, name string) map[string]string {
+	rels := make(map[string]string)
+	data, err := zipFile(zr, name)
+	if err != nil {
+		return rels
+	}
+	var parsed struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if xml.Unmarshal(data, &parsed) == nil {
+		for _, rel := range parsed.Relationships {
+			rels[rel.ID] = rel.Target
+		}
+	}
+	return rels
+}
+
+// docxText converts a Word document to Markdown: headings, list items,
+// links and tables are kept, formatting and tracked deletions are not
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("not a DOCX file: %w", err)
+	}
+	document, err := zipFile(zr, "word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("not a DOCX file: %w", err)
+	}
+
+	w := &docxWriter{
+		headings: docxHeadingStyles(zr),
+		links:    zipRelationships(zr, "word/_rels/document.xml.rels"),
+	}
+	if err := w.parse(document); err != nil {
+		return "", fmt.Errorf("failed to parse DOCX: %w", err)
+	}
+	text := strings.TrimSpace(w.out.String())
+	if text == "" {
+		return "", fmt.Errorf("no text found in DOCX")
+	}
+	return text, nil
+}
+
+var headingStyleName = regexp.MustCompile(`(?i)^heading\s*([1-6])$`)
+
+// docxHeadingStyles maps paragraph style ids to heading levels. Ids are
+// localized ("Heading1", "berschrift1"), so the style names are used.
+func docxHeadingStyles(zr *zip.Reader) map[string]int {
+	levels := map[string]int{"Title": 1}
+	for i := 1; i <= 6; i++ {
+		levels["Heading"+strconv.Itoa(i)] = i
+	}
+	data, err := zipFile(zr, "word/styles.xml")
+	if err != nil {
+		return levels
+	}
+	var styles struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	if xml.Unmarshal(data, &styles) != nil {
+		return levels
+	}
+	for _, s := range styles.Styles {
+		if m := headingStyleName.FindStringSubmatch(s.Name.Val); m != nil {
+			levels[s.ID], _ = strconv.Atoi(m[1])
+		} else if strings.EqualFold(s.Name.Val, "title") {
+			levels[s.ID] = 1
+		}
+	}
+	return levels
+}
+
+// docxWriter renders the body of word/document.xml
+type docxWriter struct {
+	headings map[string]int
+	links    map[string]string
+	out      strings.Builder
+
+	para  strings.Builder // text of the current paragraph
+	level int             // heading level, 0 for body text
+	list  int             // list level + 1, 0 outside lists
+	tabs  bool            // inside tab stop definitions
+	href  string
+	link  strings.Builder
+
+	table [][]string // rows of the innermost open table
+	depth int        // table nesting
+	cell  []string   // paragraphs of the current cell
+	last  string     // kind of the last block written: "list" or "block"
+}
+
+func (w *docxWriter) parse(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				w.para.Reset()
+				w.level, w.list = 0, 0
+			case "pStyle":
+				w.level = w.headings[xmlAttr(t, "val")]
+			case "ilvl":
+				n, _ := strconv.Atoi(xmlAttr(t, "val"))
+				w.list = n + 1
+			case "numPr":
+				w.list = max(w.list, 1)
+			case "outlineLvl":
+				if n, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && n < 6 && w.level == 0 {
+					w.level = n + 1
+				}
+			case "hyperlink":
+				w.href = w.links[xmlAttr(t, "id")]
+				w.link.Reset()
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return err
+				}
+				w.write(text)
+			case "tabs":
+				w.tabs = true
+			case "tab":
+				if !w.tabs {
+					w.write("\t")
+				}
+			case "br", "cr":
+				w.write("\n")
+			case "tbl":
+				w.depth++
+				if w.depth == 1 {
+					w.table = nil
+				}
+			case "tr":
+				if w.depth == 1 {
+					w.table = append(w.table, nil)
+				}
+			case "tc":
+				if w.depth == 1 {
+					w.cell = nil
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "tabs":
+				w.tabs = false
+			case "hyperlink":
+				text := w.link.String()
+				if w.href != "" && strings.TrimSpace(text) != "" {
+					text = "[" + text + "](" + w.href + ")"
+				}
+				w.href = ""
+				w.para.WriteString(text)
+			case "p":
+				w.endParagraph()
+			case "tc":
+				if w.depth == 1 && len(w.table) > 0 {
+					row := &w.table[len(w.table)-1]
+					*row = append(*row, strings.Join(w.cell, " "))
+				}
+			case "tbl":
+				w.depth--
+				if w.depth == 0 {
+					w.block(markdownTable(w.table), "block")
+				}
+			}
+		}
+	}
+}
+
+// write adds run text to the open link or paragraph
+func (w *docxWriter) write(text string) {
+	if w.href != "" {
+		w.link.WriteString(text)
+	} else {
+		w.para.WriteString(text)
+	}
+}
+
+func (w *docxWriter) endParagraph() {
+	text := strings.TrimSpace(w.para.String())
+	w.para.Reset()
+	if text == "" {
+		return
+	}
+	if w.depth > 0 {
+		w.cell = append(w.cell, strings.Join(strings.Fields(text), " "))
+		return
+	}
+	if w.level > 0 {
+		w.block(strings.Repeat("#", w.level)+" "+strings.Join(strings.Fields(text), " "), "block")
+		return
+	}
+	if w.list > 0 {
+		w.block(strings.Repeat("  ", w.list-1)+"- "+text, "list")
+		return
+	}
+	w.block(text, "block")
+}
+
+// block writes a paragraph, keeping consecutive list items together
+func (w *docxWriter) block(text, kind string) {
+	if text == "" {
+		return
+	}
+	if w.out.Len() > 0 {
+		if kind == "list" && w.last == "list" {
+			w.out.WriteString("\n")
+		} else {
+			w.out.WriteString("\n\n")
+		}
+	}
+	w.out.WriteString(text)
+	w.last = kind
+}
+
+// markdownTable renders rows as a Markdown table, the first row as header
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(cells) {
+				cell = strings.ReplaceAll(cells[i], "|", "\\|")
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+	line(rows[0])
+	b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows[1:] {
+		line(row)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// xmlAttr returns an attribute by local name, ignoring its namespace
+func xmlAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
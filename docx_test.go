@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDOCXText(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "notes.docx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := docxText(data)
+	if err != nil {
+		t.Fatalf("docxText: %v", err)
+	}
+	want := `# Trip notes
+
+# Overview
+
+We visited [Lisbon](https://example.com/lisbon) in spring.
+
+## Packing
+
+- Passport
+- Charger
+  - USB cable
+
+| Day | Plan |
+| --- | --- |
+| 1 | Old town \| trams |
+
+Line one
+Line two`
+	if got != want {
+		t.Errorf("docxText =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDOCXTextMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not a zip", []byte("plain text"), "not a DOCX file"},
+		{"no document", zipArchive(t, map[string]string{"word/styles.xml": "<w:styles/>"}), "not a DOCX file"},
+		{"empty body", zipArchive(t, map[string]string{"word/document.xml": "<w:document><w:body/></w:document>"}), "no text found"},
+		{"bad XML", zipArchive(t, map[string]string{"word/document.xml": "<w:document><w:body><w:p>"}), "failed to parse DOCX"},
+	}
+	for _, tt := range tests {
+		if _, err := docxText(tt.data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
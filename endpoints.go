@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Default API base URLs
+const (
+	defaultGitHubAPIURL    = "https://api.github.com"
+	defaultGitHubServerURL = "https://github.com"
+	defaultSearchBaseURL   = "https://serpapi.com"
+)
+
+// googleServices lists the Google APIs whose endpoint can be overridden
+// with GOOGLE_<SERVICE>_ENDPOINT
+var googleServices = []string{"gmail", "calendar", "drive", "docs", "sheets", "tasks", "people", "youtube", "forms"}
+
+// Endpoints holds the base URL of every external API the runtime talks
+// to. Overriding them lets a script run against a proxy, a regional
+// endpoint, GitHub Enterprise or a local mock server.
+type Endpoints struct {
+	Gemini       string
+	Claude       string
+	Ollama       string
+	OpenAI       string
+	GitHubAPI    string
+	GitHubServer string
+	Search       string
+	Google       map[string]string // service name -> endpoint, empty means default
+}
+
+// DefaultEndpoints returns the public endpoints of every service
+func DefaultEndpoints() Endpoints {
+	return Endpoints{
+		Gemini:       defaultGeminiBaseURL,
+		Claude:       defaultClaudeBaseURL,
+		Ollama:       defaultOllamaBaseURL,
+		OpenAI:       defaultOpenAIBaseURL,
+		GitHubAPI:    defaultGitHubAPIURL,
+		GitHubServer: defaultGitHubServerURL,
+		Search:       defaultSearchBaseURL,
+		Google:       map[string]string{},
+	}
+}
+
+// EndpointsFromEnv returns the default endpoints with any overrides from
+// GEMINI_BASE_URL, CLAUDE_BASE_URL, OLLAMA_BASE_URL, OPENAI_BASE_URL,
+// GITHUB_API_URL, GITHUB_SERVER_URL, SEARCH_BASE_URL and
+// GOOGLE_<SERVICE>_ENDPOINT applied
+func EndpointsFromEnv() Endpoints {
+	e := DefaultEndpoints()
+	override := func(dst *string, env string) {
+		if v := os.Getenv(env); v != "" {
+			*dst = strings.TrimRight(v, "/")
+		}
+	}
+
+	override(&e.Gemini, "GEMINI_BASE_URL")
+	override(&e.Claude, "CLAUDE_BASE_URL")
+	override(&e.Ollama, "OLLAMA_BASE_URL")
+	override(&e.OpenAI, "OPENAI_BASE_URL")
+	override(&e.GitHubAPI, "GITHUB_API_URL")
+	override(&e.GitHubServer, "GITHUB_SERVER_URL")
+	override(&e.Search, "SEARCH_BASE_URL")
+
+	for _, svc := range googleServices {
+		if v := os.Getenv("GOOGLE_" + strings.ToUpper(svc) + "_ENDPOINT"); v != "" {
+			e.Google[svc] = v
+		}
+	}
+	return e
+}
+
+// withDefaults fills any empty field with the public endpoint
+func (e Endpoints) withDefaults() Endpoints {
+	d := DefaultEndpoints()
+	if e.Gemini == "" {
+		e.Gemini = d.Gemini
+	}
+	if e.Claude == "" {
+		e.Claude = d.Claude
+	}
+	if e.Ollama == "" {
+		e.Ollama = d.Ollama
+	}
+	if e.OpenAI == "" {
+		e.OpenAI = d.OpenAI
+	}
+	if e.GitHubAPI == "" {
+		e.GitHubAPI = d.GitHubAPI
+	}
+	if e.GitHubServer == "" {
+		e.GitHubServer = d.GitHubServer
+	}
+	if e.Search == "" {
+		e.Search = d.Search
+	}
+	if e.Google == nil {
+		e.Google = d.Google
+	}
+	return e
+}
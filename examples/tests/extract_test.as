@@ -0,0 +1 @@
+search "coffee chains in Seattle" -> extract "name, founded:integer, tier:budget|premium" -> assert_json "[0].tier == budget"
@@ -0,0 +1,5 @@
+// Replays fetch_test.cassette.json, so it runs without network access.
+// Re-record with: agentscript -update test examples/tests/fetch_test.as
+fetch "http://localhost:8791/menu.html"
+  -> assert_contains "Corner Café"
+  -> assert_regex "Flat white.*4[.]50"
@@ -0,0 +1,3 @@
+// Glob reads and recursive listing
+read "*_test.as" -> jq "[.[].path]" -> assert_contains "files_test.as"
+list ".." recursive=true match="*_test.as" format="json" -> jq "[.[] | select(.type == \"file\")] | length" -> assert_regex "^[5-9]$"
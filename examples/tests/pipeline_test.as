@@ -0,0 +1,4 @@
+ask "List three benefits of Go"
+  -> assert_contains "Go"
+  -> assert_regex "[0-9]+"
+  -> assert_rubric "The answer talks about Go"
@@ -0,0 +1 @@
+places_search "cafes in Lisbon" -> maps_trip "Lisbon" -> assert_contains "google.com/maps"
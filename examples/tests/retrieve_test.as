@@ -0,0 +1,5 @@
+// Offline retrieval over the example scripts: the fake provider's
+// embeddings match on shared words
+index ".." name="examples" -> retrieve "youtube shorts video" index="examples" k=3
+  -> assert_json "[0].lines"
+  -> jq ".[0].file" -> assert_regex "^\\.\\./[a-z-]*shorts\\.as$"
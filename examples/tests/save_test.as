@@ -0,0 +1,7 @@
+// Saved data files stay machine-readable; prose files get references
+search "coffee chains in Seattle" -> extract "name, tier:budget|premium" -> save ".agentscript/out/chains.json"
+read ".agentscript/out/chains.json" -> assert_json "[0].tier == budget"
+search "coffee chains in Seattle" -> extract "name, tier:budget|premium" -> json_to_csv -> save ".agentscript/out/chains.csv"
+read ".agentscript/out/chains.csv" -> assert_json "[0].tier == budget"
+search "coffee chains in Seattle" -> summarize -> save ".agentscript/out/chains.md"
+read ".agentscript/out/chains.md" -> assert_contains "## References"
@@ -0,0 +1,3 @@
+// Model-free transforms over extracted records
+search "coffee chains" -> extract "name, tier:budget|premium" -> jq ".[] | select(.tier == \"budget\") | .tier" -> assert_contains "budget"
+search "coffee chains" -> extract "name, tier:budget|premium" -> json_to_csv -> head "1" -> assert_regex "^name,tier$"
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// extract pulls structured records out of its input. spec is a JSON
+// schema, the path of a file holding one, or a compact field list:
+//
+//	extract "name, price:number, founded:date, tags:[]string, ceo?"
+//
+// A field list describes an array of records; fields are strings unless
+// typed, required unless marked with ?, and a|b|c declares an enum.
+func (r *Runtime) extract(ctx context.Context, spec, input string) (string, error) {
+	if strings.TrimSpace(input) == "" {
+		return "", fmt.Errorf("extract needs input to extract from")
+	}
+	if _, err := os.Stat(strings.TrimSpace(spec)); err == nil {
+		if err := r.checkPath(strings.TrimSpace(spec), "read"); err != nil {
+			return "", err
+		}
+	}
+	schema, err := parseExtractSchema(spec)
+	if err != nil {
+		return "", err
+	}
+	if !r.hasLLM(ctx) {
+		return "", fmt.Errorf("extract requires a model - set GEMINI_API_KEY or pick a provider")
+	}
+
+	prompt := fmt.Sprintf(`Extract structured data from the content below.
+Use only information stated in the content. Leave optional fields out when the content does not give them, and never invent values.
+
+Content:
+%s`, input)
+
+	reply, err := r.generateSchemaJSON(ctx, prompt, schema)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(reply), "", "  "); err != nil {
+		return "", fmt.Errorf("failed to format JSON: %w", err)
+	}
+	if schema["type"] == "array" {
+		var records []any
+		json.Unmarshal(out.Bytes(), &records)
+		fmt.Printf("🧾 Extracted %d record(s)\n", len(records))
+	}
+	return out.String(), nil
+}
+
+// parseExtractSchema reads an inline schema, a schema file or a field list
+func parseExtractSchema(spec string) (map[string]any, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("extract needs a schema or field list, e.g. extract \"name, price:number\"")
+	}
+
+	data := []byte(spec)
+	if !strings.HasPrefix(spec, "{") {
+		if _, err := os.Stat(spec); err == nil {
+			if data, err = os.ReadFile(spec); err != nil {
+				return nil, fmt.Errorf("failed to read schema %s: %w", spec, err)
+			}
+		} else if strings.HasSuffix(spec, ".json") {
+			return nil, fmt.Errorf("schema file %s not found", spec)
+		} else {
+			fields, err := fieldListSchema(spec)
+			if err != nil {
+				return nil, err
+			}
+			// Round-trip so the schema has the types a decoded one would
+			data, _ = json.Marshal(fields)
+		}
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	if _, ok := schema["type"].(string); !ok {
+		return nil, fmt.Errorf("JSON schema needs a top-level \"type\"")
+	}
+	return schema, nil
+}
+
+// fieldListSchema builds an array-of-records schema from a compact field list
+func fieldListSchema(spec string) (map[string]any, error) {
+	props := map[string]any{}
+	required := []string{}
+	for _, field := range strings.Split(spec, ",") {
+		name, typ, _ := strings.Cut(strings.TrimSpace(field), ":")
+		name, typ = strings.TrimSpace(name), strings.TrimSpace(typ)
+		optional := strings.HasSuffix(name, "?")
+		name = strings.TrimSuffix(name, "?")
+		if name == "" {
+			return nil, fmt.Errorf("empty field name in %q", spec)
+		}
+
+		prop, err := fieldSchema(typ)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		props[name] = prop
+		if !optional {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		},
+	}, nil
+}
+
+// fieldSchema converts a field list type such as number, []string or
+// low|high to a JSON schema
+func fieldSchema(typ string) (map[string]any, error) {
+	if strings.HasPrefix(typ, "[]") {
+		items, err := fieldSchema(strings.TrimPrefix(typ, "[]"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	}
+	if strings.Contains(typ, "|") {
+		var values []string
+		for _, v := range strings.Split(typ, "|") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return map[string]any{"type": "string", "enum": values}, nil
+	}
+
+	switch typ {
+	case "", "string", "text":
+		return map[string]any{"type": "string"}, nil
+	case "number", "float":
+		return map[string]any{"type": "number"}, nil
+	case "integer", "int":
+		return map[string]any{"type": "integer"}, nil
+	case "boolean", "bool":
+		return map[string]any{"type": "boolean"}, nil
+	case "date":
+		return map[string]any{"type": "string", "format": "date"}, nil
+	case "datetime", "date-time":
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q (use string, number, integer, boolean, date, datetime, []type or a|b|c)", typ)
+}
+
+// sheetRows converts a JSON array of records (or a single record) into
+// tab-separated rows for Google Sheets, with a header row of field names
+// when header is set. Anything else is returned unchanged.
+func sheetRows(content string, header bool) string {
+	trimmed := stripCodeFence(content)
+	var records []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+		if !strings.HasPrefix(trimmed, "{") {
+			return content
+		}
+		records = []json.RawMessage{json.RawMessage(trimmed)}
+	}
+
+	// Columns in the order fields first appear
+	var columns []string
+	seen := map[string]bool{}
+	var rows []map[string]any
+	for _, raw := range records {
+		var row map[string]any
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return content
+		}
+		for _, key := range objectKeys(raw) {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	var lines []string
+	if header {
+		lines = append(lines, strings.Join(columns, "\t"))
+	}
+	for _, row := range rows {
+		var cells []string
+		for _, col := range columns {
+			cells = append(cells, cellText(row[col]))
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// objectKeys returns a JSON object's keys in document order
+func objectKeys(raw json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// cellText renders a JSON value as a single spreadsheet cell
+func cellText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.NewReplacer("\t", " ", "\n", " ").Replace(v)
+	case []any:
+		var parts []string
+		for _, item := range v {
+			parts = append(parts, cellText(item))
+		}
+		return strings.Join(parts, ", ")
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// fakeFilePrefix marks the file URIs returned by the fake video commands
+const fakeFilePrefix = "fake://files/"
+
+// FakeClient is an offline stand-in for GeminiClient, selected with
+// -provider fake. Text commands return deterministic output derived from
+// the prompt, and media commands write small placeholder files, so whole
+// pipelines (including save and the ffmpeg merges) can be developed and
+// demoed without network access or quota.
+type FakeClient struct {
+	model string
+}
+
+// NewFakeClient creates a fake provider
+func NewFakeClient(model string) *FakeClient {
+	if model == "" {
+		model = "fake"
+	}
+	return &FakeClient{model: model}
+}
+
+// Name implements Provider
+func (f *FakeClient) Name() string { return "fake" }
+
+// Generate returns a templated response for the prompt
+func (f *FakeClient) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return fakeText(prompt, opts.Format), nil
+}
+
+// Stream implements Provider
+func (f *FakeClient) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	return streamOnce(ctx, f, prompt, opts, onChunk)
+}
+
+// GenerateWithFiles describes the files without looking at their contents
+func (f *FakeClient) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	var analyses []string
+	for _, path := range files {
+		analysis, err := fakeAnalysis(path, prompt)
+		if err != nil {
+			return "", err
+		}
+		analyses = append(analyses, analysis)
+	}
+	return strings.Join(analyses, "\n"), nil
+}
+
+// GenerateStructured returns JSON shaped like the schema
+func (f *FakeClient) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	data, err := json.Marshal(fakeFromSchema(schema, "", digest(prompt)))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GenerateImage returns a placeholder PNG whose colour is derived from the prompt
+func (f *FakeClient) GenerateImage(ctx context.Context, prompt string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(prompt))
+	bg := color.RGBA{sum[0], sum[1], sum[2], 255}
+	fg := color.RGBA{255 - sum[0], 255 - sum[1], 255 - sum[2], 255}
+
+	const size = 512
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// A border and diagonal stripes make the placeholder obvious
+			if x < 8 || y < 8 || x >= size-8 || y >= size-8 || (x+y)%64 < 4 {
+				img.Set(x, y, fg)
+			} else {
+				img.Set(x, y, bg)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode placeholder image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GenerateVideo returns a fake file URI; saving it writes an MP4 stub
+func (f *FakeClient) GenerateVideo(ctx context.Context, prompt string, vertical bool) (string, error) {
+	width, height := 320, 180
+	if vertical {
+		width, height = 180, 320
+	}
+	return fmt.Sprintf("%svideo-%s-%dx%d", fakeFilePrefix, digest(prompt), width, height), nil
+}
+
+// GenerateVideoFromImages checks the images exist and returns a fake file URI
+func (f *FakeClient) GenerateVideoFromImages(ctx context.Context, imagePaths []string, prompt string) (string, error) {
+	for _, path := range imagePaths {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("failed to read image %s: %w", path, err)
+		}
+	}
+	return f.GenerateVideo(ctx, prompt+strings.Join(imagePaths, ","), false)
+}
+
+// IsFileURI reports whether s was returned by one of the fake video commands
+func (f *FakeClient) IsFileURI(s string) bool {
+	return strings.HasPrefix(s, fakeFilePrefix)
+}
+
+// DownloadFile writes an 8 second MP4 stub for a fake file URI
+func (f *FakeClient) DownloadFile(ctx context.Context, fileURI string, outputPath string) (string, error) {
+	if !f.IsFileURI(fileURI) {
+		return "", fmt.Errorf("not a fake file URI: %s", fileURI)
+	}
+
+	width, height := 320, 180
+	if i := strings.LastIndex(fileURI, "-"); i != -1 {
+		if w, h, ok := strings.Cut(fileURI[i+1:], "x"); ok {
+			width, _ = strconv.Atoi(w)
+			height, _ = strconv.Atoi(h)
+		}
+	}
+
+	data, err := fakeMP4(width, height, 8)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return outputPath, nil
+}
+
+// TextToSpeech writes a silent WAV roughly as long as the text would take to read
+func (f *FakeClient) TextToSpeech(ctx context.Context, text string, voice string) (string, error) {
+	const sampleRate = 24000
+
+	// About 150 words per minute, between 1 and 60 seconds
+	seconds := len(strings.Fields(text)) * 2 / 5
+	if seconds < 1 {
+		seconds = 1
+	}
+	if seconds > 60 {
+		seconds = 60
+	}
+
+	outputPath := fmt.Sprintf("tts_output_%d.wav", time.Now().UnixNano())
+	pcm := make([]byte, sampleRate*2*seconds) // s16le mono silence
+	if err := writePCMToWav(outputPath, pcm, sampleRate, 1, 16); err != nil {
+		return "", fmt.Errorf("failed to write WAV file: %w", err)
+	}
+	return outputPath, nil
+}
+
+// fakeEmbeddingDims is the size of the fake provider's vectors
+const fakeEmbeddingDims = 256
+
+// Embed hashes each word of the text into a fixed-size vector, so texts
+// sharing words score as similar and retrieval can be tested offline
+func (f *FakeClient) Embed(ctx context.Context, texts []string, model string, query bool) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, fakeEmbeddingDims)
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			sum := sha256.Sum256([]byte(word))
+			v[binary.BigEndian.Uint32(sum[:4])%fakeEmbeddingDims]++
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// digest returns a short, stable fingerprint of s
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// fakeText returns a deterministic reply in the format the caller asked
+// for (see GenOptions.Format); anything else gets a placeholder that
+// echoes the prompt's first line. JSON replies come from
+// GenerateStructured, which follows the caller's schema.
+func fakeText(prompt, format string) string {
+	id := digest(prompt)
+
+	switch format {
+	case "agentscript":
+		// The request comes last in a translation prompt
+		lines := strings.Split(strings.TrimSpace(prompt), "\n")
+		return fmt.Sprintf("ask %s", strconv.Quote(strings.TrimSpace(lines[len(lines)-1])))
+	case "html":
+		return fmt.Sprintf("<!DOCTYPE html>\n<html><head><title>Fake page %s</title></head><body><h1>Fake page %s</h1></body></html>", id, id)
+	}
+
+	firstLine := strings.TrimSpace(strings.SplitN(strings.TrimSpace(prompt), "\n", 2)[0])
+	if len(firstLine) > 120 {
+		firstLine = firstLine[:120] + "..."
+	}
+	return fmt.Sprintf("[fake %s] %s\n\nThis is a deterministic placeholder response (%d words of prompt).",
+		id, firstLine, len(strings.Fields(prompt)))
+}
+
+// fakeAnalysis describes a media file using only its name and size
+func fakeAnalysis(path, prompt string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return fmt.Sprintf("[fake %s] Analysis of %s (%s, %d bytes). Focus: %s",
+		digest(prompt+path), path, getMimeType(path), info.Size(), firstLine(prompt)), nil
+}
+
+// fakeFromSchema builds a value that satisfies a JSON schema
+func fakeFromSchema(schema map[string]any, name, id string) any {
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj := map[string]any{}
+		props, _ := schema["properties"].(map[string]any)
+		for key, prop := range props {
+			if propSchema, ok := prop.(map[string]any); ok {
+				obj[key] = fakeFromSchema(propSchema, key, id)
+			}
+		}
+		return obj
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		return []any{fakeFromSchema(items, name, id)}
+	case "integer", "number":
+		return 1
+	case "boolean":
+		return true
+	}
+
+	if schema["format"] == "date" {
+		return time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	}
+	if schema["format"] == "date-time" {
+		now := time.Now()
+		start := time.Date(now.Year(), now.Month(), now.Day()+1, 10, 0, 0, 0, now.Location())
+		if name == "end" {
+			start = start.Add(time.Hour)
+		}
+		return start.Format(time.RFC3339)
+	}
+	if name == "" {
+		name = "value"
+	}
+	return fmt.Sprintf("fake %s %s", name, id)
+}
+
+// fakeMP4 builds a minimal MP4 with a single Motion-JPEG video track
+// showing one grey frame for the given number of seconds
+func fakeMP4(width, height, seconds int) ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 128
+	}
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, img, nil); err != nil {
+		return nil, fmt.Errorf("failed to encode video frame: %w", err)
+	}
+
+	const timescale = 1000
+	duration := uint32(seconds * timescale)
+	matrix := be32(0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000)
+
+	ftyp := mp4Box("ftyp", []byte("isom"), be32(512), []byte("isomiso2mp41"))
+	mdat := mp4Box("mdat", frame.Bytes())
+	chunkOffset := uint32(len(ftyp) + 8)
+
+	compressor := make([]byte, 32)
+	compressor[0] = byte(copy(compressor[1:], "Photo - JPEG"))
+
+	sampleEntry := mp4Box("jpeg",
+		make([]byte, 6), be16(1), // reserved, data reference index
+		make([]byte, 16), // pre-defined and reserved
+		be16(uint16(width), uint16(height)),
+		be32(0x00480000, 0x00480000, 0), // 72 dpi, reserved
+		be16(1), compressor, be16(0x0018, 0xFFFF))
+
+	stbl := mp4Box("stbl",
+		mp4Box("stsd", be32(0, 1), sampleEntry),
+		mp4Box("stts", be32(0, 1, 1, duration)),
+		mp4Box("stsc", be32(0, 1, 1, 1, 1)),
+		mp4Box("stsz", be32(0, 0, 1, uint32(frame.Len()))),
+		mp4Box("stco", be32(0, 1, chunkOffset)))
+
+	minf := mp4Box("minf",
+		mp4Box("vmhd", be32(1), make([]byte, 8)),
+		mp4Box("dinf", mp4Box("dref", be32(0, 1), mp4Box("url ", be32(1)))),
+		stbl)
+
+	mdia := mp4Box("mdia",
+		mp4Box("mdhd", be32(0, 0, 0, timescale, duration), be16(0x55C4, 0)), // language "und"
+		mp4Box("hdlr", be32(0, 0), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00")),
+		minf)
+
+	trak := mp4Box("trak",
+		mp4Box("tkhd", be32(3, 0, 0, 1, 0, duration, 0, 0), be16(0, 0, 0, 0), matrix,
+			be32(uint32(width)<<16, uint32(height)<<16)),
+		mdia)
+
+	moov := mp4Box("moov",
+		mp4Box("mvhd", be32(0, 0, 0, timescale, duration, 0x00010000), be16(0x0100), make([]byte, 10),
+			matrix, make([]byte, 24), be32(2)),
+		trak)
+
+	out := append(ftyp, mdat...)
+	return append(out, moov...), nil
+}
+
+// mp4Box encodes an ISO base media file format box
+func mp4Box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := make([]byte, 0, size)
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func be32(values ...uint32) []byte {
+	b := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func be16(values ...uint16) []byte {
+	b := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Capabilities that have their own fallback chain
+const (
+	capText   = "text"
+	capVision = "vision"
+	capImage  = "image"
+	capVideo  = "video"
+	capTTS    = "tts"
+)
+
+var capabilities = []string{capText, capVision, capImage, capVideo, capTTS}
+
+// degradeToImage is the video chain entry that replaces a generated video
+// with a generated image narrated by text-to-speech
+const degradeToImage = "image"
+
+// APIError is an error response from a model API
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error: status %d - %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the error is a quota, rate limit or server
+// error that another provider might not have
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == 408 || e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+// UnavailableError means a provider cannot be used at all: it is not
+// configured or cannot be reached
+type UnavailableError struct {
+	Provider string
+	Reason   string
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Reason
+}
+
+// shouldFallback reports whether a failed call should move on to the next
+// provider in its chain. Bad requests and cancellations fail immediately.
+func shouldFallback(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// FallbacksFromEnv reads the chains set with AGENTSCRIPT_FALLBACK_<CAPABILITY>,
+// e.g. AGENTSCRIPT_FALLBACK_TEXT=gemini,claude,ollama
+func FallbacksFromEnv() map[string][]string {
+	chains := make(map[string][]string)
+	for _, capability := range capabilities {
+		v := os.Getenv("AGENTSCRIPT_FALLBACK_" + strings.ToUpper(capability))
+		if v == "" {
+			continue
+		}
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				chains[capability] = append(chains[capability], name)
+			}
+		}
+	}
+	return chains
+}
+
+// defaultFallbacks tries every other configured cloud provider for text
+// and vision. Media generation only has Gemini unless configured.
+func defaultFallbacks(providers map[string]Provider) map[string][]string {
+	var llms []string
+	for _, name := range []string{"gemini", "claude", "openai"} {
+		if _, ok := providers[name]; ok {
+			llms = append(llms, name)
+		}
+	}
+	return map[string][]string{
+		capText:   llms,
+		capVision: llms,
+		capImage:  {"gemini"},
+		capVideo:  {"gemini"},
+		capTTS:    {"gemini"},
+	}
+}
+
+// validFallback reports whether name can appear in a capability's chain
+func validFallback(capability, name string) bool {
+	switch capability {
+	case capText, capVision:
+		return knownProviders[name]
+	case capImage, capTTS:
+		return name == "gemini" || name == "fake"
+	case capVideo:
+		return name == "gemini" || name == "fake" || name == degradeToImage
+	}
+	return false
+}
+
+// chain returns the providers to try for a capability, starting with first
+// when given
+func (r *Runtime) chain(capability, first string) []string {
+	var names []string
+	if first != "" {
+		names = append(names, first)
+	}
+	for _, name := range r.fallbacks[capability] {
+		if name != first {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"gemini"}
+	}
+	return names
+}
+
+// tryChain calls fn with each name in turn until one succeeds or fails
+// with an error that another provider would not fix. Every fallback is
+// printed and recorded for the run.
+func tryChain[T any](ctx context.Context, r *Runtime, capability string, names []string, fn func(name string) (T, error)) (T, error) {
+	var result T
+	var err error
+	for i, name := range names {
+		result, err = fn(name)
+		if err == nil || !shouldFallback(err) || i == len(names)-1 {
+			return result, err
+		}
+		r.recordFallback(ctx, capability, name, names[i+1], err)
+	}
+	return result, err
+}
+
+// recordFallback prints a fallback and keeps it for the run summary and
+// the checkpoint manifest
+func (r *Runtime) recordFallback(ctx context.Context, capability, from, to string, err error) {
+	step := ""
+	if cmd := stepFrom(ctx); cmd != nil {
+		step = cmd.Action
+	}
+	note := fmt.Sprintf("%s: %s %s failed (%s), used %s", step, from, capability, firstLine(err.Error()), to)
+	fmt.Printf("↪️  %s %s failed: %s\n   Falling back to %s\n", from, capability, firstLine(err.Error()), to)
+
+	r.mu.Lock()
+	r.fallbackLog = append(r.fallbackLog, note)
+	r.mu.Unlock()
+	if r.checkpoint != nil {
+		r.checkpoint.NoteFallback(note)
+	}
+}
+
+// chainProvider is a Provider that falls back along the text chain, and
+// along the vision chain for calls with files
+type chainProvider struct {
+	r      *Runtime
+	text   []string
+	vision []string
+}
+
+func (c *chainProvider) Name() string { return c.text[0] }
+
+func (c *chainProvider) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return tryChain(ctx, c.r, capText, c.text, func(name string) (string, error) {
+		p, err := c.r.provider(name)
+		if err != nil {
+			return "", err
+		}
+		return p.Generate(ctx, prompt, c.optsFor(name, opts))
+	})
+}
+
+// Stream only falls back while nothing has been printed yet
+func (c *chainProvider) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	streamed := false
+	return tryChain(ctx, c.r, capText, c.text, func(name string) (string, error) {
+		p, err := c.r.provider(name)
+		if err != nil {
+			return "", err
+		}
+		text, err := p.Stream(ctx, prompt, c.optsFor(name, opts), func(chunk string) {
+			streamed = true
+			onChunk(chunk)
+		})
+		if err != nil && streamed {
+			return text, fmt.Errorf("stream interrupted: %s", err.Error())
+		}
+		return text, err
+	})
+}
+
+func (c *chainProvider) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	return tryChain(ctx, c.r, capVision, c.vision, func(name string) (string, error) {
+		p, err := c.r.provider(name)
+		if err != nil {
+			return "", err
+		}
+		return p.GenerateWithFiles(ctx, prompt, files, c.optsFor(name, opts))
+	})
+}
+
+func (c *chainProvider) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	return tryChain(ctx, c.r, capText, c.text, func(name string) (string, error) {
+		p, err := c.r.provider(name)
+		if err != nil {
+			return "", err
+		}
+		return p.GenerateStructured(ctx, prompt, schema, c.optsFor(name, opts))
+	})
+}
+
+// optsFor drops a step's model= when falling back, since model names are
+// specific to the provider the step was written for
+func (c *chainProvider) optsFor(name string, opts GenOptions) GenOptions {
+	if name != c.text[0] {
+		opts.Model = ""
+	}
+	return opts
+}
+
+// media resolves a media generation backend by name
+func (r *Runtime) media(name string) (MediaClient, error) {
+	switch name {
+	case "gemini":
+		if r.gemini == nil {
+			return nil, &UnavailableError{"gemini", "GEMINI_API_KEY required for media generation"}
+		}
+		return r.gemini, nil
+	case "fake":
+		return NewFakeClient(""), nil
+	}
+	return nil, fmt.Errorf("unknown media provider %q (expected gemini or fake)", name)
+}
+
+// quotedDialogue matches the spoken lines in a video_script prompt
+var quotedDialogue = regexp.MustCompile(`"([^"]+)"`)
+
+// degradeVideo stands in for a generated video with a generated image and
+// narration merged by ffmpeg. Quoted dialogue in the prompt (as written by
+// video_script) is narrated; otherwise the prompt itself is.
+func (r *Runtime) degradeVideo(ctx context.Context, prompt string) (string, error) {
+	fmt.Println("🖼️  Building a narrated still image instead of a video...")
+
+	image, err := r.imageGenerate(ctx, prompt, "")
+	if err != nil {
+		return "", err
+	}
+	imagePath := strings.TrimPrefix(image, "IMAGEFILE:")
+	defer os.Remove(imagePath)
+
+	narration := prompt
+	if matches := quotedDialogue.FindAllStringSubmatch(prompt, -1); len(matches) > 0 {
+		var lines []string
+		for _, m := range matches {
+			lines = append(lines, m[1])
+		}
+		narration = strings.Join(lines, " ")
+	}
+	audioPath, err := r.textToSpeech(ctx, "", narration)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(audioPath)
+
+	return r.mergeImageAudio(ctx, fmt.Sprintf(".temp_video_%d.mp4", time.Now().UnixNano()), imagePath, audioPath)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeminiErrorsFallBack(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		fallback    bool
+	}{
+		{"HTML 502 from a proxy", http.StatusBadGateway, "text/html", "<html><body>502 Bad Gateway</body></html>", true},
+		{"plain 504", http.StatusGatewayTimeout, "text/plain", "upstream request timeout", true},
+		{"JSON 503", http.StatusServiceUnavailable, "application/json", `{"error": {"code": 503, "message": "overloaded"}}`, true},
+		{"JSON 400", http.StatusBadRequest, "application/json", `{"error": {"code": 400, "message": "bad prompt"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			c := NewGeminiClient("test-key", "")
+			c.baseURL = server.URL
+			_, err := c.Generate(context.Background(), "hello", GenOptions{})
+			if err == nil {
+				t.Fatal("Generate succeeded, want an error")
+			}
+			if got := shouldFallback(err); got != tt.fallback {
+				t.Errorf("shouldFallback(%v) = %v, want %v", err, got, tt.fallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// defaultFeedDir holds the GUIDs already returned from each feed
+const defaultFeedDir = ".agentscript/feeds"
+
+// maxSeenItems bounds the remembered GUIDs per feed, oldest dropped first
+const maxSeenItems = 5000
+
+// FeedItem is one entry of an RSS or Atom feed
+type FeedItem struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Published string `json:"published,omitempty"` // RFC 3339
+	Author    string `json:"author,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+
+	published time.Time
+}
+
+// feed reads an RSS 2.0, RSS 1.0 or Atom feed and returns its items as a
+// JSON array, newest first. Items returned by earlier runs are skipped
+// unless only_new=false, so a scheduled script sees each item once. The
+// items are remembered only when the whole run succeeds.
+func (r *Runtime) feed(ctx context.Context, cmd *Command, target, input string) (string, error) {
+	target = feedTarget(target, input)
+	if target == "" {
+		return "", fmt.Errorf("no feed URL - provide one as argument or pipe it in")
+	}
+
+	var since time.Time
+	if v, ok := cmd.Option("since"); ok {
+		t, err := parseSince(v, time.Now())
+		if err != nil {
+			return "", err
+		}
+		since = t
+	}
+	limit, err := intOption(cmd, "limit", 0, 1)
+	if err != nil {
+		return "", err
+	}
+	onlyNew := true
+	if v, ok := cmd.Option("only_new"); ok {
+		if onlyNew, err = strconv.ParseBool(v); err != nil {
+			return "", fmt.Errorf("invalid only_new %q", v)
+		}
+	}
+
+	fmt.Printf("📰 Reading feed %s...\n", target)
+	final, _, body, err := download(ctx, target,
+		"application/rss+xml,application/atom+xml,application/xml;q=0.9,text/xml;q=0.9,*/*;q=0.5",
+		defaultFetchTimeout, defaultFetchMaxBytes)
+	if err != nil {
+		return "", err
+	}
+	title, items, err := parseFeed(body, final)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	state, err := loadFeedState(r.feedDir, target)
+	if err != nil {
+		return "", err
+	}
+
+	var picked []FeedItem
+	total := len(items)
+	for _, item := range items {
+		if !since.IsZero() && !item.published.IsZero() && item.published.Before(since) {
+			continue
+		}
+		if onlyNew && state.has(item.ID) {
+			continue
+		}
+		picked = append(picked, item)
+		if limit > 0 && len(picked) == limit {
+			break
+		}
+	}
+
+	r.markSeen(target, picked)
+
+	sources := make([]Citation, 0, len(picked))
+	for _, item := range picked {
+		if item.URL != "" {
+			sources = append(sources, Citation{Title: item.Title, URL: item.URL})
+		}
+	}
+	r.addSources(ctx, sources)
+
+	if picked == nil {
+		picked = []FeedItem{}
+	}
+	fmt.Printf("✅ %s: %d of %d items\n", firstNonEmpty(title, final.Host), len(picked), total)
+	return toJSON(picked), nil
+}
+
+// feedTarget is the feed a step reads: its argument, else the first URL
+// in its input
+func feedTarget(arg, input string) string {
+	if arg != "" {
+		return arg
+	}
+	return firstURL.FindString(input)
+}
+
+// markSeen records items to remember once the run succeeds, so a run that
+// fails after the feed step sees them again next time
+func (r *Runtime) markSeen(feedURL string, items []FeedItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pendingSeen == nil {
+		r.pendingSeen = make(map[string][]string)
+	}
+	for _, item := range items {
+		r.pendingSeen[feedURL] = append(r.pendingSeen[feedURL], item.ID)
+	}
+}
+
+// restoreSeen marks the items of a feed step restored from a checkpoint
+func (r *Runtime) restoreSeen(cmd *Command, input, output string) {
+	var items []FeedItem
+	if json.Unmarshal([]byte(output), &items) == nil {
+		r.markSeen(feedTarget(cmd.Arg, input), items)
+	}
+}
+
+// saveSeen remembers the items returned during a successful run
+func (r *Runtime) saveSeen() error {
+	r.mu.Lock()
+	pending := r.pendingSeen
+	r.pendingSeen = nil
+	r.mu.Unlock()
+
+	for feedURL, ids := range pending {
+		state, err := loadFeedState(r.feedDir, feedURL)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			state.add(id)
+		}
+		if err := state.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropSeen forgets the items returned during a failed run
+func (r *Runtime) dropSeen() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, ids := range r.pendingSeen {
+		n += len(ids)
+	}
+	if n > 0 {
+		fmt.Printf("📰 %d feed item(s) not marked as seen because the run failed\n", n)
+	}
+	r.pendingSeen = nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseSince reads a since= value: an age such as "24h" or "7d", or a date
+// in YYYY-MM-DD or RFC 3339 form
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (use an age like 24h or 7d, or a date like 2026-01-31)", v)
+}
+
+// rawFeed decodes RSS 2.0 (<rss><channel>), RSS 1.0 (<rdf:RDF>) and Atom
+// (<feed>) documents; fields of the other formats stay empty
+type rawFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rawItem `xml:"item"`
+	} `xml:"channel"`
+	Title   string    `xml:"title"`
+	Items   []rawItem `xml:"item"`  // RSS 1.0
+	Entries []rawItem `xml:"entry"` // Atom
+}
+
+type rawItem struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	GUID      string `xml:"guid"`
+	ID        string `xml:"id"`
+	About     string `xml:"about,attr"`
+	PubDate   string `xml:"pubDate"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Date      string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator   string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Author    struct {
+		Name string `xml:"name"`      // Atom
+		Text string `xml:",chardata"` // RSS: an email address
+	} `xml:"author"`
+	Description string `xml:"description"`
+	Summary     string `xml:"summary"`
+	Content     string `xml:"content"`
+	Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// parseFeed returns the feed's title and items, newest first
+func parseFeed(data []byte, base *url.URL) (string, []FeedItem, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	var raw rawFeed
+	if err := dec.Decode(&raw); err != nil {
+		return "", nil, err
+	}
+
+	title := raw.Channel.Title
+	rawItems := raw.Channel.Items
+	switch strings.ToLower(raw.XMLName.Local) {
+	case "rss":
+	case "rdf":
+		rawItems = raw.Items
+	case "feed":
+		title, rawItems = raw.Title, raw.Entries
+	default:
+		return "", nil, fmt.Errorf("<%s> is not an RSS or Atom feed", raw.XMLName.Local)
+	}
+
+	var items []FeedItem
+	for _, ri := range rawItems {
+		item := FeedItem{
+			Title:  strings.Join(strings.Fields(ri.Title), " "),
+			URL:    ri.link(base),
+			Author: strings.TrimSpace(firstNonEmpty(ri.Author.Name, ri.Creator, ri.Author.Text)),
+		}
+		for _, d := range []string{ri.PubDate, ri.Published, ri.Date, ri.Updated} {
+			if t, ok := parseFeedDate(d); ok {
+				item.published = t
+				item.Published = t.UTC().Format(time.RFC3339)
+				break
+			}
+		}
+		item.Summary = feedText(firstNonEmpty(ri.Summary, ri.Description, ri.Encoded, ri.Content), base)
+		item.ID = strings.TrimSpace(firstNonEmpty(ri.GUID, ri.ID, ri.About, item.URL))
+		if item.ID == "" {
+			item.ID = item.Title + "|" + item.Published
+		}
+		items = append(items, item)
+	}
+
+	// Newest first; undated items keep their feed order at the end
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].published.After(items[j].published)
+	})
+	return title, items, nil
+}
+
+// link returns the item's page: the Atom alternate link, else the RSS
+// <link> text, resolved against the feed URL
+func (ri rawItem) link(base *url.URL) string {
+	var href string
+	for _, l := range ri.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			href = l.Href
+			break
+		}
+		if text := strings.TrimSpace(l.Text); text != "" && href == "" {
+			href = text
+		}
+	}
+	if href == "" && strings.HasPrefix(ri.GUID, "http") {
+		href = ri.GUID
+	}
+	if ref, err := url.Parse(strings.TrimSpace(href)); err == nil && href != "" {
+		return base.ResolveReference(ref).String()
+	}
+	return ""
+}
+
+// feedDateLayouts covers RFC 822 dates as written in the wild, and the
+// RFC 3339 dates of Atom
+var feedDateLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822, time.RFC3339, time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700", "2 Jan 2006 15:04:05 -0700", "02 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly,
+}
+
+func parseFeedDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// feedText turns an item's HTML summary into plain Markdown text
+func feedText(s string, base *url.URL) string {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "<") {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	_, text, err := htmlToMarkdown([]byte(s), base)
+	if err != nil {
+		return s
+	}
+	return text
+}
+
+// feedState records the items already returned from one feed
+type feedState struct {
+	path string
+	URL  string               `json:"url"`
+	Seen map[string]time.Time `json:"seen"` // item id -> first returned
+}
+
+func loadFeedState(dir, feedURL string) (*feedState, error) {
+	if dir == "" {
+		dir = defaultFeedDir
+	}
+	sum := sha256.Sum256([]byte(feedURL))
+	state := &feedState{
+		path: filepath.Join(dir, hex.EncodeToString(sum[:8])+".json"),
+		URL:  feedURL,
+		Seen: make(map[string]time.Time),
+	}
+
+	data, err := os.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse feed state %s: %w", state.path, err)
+	}
+	if state.Seen == nil {
+		state.Seen = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+func (s *feedState) has(id string) bool {
+	_, ok := s.Seen[id]
+	return ok
+}
+
+func (s *feedState) add(id string) {
+	if !s.has(id) {
+		s.Seen[id] = time.Now().UTC()
+	}
+}
+
+// save writes the state, forgetting the oldest items beyond maxSeenItems
+func (s *feedState) save() error {
+	if len(s.Seen) > maxSeenItems {
+		ids := make([]string, 0, len(s.Seen))
+		for id := range s.Seen {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return s.Seen[ids[i]].Before(s.Seen[ids[j]]) })
+		for _, id := range ids[:len(ids)-maxSeenItems] {
+			delete(s.Seen, id)
+		}
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode feed state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create feed state directory: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
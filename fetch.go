@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// fetch limits, overridable per step with timeout= and max_size=
+const (
+	defaultFetchTimeout  = 30 * time.Second
+	defaultFetchMaxBytes = 10 << 20
+	maxFetchRedirects    = 10
+	fetchUserAgent       = "agentscript/1.0 (+https://github.com/vinodhalaharvi/agentscript)"
+)
+
+// firstURL matches the first http(s) URL in piped input
+var firstURL = regexp.MustCompile(`https?://[^\s<>"'\x60\])]+`)
+
+// fetchedPage is a downloaded page converted to text
+type fetchedPage struct {
+	URL         string // after redirects
+	Title       string
+	ContentType string
+	Text        string
+	Canonical   string   // the page's rel=canonical URL, if any
+	Links       []string // absolute http(s) links anywhere on the page
+}
+
+// fetch downloads a web page and returns it as readable text: HTML as
+// Markdown without navigation, scripts and ads, PDFs as their text, and
+// plain text unchanged. Without a URL argument it fetches the first URL in
+// the input, so it can follow a search step.
+func (r *Runtime) fetch(ctx context.Context, cmd *Command, target, input string) (string, error) {
+	if target == "" {
+		target = firstURL.FindString(input)
+	}
+	if target == "" {
+		return "", fmt.Errorf("no URL - provide one as argument or pipe it in")
+	}
+
+	timeout := defaultFetchTimeout
+	maxBytes := int64(defaultFetchMaxBytes)
+	if v, ok := cmd.Option("timeout"); ok {
+		d, err := parseTimeout(v)
+		if err != nil {
+			return "", err
+		}
+		timeout = d
+	}
+	if v, ok := cmd.Option("max_size"); ok {
+		n, err := parseSize(v)
+		if err != nil {
+			return "", err
+		}
+		maxBytes = n
+	}
+
+	fmt.Printf("🌐 Fetching %s...\n", target)
+	page, err := fetchPage(ctx, target, timeout, maxBytes)
+	if err != nil {
+		return "", err
+	}
+	r.addSources(ctx, []Citation{{Title: page.Title, URL: page.URL}})
+
+	fmt.Printf("✅ Fetched %s (%s, %d chars)\n", page.URL, page.ContentType, len(page.Text))
+	if page.Title != "" && !strings.HasPrefix(page.Text, "# ") {
+		return "# " + page.Title + "\n\n" + page.Text, nil
+	}
+	return page.Text, nil
+}
+
+// parseTimeout reads a timeout given as a duration ("90s", "2m") or seconds
+func parseTimeout(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q (use seconds or a duration like 90s)", v)
+	}
+	return d, nil
+}
+
+// parseSize reads a byte count with an optional KB, MB or GB suffix
+func parseSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q (use bytes or e.g. 5MB)", v)
+	}
+	return n * mult, nil
+}
+
+// download GETs target, following up to maxFetchRedirects redirects, and
+// returns the final URL, the response headers and a body of at most
+// maxBytes
+func download(ctx context.Context, target, accept string, timeout time.Duration, maxBytes int64) (*url.URL, http.Header, []byte, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil, nil, fmt.Errorf("invalid URL %q - only http and https are supported", target)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", fetchUserAgent)
+	req.Header.Set("Accept", accept)
+
+	client := newHTTPClient()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxFetchRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported URL %s", req.URL)
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, nil, nil, fmt.Errorf("%s is %d bytes, over the %d-byte limit (raise it with max_size=)", u, resp.ContentLength, maxBytes)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read %s: %w", u, err)
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, nil, nil, fmt.Errorf("%s is over the %d-byte limit (raise it with max_size=)", u, maxBytes)
+	}
+	return resp.Request.URL, resp.Header, body, nil
+}
+
+// fetchPage downloads target and converts it to text by content type
+func fetchPage(ctx context.Context, target string, timeout time.Duration, maxBytes int64) (*fetchedPage, error) {
+	final, headers, body, err := download(ctx, target,
+		"text/html,application/xhtml+xml,application/pdf,text/plain;q=0.9,*/*;q=0.5", timeout, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &fetchedPage{URL: final.String()}
+	header := headers.Get("Content-Type")
+	page.ContentType, _, _ = mime.ParseMediaType(header)
+	if page.ContentType == "" || page.ContentType == "application/octet-stream" {
+		page.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	if isPDF(body) {
+		page.ContentType = "application/pdf"
+	}
+
+	switch ct := page.ContentType; {
+	case ct == "text/html" || ct == "application/xhtml+xml":
+		utf8Body, err := toUTF8(body, header)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := html.Parse(bytes.NewReader(utf8Body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		}
+		page.Title, page.Text = documentMarkdown(doc, final)
+		page.Canonical, page.Links = documentLinks(doc, final)
+	case ct == "application/pdf":
+		if page.Text, err = pdfText(body); err != nil {
+			return nil, fmt.Errorf("failed to read PDF: %w", err)
+		}
+	case strings.HasPrefix(ct, "text/") || ct == "application/json" || ct == "application/xml" ||
+		strings.HasSuffix(ct, "+json") || strings.HasSuffix(ct, "+xml"):
+		utf8Body, err := toUTF8(body, header)
+		if err != nil {
+			return nil, err
+		}
+		page.Text = string(utf8Body)
+	default:
+		return nil, fmt.Errorf("%s is %s, which fetch cannot convert to text", final, ct)
+	}
+	return page, nil
+}
+
+// toUTF8 converts a text body to UTF-8 using the charset from the
+// Content-Type header or the document itself
+func toUTF8(body []byte, contentType string) ([]byte, error) {
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return body, nil // unknown charset: use as is
+	}
+	return io.ReadAll(r)
+}
+
+// htmlToMarkdown converts the main content of an HTML document to
+// Markdown, dropping navigation, scripts, forms and ads. Relative links
+// are resolved against base.
+func htmlToMarkdown(page []byte, base *url.URL) (title, text string, err error) {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return "", "", err
+	}
+	title, text = documentMarkdown(doc, base)
+	return title, text, nil
+}
+
+// documentMarkdown returns the title and main content of a parsed page
+func documentMarkdown(doc *html.Node, base *url.URL) (title, text string) {
+	if t := findElement(doc, atom.Title); t != nil {
+		title = strings.Join(strings.Fields(textContent(t)), " ")
+	}
+	w := &markdownWriter{base: base}
+	w.children(mainContent(doc))
+	return title, w.String()
+}
+
+// documentLinks returns a page's canonical URL and every http(s) link on
+// it, navigation included, resolved against base and without fragments
+func documentLinks(doc *html.Node, base *url.URL) (canonical string, links []string) {
+	resolve := func(href string) string {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			return ""
+		}
+		u := base.ResolveReference(ref)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return ""
+		}
+		u.Fragment = ""
+		return u.String()
+	}
+
+	seen := make(map[string]bool)
+	walkElements(doc, func(n *html.Node) {
+		switch {
+		case n.DataAtom == atom.Link && canonical == "" && strings.EqualFold(attr(n, "rel"), "canonical"):
+			canonical = resolve(attr(n, "href"))
+		case n.DataAtom == atom.A && attr(n, "href") != "" && !strings.Contains(attr(n, "rel"), "nofollow"):
+			if link := resolve(attr(n, "href")); link != "" && !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	})
+	return canonical, links
+}
+
+// mainContent picks the element holding the page's content: <main>, else
+// the longest <article>, else <body>
+func mainContent(doc *html.Node) *html.Node {
+	if main := findElement(doc, atom.Main); main != nil {
+		return main
+	}
+	var best *html.Node
+	bestLen := 0
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Article {
+			if l := len(textContent(n)); l > bestLen {
+				best, bestLen = n, l
+			}
+		}
+	})
+	if best != nil {
+		return best
+	}
+	if body := findElement(doc, atom.Body); body != nil {
+		return body
+	}
+	return doc
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func walkElements(n *html.Node, visit func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		visit(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkElements(c, visit)
+	}
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// droppedElements never hold readable content
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Button: true,
+	atom.Select: true, atom.Input: true, atom.Textarea: true, atom.Object: true,
+	atom.Embed: true, atom.Dialog: true, atom.Menu: true, atom.Head: true,
+}
+
+// boilerplate matches class and id names of ads and page furniture
+var boilerplate = regexp.MustCompile(`(?i)(^|[-_\s])(ads?|advert\w*|sponsor\w*|promo\w*|banner|cookie\w*|consent|newsletter|subscribe|social|share|sharing|related|recommended|comments?|sidebar|popup|modal|breadcrumbs?|skip-link|navbar|menu)($|[-_\s])`)
+
+// dropped reports whether an element is page furniture rather than content
+func dropped(n *html.Node) bool {
+	if droppedElements[n.DataAtom] {
+		return true
+	}
+	if n.DataAtom == atom.Header && !insideArticle(n) {
+		return true
+	}
+	switch attr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary", "search", "dialog":
+		return true
+	}
+	if attr(n, "aria-hidden") == "true" || attr(n, "hidden") != "" ||
+		strings.Contains(strings.ReplaceAll(attr(n, "style"), " ", ""), "display:none") {
+		return true
+	}
+	if !boilerplate.MatchString(attr(n, "class")) && !boilerplate.MatchString(attr(n, "id")) {
+		return false
+	}
+	// Layout wrappers such as "page has-sidebar" can hold the content itself
+	return findElement(n, atom.H1) == nil && findElement(n, atom.Article) == nil && findElement(n, atom.Main) == nil
+}
+
+func insideArticle(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Article || p.DataAtom == atom.Main {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownWriter renders HTML nodes as Markdown
+type markdownWriter struct {
+	b     strings.Builder
+	base  *url.URL
+	lists []int // per open list: 0 for <ul>, else the next <ol> number
+}
+
+// String returns the Markdown with runs of blank lines collapsed
+func (w *markdownWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	var out []string
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+func (w *markdownWriter) endsWith(s string) bool {
+	return strings.HasSuffix(w.b.String(), s)
+}
+
+// block starts a new paragraph
+func (w *markdownWriter) block() {
+	if w.b.Len() > 0 && !w.endsWith("\n\n") {
+		if w.endsWith("\n") {
+			w.b.WriteString("\n")
+		} else {
+			w.b.WriteString("\n\n")
+		}
+	}
+}
+
+func (w *markdownWriter) newline() {
+	if w.b.Len() > 0 && !w.endsWith("\n") {
+		w.b.WriteString("\n")
+	}
+}
+
+// inline renders the children of n into a string
+func (w *markdownWriter) inline(n *html.Node) string {
+	sub := &markdownWriter{base: w.base, lists: w.lists}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sub.node(c)
+	}
+	return strings.TrimSpace(sub.b.String())
+}
+
+func (w *markdownWriter) text(s string) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		if s != "" && w.b.Len() > 0 && !w.endsWith(" ") && !w.endsWith("\n") {
+			w.b.WriteString(" ")
+		}
+		return
+	}
+	if strings.IndexFunc(s[:1], isHTMLSpace) == 0 && w.b.Len() > 0 && !w.endsWith(" ") && !w.endsWith("\n") {
+		w.b.WriteString(" ")
+	}
+	w.b.WriteString(strings.Join(words, " "))
+	if strings.IndexFunc(s[len(s)-1:], isHTMLSpace) == 0 {
+		w.b.WriteString(" ")
+	}
+}
+
+func isHTMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+func (w *markdownWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if dropped(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		if text := w.inline(n); text != "" {
+			w.block()
+			level := int(n.Data[1] - '0')
+			w.b.WriteString(strings.Repeat("#", level) + " " + strings.Join(strings.Fields(text), " "))
+			w.block()
+		}
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+		atom.Figure, atom.Figcaption, atom.Details, atom.Summary, atom.Dl:
+		w.block()
+		w.children(n)
+		w.block()
+	case atom.Dt, atom.Dd:
+		w.newline()
+		w.children(n)
+		w.newline()
+	case atom.Br:
+		w.b.WriteString("\n")
+	case atom.Hr:
+		w.block()
+		w.b.WriteString("---")
+		w.block()
+	case atom.A:
+		text := w.inline(n)
+		href := strings.TrimSpace(attr(n, "href"))
+		if text == "" {
+			return
+		}
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			w.text(" " + text + " ")
+			return
+		}
+		if ref, err := url.Parse(href); err == nil && w.base != nil {
+			href = w.base.ResolveReference(ref).String()
+		}
+		w.spaceBefore()
+		fmt.Fprintf(&w.b, "[%s](%s)", strings.Join(strings.Fields(text), " "), href)
+	case atom.Strong, atom.B:
+		w.wrap(n, "**")
+	case atom.Em, atom.I:
+		w.wrap(n, "_")
+	case atom.Code, atom.Kbd, atom.Samp:
+		if text := strings.TrimSpace(textContent(n)); text != "" {
+			w.spaceBefore()
+			w.b.WriteString("`" + text + "`")
+		}
+	case atom.Pre:
+		w.block()
+		w.b.WriteString("```\n" + strings.Trim(textContent(n), "\n") + "\n```")
+		w.block()
+	case atom.Blockquote:
+		text := (&markdownWriter{base: w.base}).render(n)
+		if text != "" {
+			w.block()
+			w.b.WriteString("> " + strings.ReplaceAll(text, "\n", "\n> "))
+			w.block()
+		}
+	case atom.Ul, atom.Ol:
+		start := 0
+		if n.DataAtom == atom.Ol {
+			start = 1
+			if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+				start = s
+			}
+		}
+		if len(w.lists) == 0 {
+			w.block()
+		} else {
+			w.newline()
+		}
+		w.lists = append(w.lists, start)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		if len(w.lists) == 0 {
+			w.block()
+		} else {
+			w.newline()
+		}
+	case atom.Li:
+		w.newline()
+		depth := len(w.lists)
+		marker := "- "
+		if depth > 0 && w.lists[depth-1] > 0 {
+			marker = strconv.Itoa(w.lists[depth-1]) + ". "
+			w.lists[depth-1]++
+		}
+		w.b.WriteString(strings.Repeat("  ", max(depth-1, 0)) + marker)
+		w.children(n)
+		w.newline()
+	case atom.Table:
+		w.table(n)
+	case atom.Img, atom.Picture, atom.Video, atom.Audio, atom.Source, atom.Title:
+		// Media carry no text worth keeping
+	default:
+		w.children(n)
+	}
+}
+
+// render renders n's children as a standalone Markdown string
+func (w *markdownWriter) render(n *html.Node) string {
+	w.children(n)
+	return w.String()
+}
+
+func (w *markdownWriter) spaceBefore() {
+	if w.b.Len() > 0 && !w.endsWith(" ") && !w.endsWith("\n") && !w.endsWith("(") {
+		w.b.WriteString(" ")
+	}
+}
+
+// wrap renders inline emphasis
+func (w *markdownWriter) wrap(n *html.Node, mark string) {
+	text := w.inline(n)
+	if text == "" {
+		return
+	}
+	w.spaceBefore()
+	w.b.WriteString(mark + text + mark)
+}
+
+// table renders a table as a Markdown table, using the first row as header
+func (w *markdownWriter) table(n *html.Node) {
+	var rows [][]string
+	walkElements(n, func(e *html.Node) {
+		if e.DataAtom != atom.Tr {
+			return
+		}
+		var cells []string
+		for c := e.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Td || c.DataAtom == atom.Th {
+				cell := strings.Join(strings.Fields(w.inline(c)), " ")
+				cells = append(cells, strings.ReplaceAll(cell, "|", `\|`))
+			}
+		}
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	})
+	if len(rows) == 0 {
+		return
+	}
+
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	w.block()
+	for i, row := range rows {
+		for len(row) < cols {
+			row = append(row, "")
+		}
+		w.b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			w.b.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	w.block()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultMaxFiles is how many files a glob read returns unless max_files
+// says otherwise
+const defaultMaxFiles = 100
+
+// fileEntry is one item of list's JSON output
+type fileEntry struct {
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+}
+
+// readFileResult is one file of a glob read
+type readFileResult struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// list shows a directory's entries with their sizes and modification
+// times. recursive=true or depth=N descends into subdirectories, match=
+// filters files by glob, all=true includes hidden and .gitignored entries
+// and format=json returns a JSON array of {path, type, size, modified}.
+func (r *Runtime) list(cmd *Command, root string) (string, error) {
+	if root == "" {
+		root = "."
+	}
+	depth, err := intOption(cmd, "depth", 1, 1)
+	if err != nil {
+		return "", err
+	}
+	if cmd.Flag("recursive") {
+		depth = 0
+	}
+	pattern, _ := cmd.Option("match")
+	if pattern != "" {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return "", fmt.Errorf("invalid match pattern %q: %w", pattern, err)
+		}
+	}
+	format, _ := cmd.Option("format")
+	if format != "" && format != "text" && format != "json" {
+		return "", fmt.Errorf("invalid format %q (expected text or json)", format)
+	}
+
+	if err := r.checkPath(root, "list"); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to list directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("failed to list directory: %s is not a directory", root)
+	}
+	r.log("LIST: %s (depth %d, match %q)", root, depth, pattern)
+
+	var entries []fileEntry
+	err = walkFiles(root, depth, cmd.Flag("all"), func(p, rel string, d fs.DirEntry) error {
+		if !r.workspace.Visible(p) {
+			return skip(d)
+		}
+		if pattern != "" && (d.IsDir() || !matchFile(pattern, rel)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed while listing
+		}
+		entry := fileEntry{Path: rel, Type: "file", Size: info.Size(), Modified: info.ModTime().Format(time.RFC3339)}
+		if d.IsDir() {
+			entry.Type, entry.Size = "dir", 0
+		} else if d.Type()&fs.ModeSymlink != 0 {
+			entry.Type = "symlink"
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list directory: %w", err)
+	}
+
+	if format == "json" {
+		if entries == nil {
+			return "[]", nil
+		}
+		return toJSON(entries), nil
+	}
+
+	var lines []string
+	for _, e := range entries {
+		modified, _ := time.Parse(time.RFC3339, e.Modified)
+		switch e.Type {
+		case "dir":
+			lines = append(lines, fmt.Sprintf("📁 %s/", e.Path))
+		case "symlink":
+			lines = append(lines, fmt.Sprintf("🔗 %s", e.Path))
+		default:
+			lines = append(lines, fmt.Sprintf("📄 %s  %s  %s", e.Path, formatSize(e.Size), modified.Format("2006-01-02 15:04")))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// readGlob reads every file matching pattern into a JSON array of
+// {path, content}, converting each the way read does. Files that cannot
+// be read are skipped with a warning.
+func (r *Runtime) readGlob(ctx context.Context, cmd *Command, pattern string) (string, error) {
+	maxFiles, err := intOption(cmd, "max_files", defaultMaxFiles, 1)
+	if err != nil {
+		return "", err
+	}
+	base, rest := splitGlob(pattern)
+	if err := r.checkPath(base, "read"); err != nil {
+		return "", err
+	}
+	if _, err := path.Match(strings.ReplaceAll(rest, "**", "*"), ""); err != nil {
+		return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var paths []string
+	err = walkFiles(base, 0, cmd.Flag("all"), func(p, rel string, d fs.DirEntry) error {
+		if d.Type().IsRegular() && matchGlob(rest, rel) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", pattern, err)
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no files match %s", pattern)
+	}
+	if len(paths) > maxFiles {
+		fmt.Printf("⚠️  %d files match %s, reading the first %d (raise max_files to read more)\n", len(paths), pattern, maxFiles)
+		paths = paths[:maxFiles]
+	}
+	fmt.Printf("📂 Reading %d file(s) matching %s...\n", len(paths), pattern)
+
+	var files []readFileResult
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		content, err := r.readFile(ctx, cmd, p)
+		if err != nil {
+			fmt.Printf("⚠️  Skipping %s: %v\n", p, err)
+			continue
+		}
+		files = append(files, readFileResult{Path: filepath.ToSlash(p), Content: content})
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("none of the %d files matching %s could be read", len(paths), pattern)
+	}
+	return toJSON(files), nil
+}
+
+// hasGlob reports whether a path contains glob characters
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// splitGlob splits a pattern into the directory before its first glob
+// segment and the rest, e.g. "src/**/*.go" -> "src", "**/*.go"
+func splitGlob(pattern string) (string, string) {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, part := range parts {
+		if hasGlob(part) {
+			base := strings.Join(parts[:i], "/")
+			if base == "" {
+				base = "."
+				if i > 0 {
+					base = "/" // absolute pattern such as "/*.log"
+				}
+			}
+			return filepath.FromSlash(base), strings.Join(parts[i:], "/")
+		}
+	}
+	return filepath.Dir(pattern), filepath.Base(pattern)
+}
+
+// matchGlob matches a slash-separated path against a pattern in which
+// "**" stands for any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchFile matches a file against a filter: patterns with a slash match
+// the relative path, others just the file name
+func matchFile(pattern, rel string) bool {
+	if strings.Contains(pattern, "/") {
+		return matchGlob(pattern, rel)
+	}
+	ok, _ := path.Match(pattern, path.Base(rel))
+	return ok
+}
+
+// formatSize writes a byte count the way ls -h does
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, suffix := float64(n)/unit, "KB"
+	for _, s := range []string{"MB", "GB", "TB"} {
+		if size < unit {
+			break
+		}
+		size, suffix = size/unit, s
+	}
+	return fmt.Sprintf("%.1f %s", size, suffix)
+}
+
+// walkFiles visits the entries under root in lexical order, passing each
+// one's path and its slash-separated path relative to root. It descends
+// at most depth levels (0 for no limit) and, unless all is set, skips
+// hidden entries and those excluded by .gitignore files from the
+// enclosing repository down. .git itself is always skipped.
+func walkFiles(root string, depth int, all bool, visit func(path, rel string, d fs.DirEntry) error) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	var rules []ignoreRule
+	if !all {
+		rules = parentIgnoreRules(absRoot)
+	}
+
+	// Rules from .gitignore files inside the tree apply below their directory
+	dirRules := map[string][]ignoreRule{}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil // unreadable entries are left out
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		abs := filepath.Join(absRoot, filepath.FromSlash(rel))
+		if p == root {
+			if d.IsDir() && !all {
+				dirRules[abs] = append(rules[:len(rules):len(rules)], loadIgnoreRules(abs)...)
+			}
+			return nil
+		}
+
+		if d.Name() == ".git" {
+			return skip(d)
+		}
+		if !all {
+			active := dirRules[filepath.Dir(abs)]
+			if strings.HasPrefix(d.Name(), ".") || ignored(active, abs, d.IsDir()) {
+				return skip(d)
+			}
+			if d.IsDir() {
+				dirRules[abs] = append(active[:len(active):len(active)], loadIgnoreRules(abs)...)
+			}
+		}
+
+		if err := visit(p, rel, d); err != nil {
+			return err
+		}
+		if d.IsDir() && depth > 0 && strings.Count(rel, "/")+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func skip(d fs.DirEntry) error {
+	if d.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
+
+// ignoreRule is one line of a .gitignore file
+type ignoreRule struct {
+	base     string // directory of the .gitignore file
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // contains a slash, so it matches from base
+}
+
+// loadIgnoreRules reads dir/.gitignore, if there is one
+func loadIgnoreRules(dir string) []ignoreRule {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate, line = true, line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// parentIgnoreRules loads the .gitignore files between the repository
+// root containing dir and dir's parent, outermost first
+func parentIgnoreRules(dir string) []ignoreRule {
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if d != dir {
+			dirs = append(dirs, d)
+		}
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		if filepath.Dir(d) == d {
+			return nil // not in a repository
+		}
+	}
+	var rules []ignoreRule
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rules = append(rules, loadIgnoreRules(dirs[i])...)
+	}
+	return rules
+}
+
+// ignored applies rules to an absolute path; the last matching rule wins
+func ignored(rules []ignoreRule, abs string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		var match bool
+		if rule.anchored {
+			match = matchGlob(rule.pattern, rel)
+		} else {
+			match, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if match {
+			result = !rule.negate
+		}
+	}
+	return result
+}
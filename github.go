@@ -21,22 +21,36 @@ import (
 type GitHubClient struct {
 	httpClient *http.Client
 	username   string
+	apiURL     string // REST API base, e.g. https://api.github.com
+	serverURL  string // web base, e.g. https://github.com
 }
 
-// NewGitHubClient creates a new GitHub client with OAuth2
-func NewGitHubClient(ctx context.Context, clientID, clientSecret, tokenFile string) (*GitHubClient, error) {
+// NewGitHubClient creates a new GitHub client with OAuth2. apiURL and
+// serverURL point at github.com by default and can be set for GitHub
+// Enterprise.
+func NewGitHubClient(ctx context.Context, clientID, clientSecret, tokenFile, apiURL, serverURL string) (*GitHubClient, error) {
+	// Route OAuth traffic through the shared transport
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, newHTTPClient())
+
 	config := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Scopes:       []string{"repo", "read:user"},
 		Endpoint:     github.Endpoint,
 	}
+	if serverURL != defaultGitHubServerURL {
+		config.Endpoint = oauth2.Endpoint{
+			AuthURL:       serverURL + "/login/oauth/authorize",
+			TokenURL:      serverURL + "/login/oauth/access_token",
+			DeviceAuthURL: serverURL + "/login/device/code",
+		}
+	}
 
 	// Try to load existing token
 	token, err := loadGitHubToken(tokenFile)
 	if err != nil {
 		// Need to get new token via device flow (easier than web redirect)
-		token, err = getGitHubDeviceToken(ctx, config)
+		token, err = getGitHubDeviceToken(ctx, config, serverURL)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get GitHub token: %w", err)
 		}
@@ -47,10 +61,14 @@ func NewGitHubClient(ctx context.Context, clientID, clientSecret, tokenFile stri
 	}
 
 	// Create HTTP client with token
-	client := config.Client(ctx, token)
+	return newGitHubClientWithHTTP(ctx, config.Client(ctx, token), apiURL, serverURL)
+}
 
+// newGitHubClientWithHTTP creates a GitHub client around an already
+// authorized HTTP client
+func newGitHubClientWithHTTP(ctx context.Context, client *http.Client, apiURL, serverURL string) (*GitHubClient, error) {
 	// Get username
-	username, err := getGitHubUsername(ctx, client)
+	username, err := getGitHubUsername(ctx, client, apiURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get username: %w", err)
 	}
@@ -58,21 +76,23 @@ func NewGitHubClient(ctx context.Context, clientID, clientSecret, tokenFile stri
 	return &GitHubClient{
 		httpClient: client,
 		username:   username,
+		apiURL:     apiURL,
+		serverURL:  serverURL,
 	}, nil
 }
 
 // getGitHubDeviceToken uses device flow for authentication
-func getGitHubDeviceToken(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
+func getGitHubDeviceToken(ctx context.Context, config *oauth2.Config, serverURL string) (*oauth2.Token, error) {
 	// Device flow request
 	reqBody := fmt.Sprintf("client_id=%s&scope=%s", config.ClientID, strings.Join(config.Scopes, " "))
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://github.com/login/device/code", strings.NewReader(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/login/device/code", strings.NewReader(reqBody))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := newHTTPClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -109,14 +129,14 @@ func getGitHubDeviceToken(ctx context.Context, config *oauth2.Config) (*oauth2.T
 		tokenReq := fmt.Sprintf("client_id=%s&device_code=%s&grant_type=urn:ietf:params:oauth:grant-type:device_code",
 			config.ClientID, deviceResp.DeviceCode)
 
-		req, err := http.NewRequestWithContext(ctx, "POST", "https://github.com/login/oauth/access_token", strings.NewReader(tokenReq))
+		req, err := http.NewRequestWithContext(ctx, "POST", serverURL+"/login/oauth/access_token", strings.NewReader(tokenReq))
 		if err != nil {
 			return nil, err
 		}
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := newHTTPClient().Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -169,8 +189,8 @@ func saveGitHubToken(filename string, token *oauth2.Token) error {
 	return os.WriteFile(filename, data, 0600)
 }
 
-func getGitHubUsername(ctx context.Context, client *http.Client) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/user", nil)
+func getGitHubUsername(ctx context.Context, client *http.Client, apiURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL+"/user", nil)
 	if err != nil {
 		return "", err
 	}
@@ -201,7 +221,7 @@ func (g *GitHubClient) CreateRepo(ctx context.Context, name, description string,
 	}
 
 	jsonBody, _ := json.Marshal(reqBody)
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.github.com/user/repos", bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", g.apiURL+"/user/repos", bytes.NewReader(jsonBody))
 	if err != nil {
 		return "", err
 	}
@@ -218,7 +238,7 @@ func (g *GitHubClient) CreateRepo(ctx context.Context, name, description string,
 
 	if resp.StatusCode == 422 {
 		// Repo might already exist
-		return fmt.Sprintf("https://github.com/%s/%s", g.username, name), nil
+		return fmt.Sprintf("%s/%s/%s", g.serverURL, g.username, name), nil
 	}
 
 	if resp.StatusCode != 201 {
@@ -321,7 +341,7 @@ Generated by [AgentScript](https://github.com/vinodhalaharvi/agentscript) - A DS
 func (g *GitHubClient) uploadFile(ctx context.Context, repo, path, content string) error {
 	// First, try to get existing file SHA (needed for updates)
 	var sha string
-	getURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s", g.username, repo, path)
+	getURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", g.apiURL, g.username, repo, path)
 
 	req, _ := http.NewRequestWithContext(ctx, "GET", getURL, nil)
 	req.Header.Set("Accept", "application/vnd.github+json")
@@ -368,7 +388,7 @@ func (g *GitHubClient) uploadFile(ctx context.Context, repo, path, content strin
 
 // enablePages enables GitHub Pages for a repository
 func (g *GitHubClient) enablePages(ctx context.Context, repo string) error {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/pages", g.username, repo)
+	url := fmt.Sprintf("%s/repos/%s/%s/pages", g.apiURL, g.username, repo)
 
 	reqBody := map[string]interface{}{
 		"source": map[string]string{
@@ -419,7 +439,7 @@ func (g *GitHubClient) UploadBinaryFile(ctx context.Context, repo, remotePath, l
 
 	// Get existing SHA if file exists
 	var sha string
-	getURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s", g.username, repo, remotePath)
+	getURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", g.apiURL, g.username, repo, remotePath)
 
 	req, _ := http.NewRequestWithContext(ctx, "GET", getURL, nil)
 	req.Header.Set("Accept", "application/vnd.github+json")
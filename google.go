@@ -38,8 +38,13 @@ type GoogleClient struct {
 	timezone string // User's timezone from calendar settings
 }
 
-// NewGoogleClient creates a new Google API client with OAuth2
-func NewGoogleClient(ctx context.Context, credentialsFile, tokenFile string) (*GoogleClient, error) {
+// NewGoogleClient creates a new Google API client with OAuth2. endpoints
+// optionally overrides the endpoint of individual services, keyed by
+// service name ("gmail", "drive", ...).
+func NewGoogleClient(ctx context.Context, credentialsFile, tokenFile string, endpoints map[string]string) (*GoogleClient, error) {
+	// Route OAuth traffic through the shared transport
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, newHTTPClient())
+
 	// Read credentials
 	b, err := os.ReadFile(credentialsFile)
 	if err != nil {
@@ -83,50 +88,62 @@ func NewGoogleClient(ctx context.Context, credentialsFile, tokenFile string) (*G
 	}
 
 	// Create HTTP client
-	client := config.Client(ctx, token)
+	return newGoogleClientWithHTTP(ctx, config.Client(ctx, token), endpoints)
+}
+
+// newGoogleClientWithHTTP creates all Google services around an already
+// authorized HTTP client
+func newGoogleClientWithHTTP(ctx context.Context, client *http.Client, endpoints map[string]string) (*GoogleClient, error) {
+	opts := func(service string) []option.ClientOption {
+		o := []option.ClientOption{option.WithHTTPClient(client)}
+		if endpoint := endpoints[service]; endpoint != "" {
+			o = append(o, option.WithEndpoint(endpoint))
+		}
+		return o
+	}
 
 	// Create all services
-	gmailSvc, err := gmail.NewService(ctx, option.WithHTTPClient(client))
+	gmailSvc, err := gmail.NewService(ctx, opts("gmail")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Gmail service: %w", err)
 	}
 
-	calendarSvc, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	calendarSvc, err := calendar.NewService(ctx, opts("calendar")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Calendar service: %w", err)
 	}
 
-	driveSvc, err := drive.NewService(ctx, option.WithHTTPClient(client))
+	driveSvc, err := drive.NewService(ctx, opts("drive")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Drive service: %w", err)
 	}
 
-	docsSvc, err := docs.NewService(ctx, option.WithHTTPClient(client))
+	docsSvc, err := docs.NewService(ctx, opts("docs")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Docs service: %w", err)
 	}
 
-	sheetsSvc, err := sheets.NewService(ctx, option.WithHTTPClient(client))
+	sheetsSvc, err := sheets.NewService(ctx, opts("sheets")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Sheets service: %w", err)
 	}
 
-	tasksSvc, err := tasks.NewService(ctx, option.WithHTTPClient(client))
+	tasksSvc, err := tasks.NewService(ctx, opts("tasks")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Tasks service: %w", err)
 	}
 
-	peopleSvc, err := people.NewService(ctx, option.WithHTTPClient(client))
+	peopleSvc, err := people.NewService(ctx, opts("people")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create People service: %w", err)
 	}
 
-	youtubeSvc, err := youtube.NewService(ctx, option.WithHTTPClient(client))
+	youtubeSvc, err := youtube.NewService(ctx, opts("youtube")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create YouTube service: %w", err)
 	}
 
-	formsSvc, err := forms.NewService(ctx, option.WithHTTPClient(client))
+	formsSvc, err := forms.NewService(ctx, opts("forms")...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create Forms service: %w", err)
 	}
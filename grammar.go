@@ -1,51 +1,142 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
 )
 
 // Program represents a complete AgentScript program
 type Program struct {
-	Statements []*Statement `@@*`
+	Statements []*Statement `parser:"@@*"`
 }
 
 // Statement can be a simple command or a parallel block
 type Statement struct {
-	Parallel *Parallel  `( @@ |`
-	Command  *Command   `  @@ )`
-	Pipe     *Statement `( "->" @@ )?`
+	Parallel *Parallel  `parser:"( @@ |"`
+	Command  *Command   `parser:"  @@ )"`
+	Pipe     *Statement `parser:"( '->' @@ )?"`
 }
 
 // Parallel represents a block of commands to run concurrently
 type Parallel struct {
-	Branches []*Statement `"parallel" "{" @@* "}"`
+	Branches []*Statement `parser:"'parallel' '{' @@* '}'"`
 }
 
-// Command represents a single command
+// Command represents a single command, optionally routed to a provider
+// and followed by key=value options:
+//
+//	ask@claude "question" temperature=0.2
+//	summarize model="gemini-2.5-pro"
+//	replace "colou?r" "hue"
 type Command struct {
-	Action string `@("search" | "summarize" | "save" | "read" | "stdin" | "ask" | "analyze" | "list" | "merge" | "email" | "calendar" | "meet" | "drive_save" | "doc_create" | "sheet_append" | "sheet_create" | "task" | "contact_find" | "youtube_search" | "youtube_upload" | "youtube_shorts" | "image_generate" | "image_analyze" | "video_analyze" | "video_generate" | "images_to_video" | "text_to_speech" | "audio_video_merge" | "image_audio_merge" | "maps_trip" | "form_create" | "form_responses" | "translate" | "places_search")`
-	Arg    string `@String?`
+	Pos      lexer.Position
+	Action   string    `parser:"@Ident"`
+	Provider string    `parser:"( '@' @Ident )?"`
+	Arg      string    `parser:"@String?"`
+	Args     []string  `parser:"@String*"` // further arguments, for commands that take several
+	Options  []*Option `parser:"@@*"`
+}
+
+// Option is a key=value setting attached to a command
+type Option struct {
+	Key   string `parser:"@Ident '='"`
+	Value string `parser:"@( String | Number | Ident )"`
+}
+
+// Option returns the value of a command option
+func (c *Command) Option(key string) (string, bool) {
+	for _, opt := range c.Options {
+		if opt.Key == key {
+			return opt.Value, true
+		}
+	}
+	return "", false
+}
+
+// Flag reports whether a boolean option such as invert=true is set
+func (c *Command) Flag(key string) bool {
+	v, _ := c.Option(key)
+	on, _ := strconv.ParseBool(v)
+	return on
+}
+
+// commands lists every action the runtime understands
+var commands = map[string]bool{
+	"search": true, "summarize": true, "save": true, "read": true, "stdin": true,
+	"ask": true, "analyze": true, "list": true, "merge": true, "email": true,
+	"calendar": true, "meet": true, "drive_save": true, "doc_create": true,
+	"sheet_append": true, "sheet_create": true, "task": true, "contact_find": true,
+	"youtube_search": true, "youtube_upload": true, "youtube_shorts": true,
+	"image_generate": true, "image_analyze": true, "video_analyze": true,
+	"video_generate": true, "images_to_video": true, "text_to_speech": true,
+	"audio_video_merge": true, "image_audio_merge": true, "maps_trip": true,
+	"form_create": true, "form_responses": true, "translate": true,
+	"places_search": true, "video_script": true, "confirm": true,
+	"github_pages": true, "github_pages_html": true, "extract": true,
+	"jq": true, "grep": true, "filter": true, "head": true, "tail": true,
+	"split": true, "join": true, "replace": true, "template": true,
+	"csv_to_json": true, "json_to_csv": true, "fetch": true, "crawl": true, "feed": true,
+	"index": true, "retrieve": true,
+	"assert_contains": true, "assert_regex": true, "assert_json": true,
+	"assert_file": true, "assert_rubric": true,
 }
 
 // Lexer definition
 var scriptLexer = lexer.MustSimple([]lexer.SimpleRule{
-	{Name: "Keyword", Pattern: `(parallel|search|summarize|save|read|stdin|ask|analyze|list|merge|email|calendar|meet|drive_save|doc_create|sheet_append|sheet_create|task|contact_find|youtube_search|youtube_upload|youtube_shorts|image_generate|image_analyze|video_analyze|video_generate|images_to_video|text_to_speech|audio_video_merge|image_audio_merge|maps_trip|form_create|form_responses|translate|places_search)`},
-	{Name: "String", Pattern: `"[^"]*"`},
+	{Name: "Comment", Pattern: `//[^\n]*`},
+	{Name: "String", Pattern: `"(\\.|[^"\\])*"`},
+	{Name: "Number", Pattern: `-?[0-9]+(\.[0-9]+)?`},
+	{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_.]*(-[a-zA-Z0-9_.]+)*`}, // allows model=gpt-4.1-mini
 	{Name: "Pipe", Pattern: `->`},
-	{Name: "LBrace", Pattern: `\{`},
-	{Name: "RBrace", Pattern: `\}`},
+	{Name: "Punct", Pattern: `[@={}]`},
 	{Name: "Whitespace", Pattern: `[ \t\n\r]+`},
 })
 
 // Parser instance
 var Parser = participle.MustBuild[Program](
 	participle.Lexer(scriptLexer),
-	participle.Elide("Whitespace"),
+	participle.Elide("Whitespace", "Comment"),
 	participle.Unquote("String"),
+	participle.UseLookahead(2),
 )
 
 // Parse parses an AgentScript program from a string
 func Parse(input string) (*Program, error) {
-	return Parser.ParseString("", input)
+	program, err := Parser.ParseString("", input)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(program); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// validate rejects unknown commands at parse time
+func validate(program *Program) error {
+	var check func(stmt *Statement) error
+	check = func(stmt *Statement) error {
+		for ; stmt != nil; stmt = stmt.Pipe {
+			if stmt.Parallel != nil {
+				for _, branch := range stmt.Parallel.Branches {
+					if err := check(branch); err != nil {
+						return err
+					}
+				}
+			} else if stmt.Command != nil && !commands[stmt.Command.Action] {
+				return fmt.Errorf("%s: unknown command %q", stmt.Command.Pos, stmt.Command.Action)
+			}
+		}
+		return nil
+	}
+
+	for _, stmt := range program.Statements {
+		if err := check(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Citation is a web source backing generated text
+type Citation struct {
+	ID    int    `json:"id,omitempty"` // run-wide number cited as [id]
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// groundedAnswer is model text backed by live web results
+type groundedAnswer struct {
+	Text    string
+	Sources []Citation
+	Queries []string // the searches the model ran
+}
+
+// String renders the answer followed by its numbered sources
+func (a *groundedAnswer) String() string {
+	if len(a.Sources) == 0 {
+		return a.Text
+	}
+	return strings.TrimSpace(a.Text) + "\n\n" + formatSources(a.Sources)
+}
+
+// formatSources renders citations as a numbered "Sources:" list matching
+// the [n] markers in the text
+func formatSources(sources []Citation) string {
+	return formatCitations("Sources", sources)
+}
+
+// formatCitations renders citations as a numbered list under heading,
+// numbered by id when they have one
+func formatCitations(heading string, sources []Citation) string {
+	var b strings.Builder
+	b.WriteString(heading + ":")
+	for i, src := range sources {
+		n := src.ID
+		if n == 0 {
+			n = i + 1
+		}
+		fmt.Fprintf(&b, "\n[%d] %s - %s", n, citationTitle(src), src.URL)
+	}
+	return b.String()
+}
+
+// groundedSearcher is implemented by providers that can answer a prompt
+// using live web search
+type groundedSearcher interface {
+	GroundedSearch(ctx context.Context, prompt string, opts GenOptions) (*groundedAnswer, error)
+}
+
+// groundingMetadata is the part of a Gemini response describing the
+// searches behind it
+type groundingMetadata struct {
+	WebSearchQueries []string `json:"webSearchQueries"`
+	GroundingChunks  []struct {
+		Web *struct {
+			URI   string `json:"uri"`
+			Title string `json:"title"`
+		} `json:"web"`
+	} `json:"groundingChunks"`
+	GroundingSupports []struct {
+		Segment struct {
+			EndIndex int `json:"endIndex"`
+		} `json:"segment"`
+		GroundingChunkIndices []int `json:"groundingChunkIndices"`
+	} `json:"groundingSupports"`
+}
+
+// GroundedSearch answers the prompt with the google_search tool enabled,
+// returning the text with [n] citation markers and the sources they refer to
+func (c *GeminiClient) GroundedSearch(ctx context.Context, prompt string, opts GenOptions) (*groundedAnswer, error) {
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+	reqBody := generateRequest{
+		Contents: []content{{Parts: []part{{Text: prompt}}}},
+		Tools:    []geminiTool{{GoogleSearch: &struct{}{}}},
+	}
+	if opts.Temperature != nil || opts.MaxTokens > 0 {
+		reqBody.GenerationConfig = &generationConfig{Temperature: opts.Temperature, MaxOutputTokens: opts.MaxTokens}
+	}
+
+	body, err := c.doRaw(ctx, model, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var genResp generateResponse
+	if err := json.Unmarshal(body, &genResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	cand := genResp.Candidates[0]
+	var text strings.Builder
+	for _, p := range cand.Content.Parts {
+		text.WriteString(p.Text)
+	}
+	if cand.GroundingMetadata == nil {
+		return &groundedAnswer{Text: text.String()}, nil
+	}
+	return citeGrounding(text.String(), cand.GroundingMetadata), nil
+}
+
+// citeGrounding numbers the web sources in order of first use (dropping
+// duplicates) and inserts [n] markers after each supported segment
+func citeGrounding(text string, meta *groundingMetadata) *groundedAnswer {
+	answer := &groundedAnswer{Queries: meta.WebSearchQueries}
+
+	number := make(map[int]int) // chunk index -> source number
+	byURL := make(map[string]int)
+	for i, chunk := range meta.GroundingChunks {
+		if chunk.Web == nil || chunk.Web.URI == "" {
+			continue
+		}
+		if n, ok := byURL[chunk.Web.URI]; ok {
+			number[i] = n
+			continue
+		}
+		answer.Sources = append(answer.Sources, Citation{Title: chunk.Web.Title, URL: chunk.Web.URI})
+		number[i] = len(answer.Sources)
+		byURL[chunk.Web.URI] = number[i]
+	}
+
+	// Collect the markers for each segment end, then insert from the back
+	// so earlier offsets stay valid
+	markers := make(map[int][]int)
+	for _, support := range meta.GroundingSupports {
+		end := support.Segment.EndIndex
+		if end <= 0 || end > len(text) || (end < len(text) && !utf8.RuneStart(text[end])) {
+			continue
+		}
+		for _, idx := range support.GroundingChunkIndices {
+			if n, ok := number[idx]; ok && !containsInt(markers[end], n) {
+				markers[end] = append(markers[end], n)
+			}
+		}
+	}
+	ends := make([]int, 0, len(markers))
+	for end := range markers {
+		ends = append(ends, end)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ends)))
+	for _, end := range ends {
+		nums := markers[end]
+		sort.Ints(nums)
+		var mark strings.Builder
+		for _, n := range nums {
+			fmt.Fprintf(&mark, "[%d]", n)
+		}
+		text = text[:end] + mark.String() + text[end:]
+	}
+
+	answer.Text = text
+	return answer
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// GroundedSearch returns the templated reply with placeholder sources
+func (f *FakeClient) GroundedSearch(ctx context.Context, prompt string, opts GenOptions) (*groundedAnswer, error) {
+	id := digest(prompt)
+	return &groundedAnswer{
+		Text: strings.TrimSpace(fakeText(prompt, opts.Format)) + " [1][2]",
+		Sources: []Citation{
+			{Title: "example.com", URL: "https://example.com/" + id},
+			{Title: "example.org", URL: "https://example.org/" + id},
+		},
+	}, nil
+}
+
+// groundedSearch answers prompt from live web results through Gemini's
+// google_search tool. Without Gemini it asks the step's model directly and
+// warns that the answer has no sources.
+func (r *Runtime) groundedSearch(ctx context.Context, prompt string) (*groundedAnswer, error) {
+	searcher, ok := r.providers["gemini"].(groundedSearcher)
+	if !ok {
+		fmt.Println("⚠️  No SEARCH_API_KEY or GEMINI_API_KEY - answering from the model's own knowledge, without sources")
+		text, err := r.llmCall(ctx, prompt)
+		return &groundedAnswer{Text: text}, err
+	}
+
+	release, err := r.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := searcher.GroundedSearch(ctx, prompt, GenOptions{})
+	release()
+	if err != nil {
+		if !shouldFallback(err) {
+			return nil, err
+		}
+		r.recordFallback(ctx, "search", "gemini", "an ungrounded answer", err)
+		text, err := r.llmCall(ctx, prompt)
+		return &groundedAnswer{Text: text}, err
+	}
+	if len(answer.Sources) == 0 {
+		fmt.Println("⚠️  Gemini answered without searching - no sources")
+	} else {
+		fmt.Printf("🔎 Grounded in %d sources\n", len(answer.Sources))
+	}
+	// Number the sources for the whole run so later steps can cite them
+	answer.Sources = r.addSources(ctx, answer.Sources)
+	answer.Text = renumberCitations(answer.Text, answer.Sources)
+	return answer, nil
+}
+
+// mapsSearchURL links to a Google Maps search for a place
+func mapsSearchURL(place string) string {
+	return "https://www.google.com/maps/search/?api=1&query=" + url.QueryEscape(place)
+}
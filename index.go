@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultIndexDir is where index stores document indexes, one directory
+// per index name
+const defaultIndexDir = ".agentscript/indexes"
+
+const (
+	defaultIndexName   = "default"
+	defaultChunkTokens = 300
+	defaultRetrieveK   = 8
+	maxIndexFileSize   = 10 << 20
+	embedBatchSize     = 64
+)
+
+// embeddingModels are the embedding models used unless model= is given
+var embeddingModels = map[string]string{
+	"gemini": "gemini-embedding-001",
+	"openai": "text-embedding-3-small",
+	"ollama": "nomic-embed-text",
+	"fake":   "fake-embedding",
+}
+
+// embedder is implemented by providers that can turn text into vectors.
+// query is set when embedding a search query rather than a document.
+type embedder interface {
+	Embed(ctx context.Context, texts []string, model string, query bool) ([][]float32, error)
+}
+
+// docIndex is an index of local documents. The manifest, chunks included,
+// is stored as index.json and the vectors, in chunk order, as vectors.bin
+// (little-endian float32).
+type docIndex struct {
+	Name     string     `json:"name"`
+	Root     string     `json:"root"`
+	Provider string     `json:"provider"`
+	Model    string     `json:"model"`
+	Dims     int        `json:"dims"`
+	Files    int        `json:"files"`
+	Updated  time.Time  `json:"updated"`
+	Chunks   []docChunk `json:"chunks"`
+
+	vectors [][]float32
+}
+
+// docChunk is a passage of an indexed file
+type docChunk struct {
+	File      string `json:"file"`
+	Page      int    `json:"page,omitempty"` // PDFs: lines are counted within the page
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Heading   string `json:"heading,omitempty"`
+	Text      string `json:"text"`
+	Hash      string `json:"hash"` // of the embedded text, to reuse its vector
+}
+
+// location is the chunk's provenance, e.g. docs/setup.md:12-40
+func (c docChunk) location() string {
+	loc := c.File
+	if c.Page > 0 {
+		loc += fmt.Sprintf(" p.%d", c.Page)
+	}
+	if c.StartLine == c.EndLine {
+		return fmt.Sprintf("%s:%d", loc, c.StartLine)
+	}
+	return fmt.Sprintf("%s:%d-%d", loc, c.StartLine, c.EndLine)
+}
+
+// link points at the chunk's file, with a fragment for the page or lines
+func (c docChunk) link() string {
+	if c.Page > 0 {
+		return fmt.Sprintf("%s#page=%d", c.File, c.Page)
+	}
+	return fmt.Sprintf("%s#L%d-L%d", c.File, c.StartLine, c.EndLine)
+}
+
+// embedText is what gets embedded: the passage with its file and section,
+// which often carry the words a question uses
+func (c docChunk) embedText() string {
+	header := "File: " + c.File
+	if c.Heading != "" {
+		header += "\nSection: " + c.Heading
+	}
+	return header + "\n\n" + c.Text
+}
+
+var indexName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// indexNameOption reads the index name from the given option
+func indexNameOption(cmd *Command, key string) (string, error) {
+	name, ok := cmd.Option(key)
+	if !ok {
+		return defaultIndexName, nil
+	}
+	if !indexName.MatchString(name) {
+		return "", fmt.Errorf("invalid index name %q (use letters, digits, '-', '_' and '.')", name)
+	}
+	return name, nil
+}
+
+// index chunks the Markdown, text, PDF and code files under root, embeds
+// the chunks and stores them as a named index for retrieve. Re-indexing
+// only embeds chunks whose text changed.
+func (r *Runtime) index(ctx context.Context, cmd *Command, root string) (string, error) {
+	if root == "" {
+		return "", fmt.Errorf("index needs a file or directory, e.g. index \"docs/\" name=\"kb\"")
+	}
+	if err := r.checkPath(root, "read"); err != nil {
+		return "", err
+	}
+	name, err := indexNameOption(cmd, "name")
+	if err != nil {
+		return "", err
+	}
+	chunkTokens, err := intOption(cmd, "chunk_size", defaultChunkTokens, 50)
+	if err != nil {
+		return "", err
+	}
+	provider, emb, err := r.embedder(ctx)
+	if err != nil {
+		return "", err
+	}
+	model := embeddingModels[provider]
+	if v, ok := cmd.Option("model"); ok {
+		model = v
+	}
+
+	fmt.Printf("📚 Indexing %s into %q with %s/%s...\n", root, name, provider, model)
+	files, err := indexFiles(root)
+	if err != nil {
+		return "", err
+	}
+
+	idx := &docIndex{Name: name, Root: filepath.ToSlash(root), Provider: provider, Model: model}
+	for _, path := range files {
+		if err := r.checkPath(path, "read"); err != nil {
+			fmt.Printf("   ⚠️  Skipping %s: %v\n", path, err)
+			continue
+		}
+		chunks, err := chunkFile(path, chunkTokens)
+		if err != nil {
+			fmt.Printf("   ⚠️  %s: %v\n", path, err)
+			continue
+		}
+		if len(chunks) > 0 {
+			idx.Files++
+			idx.Chunks = append(idx.Chunks, chunks...)
+		}
+	}
+	if len(idx.Chunks) == 0 {
+		return "", fmt.Errorf("no indexable files found in %s", root)
+	}
+
+	// Vectors from the previous version of the index are reused when the
+	// same model embedded the same text
+	known := make(map[string][]float32)
+	if old, err := loadDocIndex(r.indexDir, name); err == nil && old.Provider == provider && old.Model == model {
+		for i, c := range old.Chunks {
+			known[c.Hash] = old.vectors[i]
+		}
+	}
+
+	idx.vectors = make([][]float32, len(idx.Chunks))
+	var pending []int
+	for i, c := range idx.Chunks {
+		if v, ok := known[c.Hash]; ok {
+			idx.vectors[i] = v
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	for start := 0; start < len(pending); start += embedBatchSize {
+		batch := pending[start:min(start+embedBatchSize, len(pending))]
+		texts := make([]string, len(batch))
+		for j, i := range batch {
+			texts[j] = idx.Chunks[i].embedText()
+		}
+		r.log("Embedding chunks %d-%d of %d", start+1, start+len(batch), len(pending))
+		vectors, err := r.embed(ctx, emb, texts, model, false)
+		if err != nil {
+			return "", err
+		}
+		for j, i := range batch {
+			idx.vectors[i] = vectors[j]
+		}
+	}
+
+	idx.Dims = len(idx.vectors[0])
+	for i, v := range idx.vectors {
+		if len(v) != idx.Dims {
+			return "", fmt.Errorf("embedding of %s has %d dimensions, expected %d", idx.Chunks[i].location(), len(v), idx.Dims)
+		}
+	}
+	idx.Updated = time.Now().UTC()
+	if err := idx.save(r.indexDir); err != nil {
+		return "", err
+	}
+
+	summary := fmt.Sprintf("Indexed %d files into %q: %d chunks (%d embedded, %d unchanged)",
+		idx.Files, name, len(idx.Chunks), len(pending), len(idx.Chunks)-len(pending))
+	fmt.Printf("✅ %s\n", summary)
+	return summary, nil
+}
+
+// retrievedChunk is one result of retrieve
+type retrievedChunk struct {
+	ID      int     `json:"id,omitempty"`
+	File    string  `json:"file"`
+	Page    int     `json:"page,omitempty"`
+	Lines   string  `json:"lines"`
+	Heading string  `json:"heading,omitempty"`
+	Score   float64 `json:"score"`
+	Text    string  `json:"text"`
+}
+
+// retrieve returns the chunks of an index closest to the question as a
+// JSON array, best first, and adds them to the run's sources so that ask
+// can cite them
+func (r *Runtime) retrieve(ctx context.Context, cmd *Command, query, input string) (string, error) {
+	if query == "" {
+		query = strings.TrimSpace(input)
+	}
+	if query == "" {
+		return "", fmt.Errorf("retrieve needs a question")
+	}
+	name, err := indexNameOption(cmd, "index")
+	if err != nil {
+		return "", err
+	}
+	k, err := intOption(cmd, "k", defaultRetrieveK, 1)
+	if err != nil {
+		return "", err
+	}
+	var minScore float64
+	if v, ok := cmd.Option("min_score"); ok {
+		if minScore, err = strconv.ParseFloat(v, 64); err != nil {
+			return "", fmt.Errorf("invalid min_score %q", v)
+		}
+	}
+
+	idx, err := loadDocIndex(r.indexDir, name)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("index %q not found - create it with: index \"docs/\" name=%q", name, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The question must be embedded by the model that embedded the index
+	p, err := r.provider(idx.Provider)
+	if err != nil {
+		return "", fmt.Errorf("index %q was built with %s: %w", name, idx.Provider, err)
+	}
+	emb, ok := p.(embedder)
+	if !ok {
+		return "", fmt.Errorf("provider %s cannot create embeddings", idx.Provider)
+	}
+
+	fmt.Printf("🔎 Retrieving from %q: %s\n", name, query)
+	vectors, err := r.embed(ctx, emb, []string{query}, idx.Model, true)
+	if err != nil {
+		return "", err
+	}
+	q := vectors[0]
+	if len(q) != idx.Dims {
+		return "", fmt.Errorf("query embedding has %d dimensions but index %q has %d - rebuild the index", len(q), name, idx.Dims)
+	}
+
+	type hit struct {
+		chunk int
+		score float64
+	}
+	hits := make([]hit, 0, len(idx.Chunks))
+	for i, v := range idx.vectors {
+		var dot float64
+		for j := range v {
+			dot += float64(v[j]) * float64(q[j])
+		}
+		if dot >= minScore {
+			hits = append(hits, hit{i, dot})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	hits = hits[:min(k, len(hits))]
+
+	sources := make([]Citation, len(hits))
+	for i, h := range hits {
+		c := idx.Chunks[h.chunk]
+		sources[i] = Citation{Title: c.location(), URL: c.link()}
+	}
+	sources = r.addSources(ctx, sources)
+
+	results := make([]retrievedChunk, len(hits))
+	for i, h := range hits {
+		c := idx.Chunks[h.chunk]
+		lines := strconv.Itoa(c.StartLine)
+		if c.EndLine != c.StartLine {
+			lines += "-" + strconv.Itoa(c.EndLine)
+		}
+		results[i] = retrievedChunk{
+			ID:      sources[i].ID,
+			File:    c.File,
+			Page:    c.Page,
+			Lines:   lines,
+			Heading: c.Heading,
+			Score:   math.Round(h.score*1000) / 1000,
+			Text:    c.Text,
+		}
+	}
+	fmt.Printf("✅ %d chunks from %d indexed files\n", len(results), idx.Files)
+	return toJSON(results), nil
+}
+
+// embedder picks the provider that embeds for index: the one the step
+// names, else the default provider, else the first configured of gemini,
+// openai and ollama
+func (r *Runtime) embedder(ctx context.Context) (string, embedder, error) {
+	var name string
+	if cmd := stepFrom(ctx); cmd != nil {
+		if cmd.Provider != "" {
+			name = cmd.Provider
+		} else if v, ok := cmd.Option("provider"); ok {
+			name = v
+		}
+	}
+	if name != "" {
+		p, err := r.provider(name)
+		if err != nil {
+			return "", nil, err
+		}
+		emb, ok := p.(embedder)
+		if !ok {
+			return "", nil, fmt.Errorf("provider %s cannot create embeddings (use gemini, openai or ollama)", name)
+		}
+		return p.Name(), emb, nil
+	}
+
+	for _, name := range []string{r.defaultProvider, "gemini", "openai", "ollama"} {
+		if p, ok := r.providers[name]; ok {
+			if emb, ok := p.(embedder); ok {
+				return p.Name(), emb, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("no provider can create embeddings - set GEMINI_API_KEY or OPENAI_API_KEY, or run Ollama")
+}
+
+// embed embeds texts within the model rate limit and normalizes the
+// vectors to unit length, so that similarity is a dot product
+func (r *Runtime) embed(ctx context.Context, emb embedder, texts []string, model string, query bool) ([][]float32, error) {
+	release, err := r.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	vectors, err := emb.Embed(ctx, texts, model, query)
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+	for _, v := range vectors {
+		var sum float64
+		for _, x := range v {
+			sum += float64(x) * float64(x)
+		}
+		if sum == 0 {
+			continue
+		}
+		norm := float32(1 / math.Sqrt(sum))
+		for i := range v {
+			v[i] *= norm
+		}
+	}
+	return vectors, nil
+}
+
+// indexFiles lists the indexable files under root (or root itself),
+// skipping hidden, .gitignored and node_modules files
+func indexFiles(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	if !info.IsDir() {
+		if docKind(root) == "" {
+			return nil, fmt.Errorf("cannot index %s: unsupported file type", root)
+		}
+		return []string{root}, nil
+	}
+
+	var files []string
+	err = walkFiles(root, 0, false, func(path, rel string, d fs.DirEntry) error {
+		if d.Name() == "node_modules" {
+			return skip(d)
+		}
+		if d.Type().IsRegular() && docKind(path) != "" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// codeExtensions are the source files index reads as code
+var codeExtensions = map[string]bool{
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".java": true, ".kt": true, ".scala": true, ".c": true, ".h": true, ".cc": true,
+	".cpp": true, ".hpp": true, ".cs": true, ".rs": true, ".rb": true, ".php": true,
+	".swift": true, ".m": true, ".sh": true, ".bash": true, ".sql": true, ".lua": true,
+	".r": true, ".ex": true, ".exs": true, ".erl": true, ".hs": true, ".ml": true,
+	".dart": true, ".vue": true, ".svelte": true, ".proto": true, ".yaml": true,
+	".yml": true, ".toml": true, ".as": true,
+}
+
+// docKind classifies a file as "markdown", "text", "pdf" or "code", or
+// returns "" for files index skips
+func docKind(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case ext == ".md" || ext == ".markdown" || ext == ".mdx":
+		return "markdown"
+	case ext == ".txt" || ext == ".text" || ext == ".rst" || ext == ".adoc" || ext == ".org":
+		return "text"
+	case ext == ".pdf":
+		return "pdf"
+	case codeExtensions[ext]:
+		return "code"
+	}
+	return ""
+}
+
+// chunkFile reads a file and splits it into chunks of about maxTokens
+func chunkFile(path string, maxTokens int) ([]docChunk, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxIndexFileSize {
+		return nil, fmt.Errorf("larger than %d MB, skipped", maxIndexFileSize>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.ToSlash(path)
+	kind := docKind(path)
+	if kind == "pdf" {
+		pages, err := pdfPages(data)
+		if err != nil {
+			return nil, err
+		}
+		var chunks []docChunk
+		for i, text := range pages {
+			for _, c := range splitDocument(text, "text", maxTokens) {
+				c.File, c.Page = file, i+1
+				chunks = append(chunks, c)
+			}
+		}
+		return hashChunks(chunks), nil
+	}
+
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1 {
+		return nil, fmt.Errorf("binary file, skipped")
+	}
+	chunks := splitDocument(string(toUTF8Text(data)), kind, maxTokens)
+	for i := range chunks {
+		chunks[i].File = file
+	}
+	return hashChunks(chunks), nil
+}
+
+// toUTF8Text strips a UTF-8 byte order mark and normalizes line endings
+func toUTF8Text(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+}
+
+func hashChunks(chunks []docChunk) []docChunk {
+	for i := range chunks {
+		sum := sha256.Sum256([]byte(chunks[i].embedText()))
+		chunks[i].Hash = hex.EncodeToString(sum[:16])
+	}
+	return chunks
+}
+
+// chunkLine is a line of a file being chunked; lines longer than a chunk
+// are split into several with the same number
+type chunkLine struct {
+	text    string
+	line    int
+	cut     int    // how good a chunk start this is: 0 no, 1 a paragraph, 2 a section
+	heading string // the Markdown section this line is in
+}
+
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// splitDocument splits text into chunks of about maxTokens. Chunks end before
+// Markdown headings and top-level code declarations where possible, else
+// at blank lines; a new section starts a new chunk once the current one is
+// a third full.
+func splitDocument(text, kind string, maxTokens int) []docChunk {
+	budget := maxTokens * 3 // bytes, matching estimateTokens
+	lines := splitChunkLines(text, kind, budget)
+
+	var chunks []docChunk
+	emit := func(a, b int) {
+		for a < b && strings.TrimSpace(lines[a].text) == "" {
+			a++
+		}
+		for b > a && strings.TrimSpace(lines[b-1].text) == "" {
+			b--
+		}
+		if a == b {
+			return
+		}
+		var sb strings.Builder
+		for i := a; i < b; i++ {
+			if i > a && lines[i].line != lines[i-1].line {
+				sb.WriteByte('\n')
+			}
+			sb.WriteString(lines[i].text)
+		}
+		chunks = append(chunks, docChunk{
+			StartLine: lines[a].line,
+			EndLine:   lines[b-1].line,
+			Heading:   lines[a].heading,
+			Text:      sb.String(),
+		})
+	}
+
+	start, size := 0, 0
+	for i, l := range lines {
+		n := len(l.text) + 1
+		full := size+n > budget
+		if i > start && (full || (l.cut == 2 && size >= budget/3)) {
+			cut := i
+			if full && l.cut < 2 {
+				// Back up to the best place to cut in the chunk's second half
+				best := l.cut
+				for j := i - 1; j > start+(i-start)/2; j-- {
+					if lines[j].cut > best {
+						best, cut = lines[j].cut, j
+					}
+				}
+			}
+			emit(start, cut)
+			start, size = cut, 0
+			for _, prev := range lines[cut:i] {
+				size += len(prev.text) + 1
+			}
+		}
+		size += n
+	}
+	emit(start, len(lines))
+	return chunks
+}
+
+// splitChunkLines numbers the lines of text and marks where chunks may start
+func splitChunkLines(text, kind string, budget int) []chunkLine {
+	var lines []chunkLine
+	var headings []string // by level
+	inFence := false
+	afterBlank := true
+
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		cut := 0
+		if afterBlank && trimmed != "" {
+			cut = 1
+		}
+
+		switch kind {
+		case "markdown":
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				inFence = !inFence
+			} else if m := markdownHeading.FindStringSubmatch(line); m != nil && !inFence {
+				level := len(m[1])
+				headings = append(headings[:min(level-1, len(headings))], m[2])
+				cut = 2
+			}
+		case "code":
+			if cut == 1 && line == strings.TrimLeft(line, " \t") && !strings.HasPrefix(trimmed, "}") {
+				cut = 2
+			}
+		}
+		afterBlank = trimmed == ""
+
+		heading := strings.Join(headings, " > ")
+		for first := true; first || line != ""; first = false {
+			piece := line
+			if len(piece) > budget {
+				// Split overlong lines at a space, else mid-word
+				end := strings.LastIndexByte(piece[:budget], ' ') + 1
+				if end <= budget/2 {
+					end = budget
+				}
+				for end < len(piece) && !isRuneStart(piece[end]) {
+					end++
+				}
+				piece = piece[:end]
+			}
+			lines = append(lines, chunkLine{text: piece, line: i + 1, cut: cut, heading: heading})
+			line = line[len(piece):]
+			cut = 0
+		}
+	}
+	return lines
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// loadDocIndex reads a saved index with its vectors
+func loadDocIndex(dir, name string) (*docIndex, error) {
+	if dir == "" {
+		dir = defaultIndexDir
+	}
+	path := filepath.Join(dir, name)
+	data, err := os.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var idx docIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse index %q: %w", name, err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(path, "vectors.bin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vectors of index %q: %w", name, err)
+	}
+	if len(raw) != len(idx.Chunks)*idx.Dims*4 {
+		return nil, fmt.Errorf("index %q is corrupt (vector data does not match its chunks) - rebuild it", name)
+	}
+	idx.vectors = make([][]float32, len(idx.Chunks))
+	for i := range idx.vectors {
+		v := make([]float32, idx.Dims)
+		for j := range v {
+			v[j] = math.Float32frombits(binary.LittleEndian.Uint32(raw[(i*idx.Dims+j)*4:]))
+		}
+		idx.vectors[i] = v
+	}
+	return &idx, nil
+}
+
+// save writes the index. If only one of its files gets written, the size
+// check in loadDocIndex reports the index as corrupt.
+func (idx *docIndex) save(dir string) error {
+	if dir == "" {
+		dir = defaultIndexDir
+	}
+	path := filepath.Join(dir, idx.Name)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	raw := make([]byte, 0, len(idx.vectors)*idx.Dims*4)
+	for _, v := range idx.vectors {
+		for _, x := range v {
+			raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(x))
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(path, "vectors.bin"), raw); err != nil {
+		return fmt.Errorf("failed to write index vectors: %w", err)
+	}
+
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(path, "index.json"), data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// jq runs a jq expression over JSON input with the full jq language
+// (gojq): paths, pipes, arithmetic, string interpolation, if/then/else,
+// reduce/foreach, variables, user-defined functions and the standard
+// builtins. Environment and input-reading builtins are not available.
+//
+// Strings in the output are written raw, like jq -r; everything else as
+// JSON. Each result goes on its own line.
+func (r *Runtime) jq(expr, input string) (string, error) {
+	code, err := compileJQ(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid jq expression: %w", err)
+	}
+
+	var doc any
+	if err := json.Unmarshal([]byte(stripCodeFence(input)), &doc); err != nil {
+		return "", fmt.Errorf("input is not valid JSON: %w", err)
+	}
+
+	results, err := runJQ(code, doc)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(results))
+	for i, v := range results {
+		if s, ok := v.(string); ok {
+			lines[i] = s
+		} else {
+			lines[i] = toJSON(v)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// compileJQ parses and compiles a jq expression
+func compileJQ(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return gojq.Compile(query, gojq.WithEnvironLoader(func() []string { return nil }))
+}
+
+// runJQ collects every output of a compiled expression
+func runJQ(code *gojq.Code, doc any) ([]any, error) {
+	var results []any
+	iter := code.Run(doc)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			return results, nil
+		}
+		if err, ok := v.(error); ok {
+			if halt, ok := err.(*gojq.HaltError); ok && halt.Value() == nil {
+				return results, nil // halt
+			}
+			return nil, fmt.Errorf("jq: %w", err)
+		}
+		results = append(results, v)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJQ(t *testing.T) {
+	const items = `[{"name":"Latte","price":4.5,"tags":["hot"]},{"name":"Tea","price":3,"tags":[]}]`
+	tests := []struct {
+		expr, input, want string
+	}{
+		{".[0].name", items, "Latte"},
+		{".[] | .name", items, "Latte\nTea"},
+		{"[.[] | select(.price < 4) | .name] | tojson", items, `["Tea"]`},
+		{"map(.price * 2) | tojson", items, "[9,6]"},
+		{`.[] | "\(.name): \(.price)"`, items, "Latte: 4.5\nTea: 3"},
+		{`.[] | if .price > 4 then "pricey" else "cheap" end`, items, "pricey\ncheap"},
+		{"reduce .[] as $i (0; . + $i.price)", items, "7.5"},
+		{".[0].price as $p | $p + 1", items, "5.5"},
+		{"first(.[] | .name)", items, "Latte"},
+		{"any(.[]; .price > 4)", items, "true"},
+		{"[limit(1; .[])] | length", items, "1"},
+		{"sort_by(.price) | map(.name) | join(\", \")", items, "Tea, Latte"},
+		{"group_by(.tags | length) | length", items, "2"},
+		{".missing // \"none\"", `{}`, "none"},
+		{"to_entries | map(.key) | tojson", `{"b":1,"a":2}`, `["a","b"]`},
+		{"[.[] | tostring] | tojson", `[1,"x",null]`, `["1","x","null"]`},
+		{".a", "```json\n{\"a\":1}\n```", "1"},
+		{"empty", items, ""},
+	}
+	r := &Runtime{}
+	for _, tt := range tests {
+		got, err := r.jq(tt.expr, tt.input)
+		if err != nil {
+			t.Errorf("jq %q: %v", tt.expr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("jq %q = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestJQErrors(t *testing.T) {
+	tests := []struct {
+		expr, input, want string
+	}{
+		{".[", `{}`, "invalid jq expression"},
+		{".", `not json`, "input is not valid JSON"},
+		{".a + 1", `{"a":"x"}`, "cannot add"},
+		{"env", `{}`, ""},
+	}
+	r := &Runtime{}
+	for _, tt := range tests {
+		got, err := r.jq(tt.expr, tt.input)
+		if tt.want == "" {
+			if err != nil || got != "{}" {
+				t.Errorf("jq %q = %q, %v; want {}", tt.expr, got, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("jq %q error = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
@@ -16,12 +18,84 @@ func main() {
 	natural := flag.Bool("n", false, "Natural language mode (translates input to DSL)")
 	script := flag.String("e", "", "Execute DSL script directly")
 	file := flag.String("f", "", "Execute DSL script from file")
+	runDir := flag.String("run-dir", defaultRunDir, "Directory for run checkpoints")
+	noCheckpoint := flag.Bool("no-checkpoint", false, "Disable step checkpointing")
+	useCache := flag.Bool("cache", os.Getenv("AGENTSCRIPT_CACHE") == "1", "Cache model responses on disk")
+	noCache := flag.Bool("no-cache", false, "Disable the response cache")
+	refresh := flag.Bool("refresh", false, "Ignore cached responses but store fresh ones")
+	cacheDir := flag.String("cache-dir", defaultCacheDir, "Directory for the response cache")
+	indexDir := flag.String("index-dir", defaultIndexDir, "Directory for document indexes")
+	feedDir := flag.String("feed-dir", defaultFeedDir, "Directory for items already returned by feed")
+	workspaceDir := flag.String("workspace", envOr("AGENTSCRIPT_WORKSPACE", "."), "Directory scripts may read and write")
+	allowRules := flag.String("allow", os.Getenv("AGENTSCRIPT_ALLOW"), "Comma-separated globs scripts may use, e.g. \"docs/**,/tmp/out/**\"")
+	denyRules := flag.String("deny", os.Getenv("AGENTSCRIPT_DENY"), "Comma-separated globs scripts may never use (.env and .git always)")
+	outside := flag.String("outside", envOr("AGENTSCRIPT_OUTSIDE", outsidePrompt), "Paths outside the workspace: prompt, deny or allow")
+	cacheTTL := flag.Duration("cache-ttl", defaultCacheTTL, "How long cached responses stay valid (0 = forever)")
+	cacheMaxMB := flag.Int64("cache-max-size", defaultCacheMaxSize, "Maximum cache size in MB (0 = unlimited)")
+	recordFile := flag.String("record", os.Getenv("AGENTSCRIPT_RECORD"), "Record all HTTP traffic to a cassette file")
+	replayFile := flag.String("replay", os.Getenv("AGENTSCRIPT_REPLAY"), "Replay HTTP traffic from a cassette file (no network)")
+	junitFile := flag.String("junit", "", "In test mode, write a JUnit XML report to this file")
+	update := flag.Bool("update", false, "In test mode, re-record test cassettes against the real providers")
+	provider := flag.String("provider", os.Getenv("AGENTSCRIPT_PROVIDER"), "Default model provider: gemini, claude, ollama, openai or fake (offline placeholders)")
+	model := flag.String("model", os.Getenv("AGENTSCRIPT_MODEL"), "Default model for the default provider")
 	flag.Parse()
 
 	ctx := context.Background()
 
+	// Cache management doesn't need API keys or a runtime
+	if flag.Arg(0) == "cache" {
+		runCacheCommand(*cacheDir, *cacheTTL, flag.Arg(1))
+		return
+	}
+
+	// Record/replay swaps the transport used by every HTTP client
+	var cassette *Cassette
+	switch {
+	case *recordFile != "" && *replayFile != "":
+		fmt.Fprintln(os.Stderr, "Error: -record and -replay are mutually exclusive")
+		os.Exit(1)
+	case *recordFile != "":
+		cassette = NewRecordingCassette(*recordFile)
+		httpTransport = cassette
+		// Cached responses would never reach the cassette
+		*noCache = true
+		fmt.Fprintf(os.Stderr, "⏺️  Recording HTTP traffic to %s\n", *recordFile)
+	case *replayFile != "":
+		var err error
+		cassette, err = LoadCassette(*replayFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		httpTransport = cassette
+		fmt.Fprintf(os.Stderr, "▶️  Replaying HTTP traffic from %s\n", *replayFile)
+	}
+
+	workspace, err := NewWorkspace(*workspaceDir, splitRules(*allowRules), splitRules(*denyRules), *outside)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var cache *ResponseCache
+	if (*useCache || *refresh) && !*noCache {
+		var err error
+		cache, err = NewResponseCache(*cacheDir, *cacheTTL, *cacheMaxMB*1024*1024, *refresh)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: response cache disabled: %v\n", err)
+		}
+	}
+
 	// Get API keys and credentials from environment
 	geminiKey := os.Getenv("GEMINI_API_KEY")
+	if geminiKey == "" && cassette.Replaying() && cassette.HasService("gemini") {
+		geminiKey = redacted
+	}
+	claudeKey := os.Getenv("CLAUDE_API_KEY")
+	if claudeKey == "" && cassette.Replaying() && cassette.HasService("claude") {
+		claudeKey = redacted
+	}
+	openaiKey := os.Getenv("OPENAI_API_KEY")
 	googleCreds := os.Getenv("GOOGLE_CREDENTIALS_FILE")
 	if googleCreds == "" {
 		// Check default location
@@ -31,23 +105,51 @@ func main() {
 	}
 
 	// Only require API key for modes that need it
-	if (*natural || *interactive) && geminiKey == "" {
-		fmt.Fprintln(os.Stderr, "Error: GEMINI_API_KEY environment variable required for natural language / interactive mode")
+	if (*natural || *interactive) && geminiKey == "" && claudeKey == "" && openaiKey == "" && *provider == "" {
+		fmt.Fprintln(os.Stderr, "Error: GEMINI_API_KEY, CLAUDE_API_KEY or OPENAI_API_KEY environment variable required for natural language / interactive mode")
 		os.Exit(1)
 	}
 
-	// Create runtime
-	rt, err := NewRuntime(ctx, RuntimeConfig{
+	cfg := RuntimeConfig{
+		Provider:           *provider,
+		Model:              *model,
+		OllamaModel:        os.Getenv("OLLAMA_MODEL"),
+		OpenAIAPIKey:       openaiKey,
+		OpenAIModel:        os.Getenv("OPENAI_MODEL"),
+		OpenAIHeaders:      parseHeaders(os.Getenv("OPENAI_HEADERS")),
 		GeminiAPIKey:       geminiKey,
-		ClaudeAPIKey:       os.Getenv("CLAUDE_API_KEY"),
+		ClaudeAPIKey:       claudeKey,
 		SearchAPIKey:       os.Getenv("SEARCH_API_KEY"),
+		SearchProvider:     os.Getenv("SEARCH_PROVIDER"),
 		GoogleCredsFile:    googleCreds,
 		GoogleTokenFile:    os.Getenv("GOOGLE_TOKEN_FILE"),
 		GitHubClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 		GitHubClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
 		GitHubTokenFile:    os.Getenv("GITHUB_TOKEN_FILE"),
 		Verbose:            *verbose,
-	})
+		Cache:              cache,
+		Cassette:           cassette,
+		Endpoints:          EndpointsFromEnv(),
+		Fallbacks:          FallbacksFromEnv(),
+		ContextTokens:      envInt("AGENTSCRIPT_CONTEXT_TOKENS"),
+		RequestsPerMinute:  envInt("AGENTSCRIPT_RPM"),
+		MaxConcurrency:     envInt("AGENTSCRIPT_MAX_CONCURRENCY"),
+		FeedDir:            *feedDir,
+		IndexDir:           *indexDir,
+		Workspace:          workspace,
+	}
+
+	// Tests create their own runtime per script, sandboxed to the test's
+	// repository unless a workspace was configured
+	if flag.Arg(0) == "test" {
+		if !workspaceConfigured() {
+			cfg.Workspace = nil
+		}
+		os.Exit(runTests(ctx, cfg, flag.Args()[1:], *junitFile, *update))
+	}
+
+	// Create runtime
+	rt, err := NewRuntime(ctx, cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating runtime: %v\n", err)
 		os.Exit(1)
@@ -56,29 +158,42 @@ func main() {
 	// Create translator for natural language mode
 	var trans *Translator
 	if *natural || *interactive {
-		trans, err = NewTranslator(ctx, geminiKey)
+		var llm Provider
+		llm, err = rt.provider("")
+		if err == nil {
+			trans, err = NewTranslator(ctx, llm)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating translator: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
+	opts := runOptions{
+		runDir:     *runDir,
+		checkpoint: !*noCheckpoint,
+	}
+
 	// Execute based on mode
 	switch {
+	case flag.Arg(0) == "resume":
+		resumeRun(ctx, rt, opts, flag.Arg(1))
 	case *script != "":
-		executeScript(ctx, rt, *script)
+		rt.SetStreamOutput(os.Stdout)
+		executeScript(ctx, rt, opts, *script, "")
 	case *file != "":
-		executeFile(ctx, rt, *file)
+		executeFile(ctx, rt, opts, *file)
 	case *interactive:
+		rt.SetStreamOutput(os.Stdout)
 		runREPL(ctx, rt, trans, *natural)
 	default:
 		// Check for piped input or remaining args
 		if flag.NArg() > 0 {
 			input := strings.Join(flag.Args(), " ")
 			if *natural {
-				executeNatural(ctx, rt, trans, input)
+				executeNatural(ctx, rt, trans, opts, input)
 			} else {
-				executeScript(ctx, rt, input)
+				executeScript(ctx, rt, opts, input, "")
 			}
 		} else {
 			printUsage()
@@ -86,32 +201,99 @@ func main() {
 	}
 }
 
-func executeScript(ctx context.Context, rt *Runtime, script string) {
+// runCacheCommand implements "agentscript cache stats|clear"
+func runCacheCommand(dir string, ttl time.Duration, action string) {
+	cache, err := NewResponseCache(dir, ttl, 0, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch action {
+	case "stats":
+		stats, err := cache.Stats()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("📦 Response cache: %s\n", stats.Dir)
+		fmt.Printf("   Entries: %d (%d expired)\n", stats.Entries, stats.Expired)
+		fmt.Printf("   Size:    %.1f MB\n", float64(stats.Bytes)/(1024*1024))
+		if stats.Entries > 0 {
+			fmt.Printf("   Oldest:  %s\n", stats.Oldest.Format(time.RFC3339))
+			fmt.Printf("   Newest:  %s\n", stats.Newest.Format(time.RFC3339))
+		}
+	case "clear":
+		removed, err := cache.Clear()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error clearing cache: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("🧹 Removed %d cached response(s)\n", removed)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: agentscript cache stats|clear")
+		os.Exit(1)
+	}
+}
+
+// runOptions controls how scripts run from the command line are executed
+type runOptions struct {
+	runDir     string
+	checkpoint bool
+}
+
+func executeScript(ctx context.Context, rt *Runtime, opts runOptions, script, scriptPath string) {
 	program, err := Parse(script)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Parse error: %v\n", err)
 		os.Exit(1)
 	}
 
+	var cp *Checkpoint
+	if opts.checkpoint {
+		cp, err = NewCheckpoint(opts.runDir, script, scriptPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: checkpointing disabled: %v\n", err)
+		}
+	}
+
+	runProgram(ctx, rt, program, cp)
+}
+
+// runProgram executes a parsed program, recording progress in cp if set
+func runProgram(ctx context.Context, rt *Runtime, program *Program, cp *Checkpoint) {
+	rt.SetCheckpoint(cp)
+	defer rt.SetCheckpoint(nil)
+
 	result, err := rt.Execute(ctx, program)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Execution error: %v\n", err)
+		if cp != nil {
+			cp.MarkFailed(err)
+			fmt.Fprintf(os.Stderr, "💾 Completed steps were checkpointed. Resume with: agentscript resume %s\n", cp.RunID())
+		}
 		os.Exit(1)
 	}
 
-	fmt.Println(result)
+	if cp != nil {
+		cp.MarkCompleted()
+	}
+
+	if !rt.Streamed() {
+		fmt.Println(result)
+	}
 }
 
-func executeFile(ctx context.Context, rt *Runtime, path string) {
+func executeFile(ctx context.Context, rt *Runtime, opts runOptions, path string) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		os.Exit(1)
 	}
-	executeScript(ctx, rt, string(data))
+	executeScript(ctx, rt, opts, string(data), path)
 }
 
-func executeNatural(ctx context.Context, rt *Runtime, trans *Translator, input string) {
+func executeNatural(ctx context.Context, rt *Runtime, trans *Translator, opts runOptions, input string) {
 	dsl, err := trans.Translate(ctx, input)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Translation error: %v\n", err)
@@ -119,7 +301,72 @@ func executeNatural(ctx context.Context, rt *Runtime, trans *Translator, input s
 	}
 
 	fmt.Printf("📝 DSL: %s\n\n", dsl)
-	executeScript(ctx, rt, dsl)
+	rt.SetTranslated(true)
+	executeScript(ctx, rt, opts, dsl, "")
+}
+
+// resumeRun restarts a previous run, skipping every step that already
+// has a checkpoint. If the script changed since the run was started, the
+// stale checkpoints are discarded and the run starts from the beginning.
+func resumeRun(ctx context.Context, rt *Runtime, opts runOptions, runID string) {
+	if runID == "" {
+		printRuns(opts.runDir)
+		return
+	}
+
+	cp, err := LoadCheckpoint(opts.runDir, runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	script, err := cp.Script()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	program, err := Parse(script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Parse error: %v\n", err)
+		os.Exit(1)
+	}
+
+	stale, err := cp.Validate(script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if stale > 0 {
+		fmt.Printf("⚠️  Script changed since run %s - discarded %d stale checkpoint(s)\n", runID, stale)
+	}
+
+	cp.MarkRunning()
+	fmt.Printf("🔁 Resuming run %s\n", runID)
+	runProgram(ctx, rt, program, cp)
+}
+
+// printRuns lists the runs that can be resumed
+func printRuns(runDir string) {
+	runs, err := ListRuns(runDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing runs: %v\n", err)
+		os.Exit(1)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs found.")
+		return
+	}
+
+	fmt.Println("Usage: agentscript resume <run-id>")
+	fmt.Println()
+	for _, run := range runs {
+		source := run.ScriptPath
+		if source == "" {
+			source = "(inline script)"
+		}
+		fmt.Printf("  %s  %-9s  %s\n", run.RunID, run.Status, source)
+	}
 }
 
 func runREPL(ctx context.Context, rt *Runtime, trans *Translator, naturalMode bool) {
@@ -179,18 +426,60 @@ func runREPL(ctx context.Context, rt *Runtime, trans *Translator, naturalMode bo
 			continue
 		}
 
+		rt.SetTranslated(naturalMode)
 		result, err := rt.Execute(ctx, program)
 		if err != nil {
 			fmt.Printf("❌ Execution error: %v\n", err)
 			continue
 		}
 
-		fmt.Printf("\n%s\n\n", result)
+		if rt.Streamed() {
+			fmt.Println()
+		} else {
+			fmt.Printf("\n%s\n\n", result)
+		}
+	}
+}
+
+// workspaceConfigured reports whether any workspace setting was given
+func workspaceConfigured() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "workspace", "allow", "deny", "outside":
+			set = true
+		}
+	})
+	for _, name := range []string{"AGENTSCRIPT_WORKSPACE", "AGENTSCRIPT_ALLOW", "AGENTSCRIPT_DENY", "AGENTSCRIPT_OUTSIDE"} {
+		set = set || os.Getenv(name) != ""
 	}
+	return set
+}
+
+// envOr reads a setting, falling back to def when it is unset
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt reads a non-negative integer setting, warning about bad values
+func envInt(name string) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring %s=%q (expected a non-negative number)\n", name, v)
+		return 0
+	}
+	return n
 }
 
 func printUsage() {
-	fmt.Println(`AgentScript - A DSL for commanding AI agents
+	fmt.Print(`AgentScript - A DSL for commanding AI agents
 
 Usage:
   agentscript [flags] [script]
@@ -198,6 +487,9 @@ Usage:
   agentscript -n "natural language command"
   agentscript -e 'SEARCH "topic" -> SUMMARIZE'
   agentscript -f script.as
+  agentscript resume <run-id> # Resume a failed run from its checkpoints
+  agentscript cache stats|clear
+  agentscript test [./...]    # Run *_test.as scripts (fake or replayed providers)
 
 Flags:
   -i    Interactive REPL mode
@@ -205,19 +497,68 @@ Flags:
   -e    Execute DSL script directly
   -f    Execute DSL script from file
   -v    Verbose output
+  -run-dir        Directory for run checkpoints (default .agentscript/runs)
+  -no-checkpoint  Do not checkpoint step outputs
+  -cache          Cache model responses on disk (or set AGENTSCRIPT_CACHE=1)
+  -no-cache       Disable the response cache
+  -refresh        Ignore cached responses but store fresh ones
+  -cache-ttl      How long cached responses stay valid (default 168h)
+  -cache-max-size Maximum cache size in MB (default 500)
+  -feed-dir       Directory where FEED remembers returned items (default .agentscript/feeds)
+  -index-dir      Directory for INDEX document indexes (default .agentscript/indexes)
+  -workspace dir  Directory scripts may read and write (default: current directory)
+  -allow globs    Only these paths, e.g. "docs/**,/tmp/out/**" (may be outside the workspace)
+  -deny globs     Never these paths; .env and .git are always denied
+  -outside mode   Other paths outside the workspace: prompt (default), deny or allow
+  -record file    Record all HTTP traffic (secrets redacted) to a cassette
+  -replay file    Serve HTTP traffic from a cassette - runs fully offline
+  -provider name  Default model provider: gemini, claude, ollama, openai or fake
+  -model name     Default model for the default provider (or set AGENTSCRIPT_MODEL)
+  -junit file     In test mode, write a JUnit XML report
+  -update         In test mode, re-record each test's cassette with real providers
 
 Environment:
-  GEMINI_API_KEY   Required. Your Gemini API key
-  SEARCH_API_KEY   Optional. API key for web search (SerpAPI, etc.)
+  GEMINI_API_KEY   Your Gemini API key (required for media commands)
+  CLAUDE_API_KEY   Optional. Your Claude API key
+  OLLAMA_MODEL     Optional. Local model for the ollama provider (default llama3.2)
+  OPENAI_API_KEY   Optional. Key for OpenAI or an OpenAI-compatible gateway
+  OPENAI_MODEL     Optional. Model for the openai provider (default gpt-4o-mini)
+  OPENAI_HEADERS   Optional. Extra gateway headers: "Name: value; Other: value"
+  AGENTSCRIPT_FALLBACK_<TEXT|VISION|IMAGE|VIDEO|TTS>
+                   Optional. Providers to fall back to on quota/server errors,
+                   e.g. AGENTSCRIPT_FALLBACK_TEXT=claude,ollama
+  AGENTSCRIPT_CONTEXT_TOKENS
+                   Optional. Context window to assume for every model; larger
+                   inputs are chunked (default: per provider)
+  AGENTSCRIPT_RPM  Optional. Max model requests per minute
+  AGENTSCRIPT_WORKSPACE, AGENTSCRIPT_ALLOW, AGENTSCRIPT_DENY, AGENTSCRIPT_OUTSIDE
+                   Optional. Defaults for -workspace, -allow, -deny and -outside
+  AGENTSCRIPT_MAX_CONCURRENCY
+                   Optional. Max model requests in flight (chunks: default 4)
+  SEARCH_PROVIDER  Optional. Web search backend: serpapi (default), brave, bing
+                   or searxng (self-hosted, set SEARCH_BASE_URL)
+  SEARCH_API_KEY   Optional. API key for the search backend; without a backend
+                   search uses Gemini's Google Search grounding
+  GEMINI_BASE_URL, CLAUDE_BASE_URL, OLLAMA_BASE_URL, OPENAI_BASE_URL,
+  GITHUB_API_URL, GITHUB_SERVER_URL, SEARCH_BASE_URL, GOOGLE_<SERVICE>_ENDPOINT
+                   Optional. Override API endpoints (proxies, mocks, GHE)
 
 DSL Commands:
   SEARCH "query"     Search the web
   SUMMARIZE          Summarize input content
   SAVE "file"        Save to file
-  READ "file"        Read from file
+  READ "file"        Read a file (PDF, DOCX, XLSX... converted) or a glob "src/**/*.go"
+  FETCH "url"        Download a web page as Markdown text
+  CRAWL "url"        Read a site (depth=2 max_pages=50) as a list of pages
+  FEED "url"         New RSS/Atom items since the last run (since=24h limit=10)
+  INDEX "docs/"      Embed local docs, code and PDFs into an index (name="kb")
+  RETRIEVE "question" Top passages of an index with file:line sources (index="kb" k=8)
   ASK "question"     Ask a question with context
   ANALYZE "focus"    Analyze content
-  LIST "path"        List directory contents
+  EXTRACT "fields"   Extract JSON records (field list or JSON schema)
+  JQ "expr"          Transform JSON (also GREP, FILTER, HEAD, TAIL, SPLIT,
+                     JOIN, REPLACE, TEMPLATE, CSV_TO_JSON, JSON_TO_CSV)
+  LIST "path"        List a directory (recursive=true match="*.go" format="json")
   MERGE              Combine parallel results
   EMAIL "address"    Send email with content
 
@@ -230,6 +571,10 @@ Parallel Execution:
 Pipe commands with ->:
   SEARCH "golang tutorials" -> SUMMARIZE -> SAVE "notes.md"
 
+Providers and options:
+  ask@claude "question" temperature=0.2
+  summarize model="gemini-2.5-pro" max_tokens=500
+
 Examples:
   agentscript -e 'READ "doc.txt" -> SUMMARIZE'
   agentscript -e 'PARALLEL { SEARCH "Google" -> ANALYZE "strengths" SEARCH "Microsoft" -> ANALYZE "strengths" } -> MERGE -> ASK "who is winning?"'
@@ -239,7 +584,7 @@ Examples:
 }
 
 func printHelp() {
-	fmt.Println(`
+	fmt.Print(`
 REPL Commands:
   :help, :h   Show this help
   :mode, :m   Toggle natural language / DSL mode  
@@ -249,10 +594,12 @@ DSL Syntax:
   SEARCH "query"     - Search the web
   SUMMARIZE          - Summarize piped content
   SAVE "filename"    - Save to file
-  READ "filename"    - Read from file
+  READ "filename"    - Read a file, or every file matching a glob
+  FETCH "url"        - Download a web page, PDF or text file
+  CRAWL "url"        - Read a whole site section as JSON pages
   ASK "question"     - Ask with context
   ANALYZE "focus"    - Analyze content
-  LIST "path"        - List directory
+  LIST "path"        - List a directory (recursive=true for a tree)
   MERGE              - Combine parallel results
   EMAIL "address"    - Send email
 
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// contextWindows are the default context sizes, in tokens, of each
+// provider's models. AGENTSCRIPT_CONTEXT_TOKENS overrides them, e.g. for
+// an Ollama model run with a larger num_ctx.
+var contextWindows = map[string]int{
+	"gemini": 1_048_576,
+	"claude": 200_000,
+	"openai": 128_000,
+	"ollama": 4_096,
+	"fake":   1_048_576,
+}
+
+// defaultMapWorkers is how many chunks are processed at once when
+// AGENTSCRIPT_MAX_CONCURRENCY is not set
+const defaultMapWorkers = 4
+
+// tokenCounter is implemented by providers that can count tokens exactly
+type tokenCounter interface {
+	CountTokens(ctx context.Context, text, model string) (int, error)
+}
+
+// estimateTokens is a local, deliberately generous token estimate: about
+// three bytes per token, which covers English prose (about four
+// characters per token) and counts each CJK character as one token
+func estimateTokens(text string) int {
+	return (len(text) + 2) / 3
+}
+
+// inputBudget is how many tokens of input a single call to p may carry,
+// leaving a quarter of the context window for instructions and the reply
+func (r *Runtime) inputBudget(p Provider) int {
+	window := r.contextTokens
+	if window == 0 {
+		window = contextWindows[p.Name()]
+	}
+	if window == 0 {
+		window = 32_000
+	}
+	return window * 3 / 4
+}
+
+// countTokens estimates text's size in tokens, asking the provider for an
+// exact count only when the estimate is close to the budget
+func (r *Runtime) countTokens(ctx context.Context, p Provider, opts GenOptions, text string, budget int) int {
+	estimate := estimateTokens(text)
+	if estimate < budget/2 || estimate > budget*2 {
+		return estimate
+	}
+	counter, ok := r.providers[p.Name()].(tokenCounter)
+	if !ok {
+		return estimate
+	}
+	n, err := counter.CountTokens(ctx, text, opts.Model)
+	if err != nil {
+		r.log("Token count failed, using estimate: %v", err)
+		return estimate
+	}
+	return n
+}
+
+// mapReduce describes how to process an input too large for one call
+type mapReduce struct {
+	// mapPrompt builds the prompt for chunk i (1-based) of n
+	mapPrompt func(chunk string, i, n int) string
+	// reducePrompt combines the mapped results; nil concatenates them
+	reducePrompt func(parts string) string
+	// overlap repeats the end of each chunk at the start of the next so
+	// nothing is lost at the boundaries
+	overlap bool
+}
+
+// llmOverInput sends prompt to the current step's model, or, when input
+// does not fit in the model's context window, splits input into chunks,
+// maps each one in parallel and reduces the results. The final call
+// streams like llmCall.
+func (r *Runtime) llmOverInput(ctx context.Context, prompt, input string, mr mapReduce) (string, error) {
+	p, opts, err := r.llm(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	budget := r.inputBudget(p)
+	tokens := r.countTokens(ctx, p, opts, input, budget)
+	if tokens <= budget {
+		return r.llmCall(ctx, prompt)
+	}
+
+	// Chunks are sized with the local estimate so they fit in one call
+	size := budget * 3
+	overlap := 0
+	if mr.overlap {
+		overlap = size / 10
+	}
+	chunks := chunkText(input, size, overlap)
+	fmt.Printf("✂️  Input is ~%d tokens, over the %d-token budget for %s - processing %d chunks\n", tokens, budget, p.Name(), len(chunks))
+
+	results, err := r.mapChunks(ctx, p, opts, chunks, mr.mapPrompt)
+	if err != nil {
+		return "", err
+	}
+	if mr.reducePrompt == nil {
+		return joinChunks(chunks, results)
+	}
+	parts, err := keepParts(results)
+	if err != nil {
+		return "", err
+	}
+
+	// Combine in groups until the partial results fit in one call
+	const separator = "\n\n---\n\n"
+	for len(parts) > 1 && estimateTokens(strings.Join(parts, separator)) > budget {
+		groups := groupParts(parts, size, separator)
+		if len(groups) == len(parts) {
+			break
+		}
+		fmt.Printf("🔁 Combining %d partial results in %d groups\n", len(parts), len(groups))
+		if results, err = r.mapChunks(ctx, p, opts, groups, func(group string, _, _ int) string {
+			return mr.reducePrompt(group)
+		}); err != nil {
+			return "", err
+		}
+		if parts, err = keepParts(results); err != nil {
+			return "", err
+		}
+	}
+	return r.llmCall(ctx, mr.reducePrompt(strings.Join(parts, separator)))
+}
+
+// mapChunks runs the map prompt over every chunk, a few at a time, and
+// returns the trimmed replies in chunk order. The first failure cancels
+// the chunks still running.
+func (r *Runtime) mapChunks(ctx context.Context, p Provider, opts GenOptions, chunks []string, prompt func(chunk string, i, n int) string) ([]string, error) {
+	workers := r.mapWorkers
+	if workers <= 0 {
+		workers = defaultMapWorkers
+	}
+
+	results := make([]string, len(chunks))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	var done int
+	var mu sync.Mutex
+
+	for i, chunk := range chunks {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			result, err := p.Generate(gctx, r.citing(gctx, prompt(chunk, i+1, len(chunks))), opts)
+			if err != nil {
+				return fmt.Errorf("chunk %d of %d failed: %w", i+1, len(chunks), err)
+			}
+			results[i] = strings.TrimSpace(result)
+			mu.Lock()
+			done++
+			fmt.Printf("   ✓ chunk %d/%d\n", done, len(chunks))
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// keepParts drops empty replies and replies of NONE
+func keepParts(results []string) ([]string, error) {
+	var parts []string
+	for _, result := range results {
+		if result != "" && result != "NONE" {
+			parts = append(parts, result)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no chunk produced a result")
+	}
+	return parts, nil
+}
+
+// joinChunks puts processed chunks back together, each followed by the
+// whitespace its original chunk ended with, so paragraphs and lines
+// break where they did in the input
+func joinChunks(chunks, results []string) (string, error) {
+	if _, err := keepParts(results); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, result := range results {
+		b.WriteString(result)
+		if i < len(results)-1 {
+			chunk := chunks[i]
+			b.WriteString(chunk[len(strings.TrimRightFunc(chunk, unicode.IsSpace)):])
+		}
+	}
+	return b.String(), nil
+}
+
+// chunkText splits text into pieces of at most size bytes, breaking at
+// paragraph, line, sentence or word boundaries where possible. Each chunk
+// after the first starts up to overlap bytes before the previous one ended.
+func chunkText(text string, size, overlap int) []string {
+	var chunks []string
+	for start := 0; start < len(text); {
+		end := start + size
+		if end >= len(text) {
+			chunks = append(chunks, text[start:])
+			break
+		}
+		end = breakPoint(text, start+size/2, end)
+		chunks = append(chunks, text[start:end])
+
+		next := end
+		if overlap > 0 {
+			next = end - overlap
+			// Start the overlap at a word boundary
+			if i := strings.IndexAny(text[next:end], " \n"); i != -1 {
+				next += i + 1
+			}
+			for next < end && !utf8.RuneStart(text[next]) {
+				next++
+			}
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// breakPoint returns the last natural break in text[lo:hi], or hi
+// adjusted to a character boundary when there is none
+func breakPoint(text string, lo, hi int) int {
+	window := text[lo:hi]
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if i := strings.LastIndex(window, sep); i != -1 {
+			return lo + i + len(sep)
+		}
+	}
+	for hi > lo && !utf8.RuneStart(text[hi]) {
+		hi--
+	}
+	return hi
+}
+
+// groupParts packs consecutive parts into groups of at most size bytes
+func groupParts(parts []string, size int, separator string) []string {
+	var groups []string
+	var current []string
+	length := 0
+	for _, part := range parts {
+		if len(current) > 0 && length+len(separator)+len(part) > size {
+			groups = append(groups, strings.Join(current, separator))
+			current, length = nil, 0
+		}
+		current = append(current, part)
+		length += len(part) + len(separator)
+	}
+	if len(current) > 0 {
+		groups = append(groups, strings.Join(current, separator))
+	}
+	return groups
+}
+
+// summarize summarizes the input, in parts when it is too large
+func (r *Runtime) summarize(ctx context.Context, input string) (string, error) {
+	return r.llmOverInput(ctx, "Summarize the following content concisely:\n\n"+input, input, mapReduce{
+		mapPrompt: func(chunk string, i, n int) string {
+			return fmt.Sprintf("This is part %d of %d of a longer document. Summarize it concisely, keeping key facts, names and numbers:\n\n%s", i, n, chunk)
+		},
+		reducePrompt: func(parts string) string {
+			return "These are summaries of consecutive parts of one document. Combine them into a single concise summary of the whole document:\n\n" + parts
+		},
+		overlap: true,
+	})
+}
+
+// analyze analyzes the input with an optional focus, in parts when it is
+// too large
+func (r *Runtime) analyze(ctx context.Context, focus, input string) (string, error) {
+	focusing := ""
+	if focus != "" {
+		focusing = " focusing on " + focus
+	}
+	return r.llmOverInput(ctx, "Analyze the following"+focusing+":\n\n"+input, input, mapReduce{
+		mapPrompt: func(chunk string, i, n int) string {
+			return fmt.Sprintf("This is part %d of %d of a longer document. Analyze it%s, noting findings that matter for the document as a whole:\n\n%s", i, n, focusing, chunk)
+		},
+		reducePrompt: func(parts string) string {
+			return "These are analyses of consecutive parts of one document. Combine them into a single analysis of the whole document" + focusing + ":\n\n" + parts
+		},
+		overlap: true,
+	})
+}
+
+// ask answers a question with the input as context. A large context is
+// first narrowed to the notes relevant to the question.
+func (r *Runtime) ask(ctx context.Context, question, input string) (string, error) {
+	if input == "" {
+		return r.llmCall(ctx, question)
+	}
+	return r.llmOverInput(ctx, question+"\n\nContext:\n"+input, input, mapReduce{
+		mapPrompt: func(chunk string, i, n int) string {
+			return fmt.Sprintf("Question: %s\n\nThis is part %d of %d of the context for the question. Extract everything in it that helps answer the question, keeping key facts and figures. If nothing is relevant, reply with NONE.\n\n%s", question, i, n, chunk)
+		},
+		reducePrompt: func(parts string) string {
+			return question + "\n\nContext (notes taken from a longer document):\n" + parts
+		},
+		overlap: true,
+	})
+}
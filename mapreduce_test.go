@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upperProvider "translates" by upper-casing the text after the prompt's
+// blank line, failing on chunks that contain "fail"
+type upperProvider struct {
+	*FakeClient
+	calls atomic.Int32
+}
+
+func (p *upperProvider) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	p.calls.Add(1)
+	_, text, _ := strings.Cut(prompt, "\n\n")
+	if strings.Contains(text, "fail") {
+		return "", errors.New("model error")
+	}
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(10 * time.Millisecond):
+	}
+	return "  " + strings.ToUpper(text) + "\n", nil
+}
+
+func TestJoinChunksKeepsSeparators(t *testing.T) {
+	input := "First paragraph here.\n\nSecond line one\nsecond line two. Third sentence goes on and on"
+	chunks := chunkText(input, 24, 0)
+	if len(chunks) < 4 {
+		t.Fatalf("chunkText gave %d chunks, want at least 4: %q", len(chunks), chunks)
+	}
+
+	r := &Runtime{mapWorkers: 2}
+	p := &upperProvider{FakeClient: NewFakeClient("")}
+	results, err := r.mapChunks(context.Background(), p, GenOptions{}, chunks, func(chunk string, _, _ int) string {
+		return "Translate:\n\n" + chunk
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := joinChunks(chunks, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ToUpper(input); got != want {
+		t.Errorf("joinChunks = %q, want %q", got, want)
+	}
+}
+
+func TestMapChunksStopsAfterFailure(t *testing.T) {
+	chunks := []string{"fail now"}
+	for i := 0; i < 20; i++ {
+		chunks = append(chunks, "fine")
+	}
+
+	r := &Runtime{mapWorkers: 4}
+	p := &upperProvider{FakeClient: NewFakeClient("")}
+	_, err := r.mapChunks(context.Background(), p, GenOptions{}, chunks, func(chunk string, _, _ int) string {
+		return "Translate:\n\n" + chunk
+	})
+	if err == nil || !strings.Contains(err.Error(), "chunk 1 of 21 failed: model error") {
+		t.Fatalf("mapChunks error = %v, want chunk 1's failure", err)
+	}
+	if calls := p.calls.Load(); calls > 8 {
+		t.Errorf("%d chunks were sent after the first failed, want the rest skipped", calls)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const (
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "llama3.2"
+)
+
+// OllamaClient talks to a local Ollama server (or anything serving the same
+// /api/generate API), so prompts and data never leave the machine
+type OllamaClient struct {
+	model      string
+	baseURL    string
+	httpClient *http.Client
+	cache      *ResponseCache
+}
+
+// NewOllamaClient creates a client for a local model
+func NewOllamaClient(model string) *OllamaClient {
+	if model == "" {
+		model = defaultOllamaModel
+	}
+	return &OllamaClient{
+		model:      model,
+		baseURL:    defaultOllamaBaseURL,
+		httpClient: newHTTPClient(),
+	}
+}
+
+// ollamaRequest is the body of POST /api/generate
+type ollamaRequest struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	Stream  bool           `json:"stream"`
+	Images  []string       `json:"images,omitempty"`
+	Format  any            `json:"format,omitempty"`
+	Options map[string]any `json:"options,omitempty"`
+}
+
+// ollamaChunk is one response object; streamed responses are a sequence
+// of them, one JSON object per line
+type ollamaChunk struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error"`
+}
+
+// Name implements Provider
+func (c *OllamaClient) Name() string { return "ollama" }
+
+// Generate sends a prompt to the local model
+func (c *OllamaClient) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return c.generate(ctx, c.request(prompt, opts), nil)
+}
+
+// Stream sends a prompt and calls onChunk with each token as it arrives
+func (c *OllamaClient) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	return c.generate(ctx, c.request(prompt, opts), onChunk)
+}
+
+// GenerateWithFiles sends images along with the prompt (multimodal models
+// such as llava). Video is not supported.
+func (c *OllamaClient) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	req := c.request(prompt, opts)
+	for _, path := range files {
+		mimeType := getMimeType(path)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return "", fmt.Errorf("ollama cannot analyze %s files (%s)", mimeType, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		req.Images = append(req.Images, base64.StdEncoding.EncodeToString(data))
+	}
+	return c.generate(ctx, req, nil)
+}
+
+// GenerateStructured constrains the output to the JSON schema
+func (c *OllamaClient) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	req := c.request(prompt, opts)
+	req.Format = schema
+	return c.generate(ctx, req, nil)
+}
+
+func (c *OllamaClient) request(prompt string, opts GenOptions) ollamaRequest {
+	req := ollamaRequest{Model: c.model, Prompt: prompt}
+	if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	if opts.Temperature != nil || opts.MaxTokens > 0 {
+		req.Options = map[string]any{}
+		if opts.Temperature != nil {
+			req.Options["temperature"] = *opts.Temperature
+		}
+		if opts.MaxTokens > 0 {
+			req.Options["num_predict"] = opts.MaxTokens
+		}
+	}
+	return req
+}
+
+// generate posts to /api/generate. With onChunk set the response is
+// streamed; otherwise it is read in one piece and may come from the cache.
+func (c *OllamaClient) generate(ctx context.Context, req ollamaRequest, onChunk func(string)) (string, error) {
+	req.Stream = onChunk != nil
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	key := cacheKey("ollama", req.Model, "generate", jsonBody)
+	if !req.Stream {
+		if cached, ok := c.cache.Get(key); ok {
+			var chunk ollamaChunk
+			if err := json.Unmarshal(cached, &chunk); err == nil {
+				return chunk.Response, nil
+			}
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/generate", bytes.NewReader(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return "", &UnavailableError{"ollama", fmt.Sprintf("cannot reach Ollama at %s - is it running? (start it with: ollama serve)", c.baseURL)}
+		}
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr ollamaChunk
+		json.Unmarshal(body, &apiErr)
+		if resp.StatusCode == http.StatusNotFound && strings.Contains(apiErr.Error, "not found") {
+			return "", fmt.Errorf("model %q is not pulled - run: ollama pull %s", req.Model, req.Model)
+		}
+		message := apiErr.Error
+		if message == "" {
+			message = string(body)
+		}
+		return "", &APIError{Provider: "Ollama", StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if !req.Stream {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(body, &chunk); err != nil {
+			return "", fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+		c.cache.Put(key, "ollama", req.Model, "generate", body)
+		return chunk.Response, nil
+	}
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return text.String(), fmt.Errorf("failed to parse stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return text.String(), fmt.Errorf("Ollama error: %s", chunk.Error)
+		}
+		text.WriteString(chunk.Response)
+		onChunk(chunk.Response)
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return text.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+	return text.String(), nil
+}
+
+// Embed returns an embedding per text from /api/embed, using an embedding
+// model such as nomic-embed-text
+func (c *OllamaClient) Embed(ctx context.Context, texts []string, model string, query bool) ([][]float32, error) {
+	jsonBody, err := json.Marshal(map[string]any{"model": model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/embed", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, &UnavailableError{"ollama", fmt.Sprintf("cannot reach Ollama at %s - is it running? (start it with: ollama serve)", c.baseURL)}
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var embedResp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+		Error      string      `json:"error"`
+	}
+	json.Unmarshal(body, &embedResp)
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusNotFound && strings.Contains(embedResp.Error, "not found") {
+			return nil, fmt.Errorf("model %q is not pulled - run: ollama pull %s", model, model)
+		}
+		message := embedResp.Error
+		if message == "" {
+			message = string(body)
+		}
+		return nil, &APIError{Provider: "Ollama", StatusCode: resp.StatusCode, Message: message}
+	}
+	if len(embedResp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embedResp.Embeddings))
+	}
+	return embedResp.Embeddings, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIModel   = "gpt-4o-mini"
+)
+
+// OpenAIClient talks to any service exposing the OpenAI chat completions
+// API: OpenAI itself, internal gateways, vLLM, llama.cpp server, etc.
+type OpenAIClient struct {
+	apiKey     string
+	model      string
+	baseURL    string
+	headers    map[string]string // extra headers sent with every request
+	httpClient *http.Client
+	cache      *ResponseCache
+}
+
+// NewOpenAIClient creates a chat completions client
+func NewOpenAIClient(apiKey, model string) *OpenAIClient {
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	return &OpenAIClient{
+		apiKey:     apiKey,
+		model:      model,
+		baseURL:    defaultOpenAIBaseURL,
+		headers:    map[string]string{},
+		httpClient: newHTTPClient(),
+	}
+}
+
+// parseHeaders parses "Name: value; Other: value" into a header map
+func parseHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(pair, ":")
+		if ok && strings.TrimSpace(name) != "" {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"` // a string or a list of content parts
+}
+
+// Name implements Provider
+func (c *OpenAIClient) Name() string { return "openai" }
+
+// Generate sends a prompt as a single user message
+func (c *OpenAIClient) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	return c.chat(ctx, prompt, opts, nil, nil)
+}
+
+// Stream sends a prompt and calls onChunk with text as it arrives
+func (c *OpenAIClient) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	return c.chat(ctx, prompt, opts, nil, onChunk)
+}
+
+// GenerateWithFiles sends images as data URLs along with the prompt.
+// Video is not part of the chat completions API.
+func (c *OpenAIClient) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	content := []map[string]any{{"type": "text", "text": prompt}}
+	for _, path := range files {
+		mimeType := getMimeType(path)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return "", fmt.Errorf("openai cannot analyze %s files (%s)", mimeType, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		content = append(content, map[string]any{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url": "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+			},
+		})
+	}
+	return c.chat(ctx, content, opts, nil, nil)
+}
+
+// GenerateStructured uses JSON mode. With a schema the reply is constrained
+// to it; without one any JSON object is accepted.
+func (c *OpenAIClient) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	format := map[string]any{"type": "json_object"}
+	if schema != nil {
+		format = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   "response",
+				"schema": schema,
+			},
+		}
+	}
+	return c.chat(ctx, prompt, opts, format, nil)
+}
+
+// chat posts to /chat/completions and returns the first choice's text,
+// streaming it to onChunk when set
+func (c *OpenAIClient) chat(ctx context.Context, content any, opts GenOptions, responseFormat map[string]any, onChunk func(string)) (string, error) {
+	model := c.model
+	if opts.Model != "" {
+		model = opts.Model
+	}
+
+	reqBody := map[string]any{
+		"model":    model,
+		"messages": []openAIMessage{{Role: "user", Content: content}},
+	}
+	if opts.Temperature != nil {
+		reqBody["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		reqBody["max_tokens"] = opts.MaxTokens
+	}
+	if responseFormat != nil {
+		reqBody["response_format"] = responseFormat
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	key := cacheKey("openai", model, "chat/completions", jsonBody)
+	body, ok := c.cache.Get(key)
+	if !ok && onChunk != nil {
+		reqBody["stream"] = true
+		streamBody, err := json.Marshal(reqBody)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal request: %w", err)
+		}
+		text, err := c.stream(ctx, streamBody, onChunk)
+		if err != nil {
+			return text, err
+		}
+		// Cache the assembled reply like a non-streamed response
+		body, _ = json.Marshal(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"content": text}}},
+		})
+		c.cache.Put(key, "openai", model, "chat/completions", body)
+		return text, nil
+	}
+	if !ok {
+		resp, err := c.post(ctx, "/chat/completions", jsonBody)
+		if err != nil {
+			return "", err
+		}
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+	}
+
+	text, err := openAIText(body)
+	if err != nil {
+		return "", err
+	}
+	// Only replies that parse are cached, so an error is never replayed
+	if !ok {
+		c.cache.Put(key, "openai", model, "chat/completions", body)
+	}
+	if onChunk != nil {
+		onChunk(text)
+	}
+	return text, nil
+}
+
+// Embed returns an embedding per text from the /embeddings endpoint
+func (c *OpenAIClient) Embed(ctx context.Context, texts []string, model string, query bool) ([][]float32, error) {
+	jsonBody, err := json.Marshal(map[string]any{"model": model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	resp, err := c.post(ctx, "/embeddings", jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var embedResp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range embedResp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("no embedding returned for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// stream reads a streamed chat completion, passing each delta to onChunk
+func (c *OpenAIClient) stream(ctx context.Context, jsonBody []byte, onChunk func(string)) (string, error) {
+	resp, err := c.post(ctx, "/chat/completions", jsonBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	err = readSSE(resp.Body, func(_ string, data []byte) error {
+		if string(data) == "[DONE]" {
+			return nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream: %w", err)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			onChunk(chunk.Choices[0].Delta.Content)
+		}
+		return nil
+	})
+	return text.String(), err
+}
+
+// openAIText extracts the first choice's text from a chat completion
+func openAIText(body []byte) (string, error) {
+	var chatResp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+				Refusal string `json:"refusal"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	if msg := chatResp.Choices[0].Message; msg.Content == "" && msg.Refusal != "" {
+		return "", fmt.Errorf("model refused: %s", msg.Refusal)
+	}
+	return chatResp.Choices[0].Message.Content, nil
+}
+
+// post sends a request and returns the successful response
+func (c *OpenAIClient) post(ctx context.Context, path string, jsonBody []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := string(body)
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return nil, &APIError{Provider: "OpenAI", StatusCode: resp.StatusCode, Message: message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,945 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// A small, dependency-free PDF text extractor. It reads the page content
+// streams in order and decodes the text shown with each font, using the
+// font's ToUnicode map when it has one. It does not handle encrypted files
+// or scanned pages, which have no text layer.
+
+// PDF object types; numbers are float64, booleans bool and null nil
+type (
+	pdfDict    map[string]any
+	pdfArray   []any
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte // still encoded
+	}
+)
+
+// maxPDFDepth bounds reference chains and page tree nesting
+const maxPDFDepth = 32
+
+// isPDF reports whether data starts like a PDF file
+func isPDF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\r\n\t "), []byte("%PDF-"))
+}
+
+// pdfText extracts the text of every page, separating pages with a blank line
+func pdfText(data []byte) (string, error) {
+	pages, err := pdfPages(data)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, text := range pages {
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// pdfPages extracts the text of each page; pages without text are empty
+func pdfPages(data []byte) ([]string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, fmt.Errorf("encrypted PDFs are not supported")
+	}
+
+	var pages []string
+	found := false
+	for _, page := range doc.pages() {
+		text := strings.TrimSpace(doc.pageText(page))
+		if doc.overBudget {
+			return nil, errPDFTooLarge
+		}
+		pages = append(pages, text)
+		found = found || text != ""
+	}
+	if doc.overBudget {
+		return nil, errPDFTooLarge
+	}
+	if !found {
+		return nil, fmt.Errorf("no text found in PDF (it may be scanned images)")
+	}
+	return pages, nil
+}
+
+// pdfMaxInflated caps how many bytes a document's compressed streams may
+// decompress to in total, so a small file cannot exhaust memory
+const pdfMaxInflated = 64 << 20
+
+// pdfDoc is a parsed PDF file
+type pdfDoc struct {
+	objects map[int]any
+	trailer pdfDict
+
+	inflateBudget int  // bytes the remaining streams may decompress to
+	overBudget    bool // a stream hit the limit
+}
+
+// objHeader finds "n g obj" headers. Scanning for them instead of trusting
+// the cross-reference table also copes with damaged files.
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF loads every object in the file, including those packed into
+// object streams
+func parsePDF(data []byte) (*pdfDoc, error) {
+	if !isPDF(data) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	doc := &pdfDoc{objects: make(map[int]any), trailer: pdfDict{}, inflateBudget: pdfMaxInflated}
+
+	skipUntil := 0
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] < skipUntil {
+			continue // inside the previous object's stream data
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		lex := &pdfLexer{data: data, pos: m[1]}
+		obj, err := lex.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok && lex.streamFollows() {
+			stream := lex.stream(dict)
+			obj = stream
+		}
+		doc.objects[num] = obj
+		skipUntil = lex.pos
+	}
+
+	// Trailers: the classic trailer dictionaries, then any XRef streams.
+	// Later ones win, as in an incrementally updated file.
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j == -1 {
+			break
+		}
+		lex := &pdfLexer{data: data, pos: i + j + len("trailer")}
+		if dict, err := lex.object(); err == nil {
+			if d, ok := dict.(pdfDict); ok {
+				for k, v := range d {
+					doc.trailer[k] = v
+				}
+			}
+		}
+		i += j + len("trailer")
+	}
+
+	for _, obj := range doc.objects {
+		stream, ok := obj.(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch stream.dict["Type"] {
+		case pdfName("ObjStm"):
+			doc.loadObjectStream(stream)
+		case pdfName("XRef"):
+			for _, key := range []string{"Root", "Encrypt", "Info"} {
+				if v, ok := stream.dict[key]; ok {
+					if _, set := doc.trailer[key]; !set {
+						doc.trailer[key] = v
+					}
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// loadObjectStream adds the objects packed in an object stream
+func (d *pdfDoc) loadObjectStream(stream *pdfStream) {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	if first < 0 || first > float64(len(data)) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.object()
+		off, err2 := header.object()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		numF, ok1 := num.(float64)
+		offF, ok2 := off.(float64)
+		if !ok1 || !ok2 || offF < 0 || offF >= float64(len(data))-first {
+			return
+		}
+		if _, exists := d.objects[int(numF)]; exists {
+			continue
+		}
+		lex := &pdfLexer{data: data, pos: int(first) + int(offF)}
+		if obj, err := lex.object(); err == nil {
+			d.objects[int(numF)] = obj
+		}
+	}
+}
+
+// resolve follows indirect references
+func (d *pdfDoc) resolve(obj any) any {
+	for i := 0; i < maxPDFDepth; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDoc) dict(obj any) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decodeStream applies a stream's filters. Image filters are not
+// supported, since only text is needed.
+func (d *pdfDoc) decodeStream(stream *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := stream.data
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = d.inflate(data)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+var errPDFTooLarge = fmt.Errorf("PDF content decompresses to more than %d MB", pdfMaxInflated>>20)
+
+// inflate decompresses zlib data, keeping whatever could be read from a
+// truncated or slightly corrupt stream. The output counts against the
+// document's decompression budget.
+func (d *pdfDoc) inflate(data []byte) ([]byte, error) {
+	if d.overBudget {
+		return nil, errPDFTooLarge
+	}
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(d.inflateBudget)+1))
+	if len(out) > d.inflateBudget {
+		d.overBudget = true
+		return nil, errPDFTooLarge
+	}
+	d.inflateBudget -= len(out)
+	if len(out) > 0 {
+		return out, nil
+	}
+	return out, err
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if i := bytes.IndexByte(data, '>'); i != -1 {
+		data = data[:i]
+	}
+	digits := bytes.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n\f\x00", r) {
+			return -1
+		}
+		return r
+	}, data)
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i != -1 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pdfPage is a page with the resources it inherits
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in order
+func (d *pdfDoc) pages() []pdfPage {
+	root := d.dict(d.trailer["Root"])
+	if root == nil {
+		// No trailer: find the catalog directly
+		for _, obj := range d.objects {
+			if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				root = dict
+				break
+			}
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	var pages []pdfPage
+	var walk func(node pdfDict, resources pdfDict, depth int)
+	walk = func(node pdfDict, resources pdfDict, depth int) {
+		if node == nil || depth > maxPDFDepth {
+			return
+		}
+		if res := d.dict(node["Resources"]); res != nil {
+			resources = res
+		}
+		kids, ok := d.resolve(node["Kids"]).(pdfArray)
+		if !ok {
+			pages = append(pages, pdfPage{dict: node, resources: resources})
+			return
+		}
+		for _, kid := range kids {
+			walk(d.dict(kid), resources, depth+1)
+		}
+	}
+	walk(d.dict(root["Pages"]), nil, 0)
+	return pages
+}
+
+// pageText interprets a page's content streams and returns its text
+func (d *pdfDoc) pageText(page pdfPage) string {
+	var content []byte
+	contents := d.resolve(page.dict["Contents"])
+	if arr, ok := contents.(pdfArray); ok {
+		for _, part := range arr {
+			if stream, ok := d.resolve(part).(*pdfStream); ok {
+				if data, err := d.decodeStream(stream); err == nil {
+					content = append(append(content, data...), '\n')
+				}
+			}
+		}
+	} else if stream, ok := contents.(*pdfStream); ok {
+		content, _ = d.decodeStream(stream)
+	}
+
+	fonts := d.dict(page.resources["Font"])
+	cache := make(map[pdfName]*pdfFont)
+	fontFor := func(name pdfName) *pdfFont {
+		if f, ok := cache[name]; ok {
+			return f
+		}
+		f := d.font(d.dict(fonts[string(name)]))
+		cache[name] = f
+		return f
+	}
+
+	var out strings.Builder
+	newline := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			out.WriteByte(' ')
+		}
+	}
+
+	font := d.font(nil)
+	lastY := math.NaN()
+	var operands []any
+	lex := &pdfLexer{data: content}
+	for {
+		obj, err := lex.object()
+		if err != nil {
+			break
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = fontFor(name)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, _ := operands[1].(float64); ty != 0 {
+					newline()
+				} else {
+					space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if !math.IsNaN(lastY) && y != lastY {
+					newline()
+				} else {
+					space()
+				}
+				lastY = y
+			}
+		case "T*":
+			newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					out.WriteString(font.decode(s))
+				}
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					out.WriteString(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case pdfString:
+						out.WriteString(font.decode(v))
+					case float64:
+						// A large negative adjustment is a word gap
+						if v < -200 {
+							space()
+						}
+					}
+				}
+			}
+		case "ET":
+			space()
+		case "BI":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return out.String()
+}
+
+// pdfFont maps the character codes of a font to text
+type pdfFont struct {
+	codeBytes int
+	toUnicode map[uint32]string
+	simple    map[byte]string // /Differences of a simple font
+}
+
+// font builds the decoder for a font dictionary; nil gives a Latin-1 font
+func (d *pdfDoc) font(dict pdfDict) *pdfFont {
+	f := &pdfFont{codeBytes: 1}
+	if dict == nil {
+		return f
+	}
+	if dict["Subtype"] == pdfName("Type0") {
+		f.codeBytes = 2
+	}
+	if enc := d.dict(dict["Encoding"]); enc != nil {
+		if diffs, ok := d.resolve(enc["Differences"]).(pdfArray); ok {
+			f.simple = make(map[byte]string)
+			code := 0
+			for _, item := range diffs {
+				switch v := d.resolve(item).(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if s, ok := glyphText(string(v)); ok && code < 256 {
+						f.simple[byte(code)] = s
+					}
+					code++
+				}
+			}
+		}
+	}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			f.parseCMap(data)
+		}
+	}
+	return f
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap
+func (f *pdfFont) parseCMap(data []byte) {
+	f.toUnicode = make(map[uint32]string)
+	lex := &pdfLexer{data: data}
+	var operands []any
+	for {
+		obj, err := lex.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					f.codeBytes = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUnicode[codeOf(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeOf(lo), codeOf(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := utf16.Decode(utf16Units(dst))
+					for code := start; code <= end; code++ {
+						if len(base) == 0 {
+							break
+						}
+						runes := append([]rune(nil), base...)
+						runes[len(runes)-1] += rune(code - start)
+						f.toUnicode[code] = string(runes)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							f.toUnicode[start+uint32(j)] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// decode converts a shown string to text
+func (f *pdfFont) decode(s pdfString) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := min(f.codeBytes, len(s)-i)
+		code := codeOf(s[i : i+n])
+		switch {
+		case f.toUnicode != nil && f.toUnicode[code] != "":
+			b.WriteString(f.toUnicode[code])
+		case n == 1 && f.simple[s[i]] != "":
+			b.WriteString(f.simple[s[i]])
+		case n == 1:
+			b.WriteString(winAnsiText(s[i]))
+		}
+		i += n
+	}
+	return b.String()
+}
+
+func codeOf(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16Text(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+// winAnsiHigh are the printable characters of Windows-1252 that differ
+// from Latin-1
+var winAnsiHigh = map[byte]string{
+	0x80: "€", 0x85: "…", 0x91: "‘", 0x92: "’", 0x93: "“", 0x94: "”",
+	0x95: "•", 0x96: "–", 0x97: "—", 0x99: "™",
+}
+
+// winAnsiText decodes a byte of a simple font's standard encoding
+func winAnsiText(c byte) string {
+	switch {
+	case c == '\t' || c == '\n' || c == '\r':
+		return " "
+	case c < 0x20:
+		return ""
+	case c < 0x80:
+		return string(rune(c))
+	case winAnsiHigh[c] != "":
+		return winAnsiHigh[c]
+	case c >= 0xA0:
+		return string(rune(c))
+	}
+	return ""
+}
+
+// glyphNames are common glyph names whose text is not the name itself
+var glyphNames = map[string]string{
+	"space": " ", "period": ".", "comma": ",", "colon": ":", "semicolon": ";",
+	"hyphen": "-", "endash": "–", "emdash": "—", "quoteright": "’", "quoteleft": "‘",
+	"quotedblleft": "“", "quotedblright": "”", "quotesingle": "'", "quotedbl": "\"",
+	"parenleft": "(", "parenright": ")", "bullet": "•", "ellipsis": "…",
+	"exclam": "!", "question": "?", "slash": "/", "ampersand": "&", "percent": "%",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+// glyphText returns the text of a glyph name, including uniXXXX names
+func glyphText(name string) (string, bool) {
+	if len(name) == 1 {
+		return name, true
+	}
+	if s, ok := glyphNames[name]; ok {
+		return s, true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if n, err := strconv.ParseUint(name[3:], 16, 32); err == nil {
+			return string(rune(n)), true
+		}
+	}
+	return "", false
+}
+
+// pdfLexer reads PDF objects and content stream operators
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) != -1
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// regular reads a run of regular characters
+func (l *pdfLexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// object reads the next object, or a keyword such as an operator
+func (l *pdfLexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		dict := pdfDict{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if bytes.HasPrefix(l.data[l.pos:], []byte(">>")) {
+				l.pos += 2
+				return dict, nil
+			}
+			key, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key %v is not a name", key)
+			}
+			val, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			dict[string(name)] = val
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end == -1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		s, _ := decodeASCIIHex(l.data[l.pos : l.pos+end])
+		l.pos += end + 1
+		return pdfString(s), nil
+	case c == '(':
+		return l.literalString()
+	case c == '[':
+		l.pos++
+		var arr pdfArray
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			item, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+	case c == '/':
+		l.pos++
+		name := l.regular()
+		if strings.Contains(name, "#") {
+			var b strings.Builder
+			for i := 0; i < len(name); i++ {
+				if name[i] == '#' && i+2 < len(name) {
+					if v, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 2
+						continue
+					}
+				}
+				b.WriteByte(name[i])
+			}
+			name = b.String()
+		}
+		return pdfName(name), nil
+	case c == '>' || c == ']' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	word := l.regular()
+	if word == "" {
+		l.pos++
+		return pdfKeyword(""), nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return pdfKeyword(word), nil
+	}
+
+	// An integer may start an indirect reference: "12 0 R"
+	if n == math.Trunc(n) && n >= 0 && !strings.Contains(word, ".") {
+		save := l.pos
+		l.skipSpace()
+		gen := l.regular()
+		l.skipSpace()
+		if g, err := strconv.Atoi(gen); err == nil && l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelim(l.data[l.pos+1])) {
+			l.pos++
+			return pdfRef{num: int(n), gen: g}, nil
+		}
+		l.pos = save
+	}
+	return n, nil
+}
+
+// literalString reads a (string) with escapes and balanced parentheses
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++ // (
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(b), nil
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b), nil
+}
+
+// streamFollows reports whether the "stream" keyword comes next
+func (l *pdfLexer) streamFollows() bool {
+	l.skipSpace()
+	return bytes.HasPrefix(l.data[l.pos:], []byte("stream"))
+}
+
+// stream reads the data of a stream whose dictionary was just read
+func (l *pdfLexer) stream(dict pdfDict) *pdfStream {
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust a direct /Length when endstream follows it; otherwise search
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && n <= float64(len(l.data)-start) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(l.data[end:min(end+32, len(l.data))], "\r\n ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end
+			return &pdfStream{dict: dict, data: l.data[start:end]}
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end == -1 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, data: l.data[start:]}
+	}
+	l.pos = start + end + len("endstream")
+	return &pdfStream{dict: dict, data: bytes.TrimRight(l.data[start:start+end], "\r\n")}
+}
+
+// skipInlineImage skips the binary data of an inline image (BI ... ID
+// data EI) in a content stream
+func (l *pdfLexer) skipInlineImage() {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i == -1 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 3
+	for l.pos < len(l.data) {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j == -1 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + j
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos == len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
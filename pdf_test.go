@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPDFPages(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"hello.pdf", []string{"Hello, PDF world (1)."}},
+		{"report.pdf", []string{"Quarterly report\nRevenue grew 12%", "Page two\nCafé costs fell"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := pdfPages(data)
+			if err != nil {
+				t.Fatalf("pdfPages: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pdfPages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// malformedPDFs must be rejected or read without panicking
+var malformedPDFs = []string{
+	"",
+	"%PDF-",
+	"%PDF-0 0 obj<</Length 9227000000000000000>>stream",
+	"%PDF-0 0 obj<</Length -5>>stream\nabc\nendstream",
+	"%PDF-0 0 obj<</Length 3>>stream",
+	"%PDF-1 0 obj<</Type/Pages/Kids[1 0 R]/Count 1>>endobj trailer<</Root 1 0 R>>",
+	"%PDF-1 0 obj<</Length 2/Filter/FlateDecode>>stream\nxx\nendstream endobj",
+	"%PDF-1 0 obj<</Type/ObjStm/N 99999/First -1/Length 1>>stream\n0\nendstream endobj",
+	"%PDF-1 0 obj (unterminated \\",
+	"%PDF-1 0 obj <<<<<<<<<<<<<<<<[[[[[[[[[[",
+	deflateBombPDF(),
+}
+
+// deflateBombPDF is a small PDF whose one content stream inflates to more
+// than the decompression budget
+func deflateBombPDF() string {
+	var stream bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&stream, zlib.BestCompression)
+	zeros := make([]byte, 1<<20)
+	for i := 0; i < pdfMaxInflated>>20+1; i++ {
+		zw.Write(zeros)
+	}
+	zw.Close()
+	return fmt.Sprintf("%%PDF-1.4\n"+
+		"1 0 obj<</Type/Catalog/Pages 2 0 R>>endobj\n"+
+		"2 0 obj<</Type/Pages/Kids[3 0 R]/Count 1>>endobj\n"+
+		"3 0 obj<</Type/Page/Parent 2 0 R/Contents 4 0 R>>endobj\n"+
+		"4 0 obj<</Length %d/Filter/FlateDecode>>stream\n%s\nendstream endobj\n"+
+		"trailer<</Root 1 0 R>>", stream.Len(), stream.Bytes())
+}
+
+func TestPDFPagesMalformed(t *testing.T) {
+	for _, input := range malformedPDFs {
+		if _, err := pdfPages([]byte(input)); err == nil {
+			t.Errorf("pdfPages(%q) succeeded, want an error", input)
+		}
+	}
+}
+
+func TestPDFPagesDecompressionLimit(t *testing.T) {
+	_, err := pdfPages([]byte(deflateBombPDF()))
+	if err == nil || !strings.Contains(err.Error(), "decompresses to more than") {
+		t.Errorf("pdfPages error = %v, want the decompression limit", err)
+	}
+}
+
+func FuzzPDFPages(f *testing.F) {
+	for _, name := range []string{"hello.pdf", "report.pdf"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	for _, input := range malformedPDFs {
+		f.Add([]byte(input))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pdfPages(data)
+	})
+}
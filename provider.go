@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenOptions are per-call generation settings. Zero values mean "use the
+// provider's default".
+type GenOptions struct {
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+	// Format names the kind of reply the caller expects when the prompt
+	// asks for more than free text: "html" or "agentscript". Real models
+	// follow the prompt; the fake provider shapes its reply by it.
+	Format string
+}
+
+// Provider is an LLM backend that text commands can be routed to, either
+// as the default provider or per step with ask@claude "..."
+type Provider interface {
+	// Name returns the name used to select the provider in scripts
+	Name() string
+	// Generate returns the model's reply to a text prompt
+	Generate(ctx context.Context, prompt string, opts GenOptions) (string, error)
+	// Stream is like Generate but calls onChunk with text as it arrives
+	Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error)
+	// GenerateWithFiles sends local image/video files along with the prompt
+	GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error)
+	// GenerateStructured asks for JSON conforming to a JSON schema
+	GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error)
+}
+
+// streamOnce implements Stream for providers without incremental output
+func streamOnce(ctx context.Context, p Provider, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	text, err := p.Generate(ctx, prompt, opts)
+	if err == nil && onChunk != nil {
+		onChunk(text)
+	}
+	return text, err
+}
+
+// stepKey carries the executing command through the context so that the
+// helpers behind each command can honour its provider and options
+type stepKey struct{}
+
+func withStep(ctx context.Context, cmd *Command) context.Context {
+	return context.WithValue(ctx, stepKey{}, cmd)
+}
+
+func stepFrom(ctx context.Context) *Command {
+	cmd, _ := ctx.Value(stepKey{}).(*Command)
+	return cmd
+}
+
+// llm resolves the provider and generation options for the current step:
+// the provider named with @name (or provider=name), else the default one
+// with its fallback chain, plus model=, temperature= and max_tokens= options
+func (r *Runtime) llm(ctx context.Context) (Provider, GenOptions, error) {
+	return r.llmPreferring(ctx, "")
+}
+
+// llmPreferring is like llm, but starts the chain with the preferred
+// provider when it is configured and the step does not choose one itself
+func (r *Runtime) llmPreferring(ctx context.Context, preferred string) (Provider, GenOptions, error) {
+	var opts GenOptions
+	var name string
+
+	if cmd := stepFrom(ctx); cmd != nil {
+		if cmd.Provider != "" {
+			name = cmd.Provider
+		} else if v, ok := cmd.Option("provider"); ok {
+			name = v
+		}
+		if v, ok := cmd.Option("model"); ok {
+			opts.Model = v
+		}
+		if v, ok := cmd.Option("temperature"); ok {
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, opts, fmt.Errorf("invalid temperature %q", v)
+			}
+			opts.Temperature = &t
+		}
+		if v, ok := cmd.Option("max_tokens"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, opts, fmt.Errorf("invalid max_tokens %q", v)
+			}
+			opts.MaxTokens = n
+		}
+	}
+
+	// An explicitly chosen provider never falls back
+	if name != "" {
+		p, err := r.provider(name)
+		return r.limited(p), opts, err
+	}
+
+	head := r.defaultProvider
+	if _, ok := r.providers[preferred]; ok {
+		head = preferred
+	}
+	chain := &chainProvider{r: r, text: r.chain(capText, head), vision: r.chain(capVision, head)}
+	for _, name := range chain.text {
+		if _, err := r.provider(name); err == nil {
+			return r.limited(chain), opts, nil
+		}
+	}
+	_, err := r.provider(head)
+	return nil, opts, err
+}
+
+// stepProvider returns the name of the provider the current step asks
+// for, or the default provider's
+func (r *Runtime) stepProvider(ctx context.Context) string {
+	if cmd := stepFrom(ctx); cmd != nil {
+		if cmd.Provider != "" {
+			return cmd.Provider
+		}
+		if v, ok := cmd.Option("provider"); ok {
+			return v
+		}
+	}
+	return r.defaultProvider
+}
+
+// provider looks up a configured provider by name ("" means the default)
+func (r *Runtime) provider(name string) (Provider, error) {
+	if name == "" {
+		name = r.defaultProvider
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no LLM provider configured - set GEMINI_API_KEY or CLAUDE_API_KEY")
+	}
+	if p, ok := r.providers[name]; ok {
+		return p, nil
+	}
+	if !knownProviders[name] {
+		return nil, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(r.providerNames(), ", "))
+	}
+	return nil, &UnavailableError{name, fmt.Sprintf("provider %q is not configured - set its API key", name)}
+}
+
+// hasLLM reports whether the current step has a usable provider
+func (r *Runtime) hasLLM(ctx context.Context) bool {
+	_, _, err := r.llm(ctx)
+	return err == nil
+}
+
+func (r *Runtime) providerNames() []string {
+	var names []string
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// knownProviders lists every provider name the runtime can configure
+var knownProviders = map[string]bool{
+	"gemini": true,
+	"claude": true,
+	"ollama": true,
+	"openai": true,
+	"fake":   true,
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out model requests to stay under a requests-per-minute
+// quota and caps how many run at once. A nil RateLimiter allows everything.
+type RateLimiter struct {
+	interval time.Duration // minimum time between request starts
+	slots    chan struct{} // nil means no concurrency cap
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter creates a limiter; zero disables either limit, and nil is
+// returned when both are disabled
+func NewRateLimiter(perMinute, concurrency int) *RateLimiter {
+	if perMinute <= 0 && concurrency <= 0 {
+		return nil
+	}
+	l := &RateLimiter{}
+	if perMinute > 0 {
+		l.interval = time.Minute / time.Duration(perMinute)
+	}
+	if concurrency > 0 {
+		l.slots = make(chan struct{}, concurrency)
+	}
+	return l
+}
+
+// Acquire waits for a free slot and the request's turn. The returned
+// function releases the slot and must be called when the request is done.
+func (l *RateLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		at := l.next
+		if at.Before(now) {
+			at = now
+		}
+		l.next = at.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := time.Until(at); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
+// limitedProvider makes every call to a Provider go through the limiter
+type limitedProvider struct {
+	Provider
+	limiter *RateLimiter
+}
+
+// limited wraps p with the runtime's rate limiter, if there is one
+func (r *Runtime) limited(p Provider) Provider {
+	if r.limiter == nil || p == nil {
+		return p
+	}
+	return &limitedProvider{Provider: p, limiter: r.limiter}
+}
+
+func (l *limitedProvider) Generate(ctx context.Context, prompt string, opts GenOptions) (string, error) {
+	release, err := l.limiter.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.Provider.Generate(ctx, prompt, opts)
+}
+
+func (l *limitedProvider) Stream(ctx context.Context, prompt string, opts GenOptions, onChunk func(string)) (string, error) {
+	release, err := l.limiter.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.Provider.Stream(ctx, prompt, opts, onChunk)
+}
+
+func (l *limitedProvider) GenerateWithFiles(ctx context.Context, prompt string, files []string, opts GenOptions) (string, error) {
+	release, err := l.limiter.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.Provider.GenerateWithFiles(ctx, prompt, files, opts)
+}
+
+func (l *limitedProvider) GenerateStructured(ctx context.Context, prompt string, schema map[string]any, opts GenOptions) (string, error) {
+	release, err := l.limiter.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.Provider.GenerateStructured(ctx, prompt, schema, opts)
+}
@@ -2,11 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -18,94 +15,359 @@ import (
 
 // Runtime executes AgentScript commands
 type Runtime struct {
-	gemini    *GeminiClient
-	google    *GoogleClient
-	github    *GitHubClient
-	claude    *ClaudeClient
-	verbose   bool
-	searchKey string
+	gemini   MediaClient
+	google   *GoogleClient
+	github   *GitHubClient
+	claude   *ClaudeClient
+	verbose  bool
+	searcher SearchBackend // nil uses Gemini's Google Search grounding
+	feedDir  string        // where feed remembers the items it returned
+	indexDir string        // where index stores document indexes
+
+	workspace  *Workspace // nil allows any path
+	translated bool       // the running script was translated from natural language
+
+	providers       map[string]Provider
+	defaultProvider string
+	fallbacks       map[string][]string // capability -> provider chain
+	fallbackLog     []string
+	sourceIDs       map[string]int      // source URL -> citation id for the run
+	pendingSeen     map[string][]string // feed URL -> item ids to remember if the run succeeds
+	skipped         []string            // assertions that could not be checked
+	mu              sync.Mutex
+
+	limiter       *RateLimiter
+	contextTokens int // context window override; 0 uses each provider's default
+	mapWorkers    int // chunks processed at once for oversized inputs
+
+	streamOut io.Writer // where the last step streams its reply; nil disables
+	streamCmd *Command
+	streamed  bool
+
+	checkpoint *Checkpoint
+	stepIDs    map[*Command]string
 }
 
 // RuntimeConfig holds runtime configuration
 type RuntimeConfig struct {
+	Provider           string // default LLM: "gemini", "claude", "ollama", "openai" or "fake"
 	GeminiAPIKey       string
 	ClaudeAPIKey       string
 	SearchAPIKey       string
-	Model              string
+	SearchProvider     string // "serpapi", "brave", "bing" or "searxng"
+	Model              string // default model of the default provider
+	OllamaModel        string // local model used by the ollama provider
+	OpenAIAPIKey       string
+	OpenAIModel        string
+	OpenAIHeaders      map[string]string   // extra headers for OpenAI-compatible gateways
+	Fallbacks          map[string][]string // capability -> ordered provider chain
+	ContextTokens      int                 // context window to assume for every model
+	RequestsPerMinute  int                 // model request rate limit; 0 is unlimited
+	MaxConcurrency     int                 // model requests in flight at once; 0 is unlimited
 	Verbose            bool
 	GoogleCredsFile    string
 	GoogleTokenFile    string
 	GitHubClientID     string
 	GitHubClientSecret string
 	GitHubTokenFile    string
+	Cache              *ResponseCache
+	Cassette           *Cassette
+	Endpoints          Endpoints
+	FeedDir            string // seen-item state of the feed command
+	IndexDir           string // document indexes built by the index command
+	Workspace          *Workspace
 }
 
 // NewRuntime creates a new Runtime instance
 func NewRuntime(ctx context.Context, cfg RuntimeConfig) (*Runtime, error) {
+	endpoints := cfg.Endpoints.withDefaults()
+
+	if cfg.Provider != "" && !knownProviders[cfg.Provider] {
+		return nil, fmt.Errorf("unknown provider %q (expected gemini, claude, ollama, openai or fake)", cfg.Provider)
+	}
+
+	if cfg.Provider == "fake" {
+		// Everything runs offline: every provider name maps to the fake
+		// client, and Google and GitHub commands fall back to their
+		// simulated output
+		fmt.Fprintln(os.Stderr, "🧪 Using fake provider - no API calls will be made")
+		fake := NewFakeClient(cfg.Model)
+		providers := make(map[string]Provider)
+		for name := range knownProviders {
+			providers[name] = fake
+		}
+		return &Runtime{
+			gemini:          fake,
+			verbose:         cfg.Verbose,
+			feedDir:         cfg.FeedDir,
+			indexDir:        cfg.IndexDir,
+			workspace:       cfg.Workspace,
+			providers:       providers,
+			defaultProvider: "fake",
+			limiter:         NewRateLimiter(cfg.RequestsPerMinute, cfg.MaxConcurrency),
+			contextTokens:   cfg.ContextTokens,
+			mapWorkers:      cfg.MaxConcurrency,
+		}, nil
+	}
+
+	// When replaying a cassette, configure the same services that were
+	// available at record time. No real credentials are needed since
+	// every request is answered from the recording.
+	replay := cfg.Cassette.Replaying()
+	if replay {
+		if cfg.GeminiAPIKey == "" && cfg.Cassette.HasService("gemini") {
+			cfg.GeminiAPIKey = redacted
+		}
+		if cfg.ClaudeAPIKey == "" && cfg.Cassette.HasService("claude") {
+			cfg.ClaudeAPIKey = redacted
+		}
+		if cfg.OpenAIAPIKey == "" && cfg.Cassette.HasService("openai") {
+			cfg.OpenAIAPIKey = redacted
+		}
+		if cfg.SearchAPIKey == "" && cfg.Cassette.HasService("search") {
+			cfg.SearchAPIKey = redacted
+		}
+	}
+
+	// The default provider is the one asked for, else the first configured
+	defaultProvider := cfg.Provider
+	if defaultProvider == "" {
+		switch {
+		case cfg.GeminiAPIKey != "":
+			defaultProvider = "gemini"
+		case cfg.ClaudeAPIKey != "":
+			defaultProvider = "claude"
+		case cfg.OpenAIAPIKey != "" || endpoints.OpenAI != defaultOpenAIBaseURL:
+			defaultProvider = "openai"
+		default:
+			defaultProvider = "gemini"
+		}
+	}
+	modelFor := func(provider string) string {
+		if provider == defaultProvider {
+			return cfg.Model
+		}
+		return ""
+	}
+
+	providers := make(map[string]Provider)
+
 	var geminiClient *GeminiClient
 	if cfg.GeminiAPIKey != "" {
-		geminiClient = NewGeminiClient(cfg.GeminiAPIKey, cfg.Model)
+		geminiClient = NewGeminiClient(cfg.GeminiAPIKey, modelFor("gemini"))
+		geminiClient.baseURL = endpoints.Gemini
+		geminiClient.cache = cfg.Cache
+		providers["gemini"] = geminiClient
+		cfg.Cassette.NoteService("gemini")
 	}
 
 	var claudeClient *ClaudeClient
 	if cfg.ClaudeAPIKey != "" {
 		claudeClient = NewClaudeClient(cfg.ClaudeAPIKey)
+		if model := modelFor("claude"); model != "" {
+			claudeClient.model = model
+		}
+		claudeClient.baseURL = endpoints.Claude
+		claudeClient.cache = cfg.Cache
+		providers["claude"] = claudeClient
+		cfg.Cassette.NoteService("claude")
+	}
+
+	// A gateway on a custom base URL may not need a key
+	if cfg.OpenAIAPIKey != "" || endpoints.OpenAI != defaultOpenAIBaseURL {
+		openaiClient := NewOpenAIClient(cfg.OpenAIAPIKey, cfg.OpenAIModel)
+		if model := modelFor("openai"); model != "" {
+			openaiClient.model = model
+		}
+		openaiClient.baseURL = endpoints.OpenAI
+		for name, value := range cfg.OpenAIHeaders {
+			openaiClient.headers[name] = value
+		}
+		openaiClient.cache = cfg.Cache
+		providers["openai"] = openaiClient
+		cfg.Cassette.NoteService("openai")
+	}
+
+	// Ollama needs no key, so it is always available for ask@ollama
+	ollamaClient := NewOllamaClient(cfg.OllamaModel)
+	if model := modelFor("ollama"); model != "" {
+		ollamaClient.model = model
+	}
+	ollamaClient.baseURL = endpoints.Ollama
+	ollamaClient.cache = cfg.Cache
+	providers["ollama"] = ollamaClient
+
+	fallbacks := defaultFallbacks(providers)
+	for capability, chain := range cfg.Fallbacks {
+		for _, name := range chain {
+			if !validFallback(capability, name) {
+				return nil, fmt.Errorf("invalid %s fallback %q", capability, name)
+			}
+		}
+		fallbacks[capability] = chain
+	}
+
+	// SEARCH_API_KEY alone means SerpAPI; SearxNG is keyless
+	var searcher SearchBackend
+	if cfg.SearchProvider != "" || cfg.SearchAPIKey != "" {
+		baseURL := endpoints.Search
+		if baseURL == defaultSearchBaseURL {
+			baseURL = "" // each backend has its own default
+		}
+		var err error
+		if searcher, err = NewSearchBackend(cfg.SearchProvider, cfg.SearchAPIKey, baseURL); err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+		cfg.Cassette.NoteService("search")
 	}
 
 	var googleClient *GoogleClient
-	if cfg.GoogleCredsFile != "" {
+	if replay && cfg.Cassette.HasService("google") {
+		var err error
+		googleClient, err = newGoogleClientWithHTTP(ctx, newHTTPClient(), endpoints.Google)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: Google API not available: %v\n", err)
+		}
+	} else if cfg.GoogleCredsFile != "" && !replay {
 		tokenFile := cfg.GoogleTokenFile
 		if tokenFile == "" {
 			tokenFile = "token.json"
 		}
 		var err error
-		googleClient, err = NewGoogleClient(ctx, cfg.GoogleCredsFile, tokenFile)
+		googleClient, err = NewGoogleClient(ctx, cfg.GoogleCredsFile, tokenFile, endpoints.Google)
 		if err != nil {
 			// Don't fail, just log warning
 			fmt.Fprintf(os.Stderr, "Warning: Google API not available: %v\n", err)
+		} else {
+			cfg.Cassette.NoteService("google")
 		}
 	}
 
 	var githubClient *GitHubClient
-	if cfg.GitHubClientID != "" && cfg.GitHubClientSecret != "" {
+	if replay && cfg.Cassette.HasService("github") {
+		var err error
+		githubClient, err = newGitHubClientWithHTTP(ctx, newHTTPClient(), endpoints.GitHubAPI, endpoints.GitHubServer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: GitHub API not available: %v\n", err)
+		}
+	} else if cfg.GitHubClientID != "" && cfg.GitHubClientSecret != "" && !replay {
 		tokenFile := cfg.GitHubTokenFile
 		if tokenFile == "" {
 			tokenFile = "github_token.json"
 		}
 		var err error
-		githubClient, err = NewGitHubClient(ctx, cfg.GitHubClientID, cfg.GitHubClientSecret, tokenFile)
+		githubClient, err = NewGitHubClient(ctx, cfg.GitHubClientID, cfg.GitHubClientSecret, tokenFile,
+			endpoints.GitHubAPI, endpoints.GitHubServer)
 		if err != nil {
 			// Don't fail, just log warning
 			fmt.Fprintf(os.Stderr, "Warning: GitHub API not available: %v\n", err)
+		} else {
+			cfg.Cassette.NoteService("github")
 		}
 	}
 
-	return &Runtime{
-		gemini:    geminiClient,
+	rt := &Runtime{
 		google:    googleClient,
 		github:    githubClient,
 		claude:    claudeClient,
 		verbose:   cfg.Verbose,
-		searchKey: cfg.SearchAPIKey,
-	}, nil
+		searcher:  searcher,
+		feedDir:   cfg.FeedDir,
+		indexDir:  cfg.IndexDir,
+		workspace: cfg.Workspace,
+
+		providers:       providers,
+		defaultProvider: defaultProvider,
+		fallbacks:       fallbacks,
+
+		limiter:       NewRateLimiter(cfg.RequestsPerMinute, cfg.MaxConcurrency),
+		contextTokens: cfg.ContextTokens,
+		mapWorkers:    cfg.MaxConcurrency,
+	}
+	if geminiClient != nil {
+		rt.gemini = geminiClient
+	}
+	return rt, nil
+}
+
+// SetCheckpoint enables checkpointing of step outputs for subsequent
+// Execute calls. Pass nil to disable it.
+func (r *Runtime) SetCheckpoint(cp *Checkpoint) {
+	r.checkpoint = cp
+}
+
+// SetTranslated marks the scripts run next as translated from natural
+// language, which may not leave the workspace without asking
+func (r *Runtime) SetTranslated(on bool) {
+	r.translated = on
+}
+
+// SetStreamOutput makes a streamable last step (ask, summarize, analyze,
+// translate) print its reply to w as it is generated
+func (r *Runtime) SetStreamOutput(w io.Writer) {
+	r.streamOut = w
+}
+
+// Streamed reports whether the result of the last Execute was already
+// printed while streaming
+func (r *Runtime) Streamed() bool {
+	return r.streamed
 }
 
 // Execute runs a parsed program
 func (r *Runtime) Execute(ctx context.Context, program *Program) (string, error) {
-	var result string
+	if r.checkpoint != nil {
+		r.stepIDs = assignStepIDs(program)
+	}
+	r.streamCmd = lastCommand(program)
+	r.streamed = false
+	r.mu.Lock()
+	r.sourceIDs = nil
+	r.pendingSeen = nil
+	r.skipped = nil
+	r.mu.Unlock()
+
+	defer r.printFallbacks()
+
+	var result value
 	for _, stmt := range program.Statements {
 		var err error
 		result, err = r.executeStatement(ctx, stmt, result)
 		if err != nil {
+			r.dropSeen()
 			return "", err
 		}
 	}
-	return result, nil
+	if err := r.saveSeen(); err != nil {
+		return "", err
+	}
+	return result.text, nil
+}
+
+// Skipped lists the assertions of the last run that could not be checked
+func (r *Runtime) Skipped() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.skipped...)
+}
+
+// printFallbacks summarises the fallbacks used during a run
+func (r *Runtime) printFallbacks() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.fallbackLog) == 0 {
+		return
+	}
+	fmt.Printf("\n↪️  %d fallback(s) used:\n", len(r.fallbackLog))
+	for _, note := range r.fallbackLog {
+		fmt.Printf("   - %s\n", note)
+	}
+	r.fallbackLog = nil
 }
 
 // executeStatement executes a statement (command or parallel block)
-func (r *Runtime) executeStatement(ctx context.Context, stmt *Statement, input string) (string, error) {
-	var result string
+func (r *Runtime) executeStatement(ctx context.Context, stmt *Statement, input value) (value, error) {
+	var result value
 	var err error
 
 	if stmt.Parallel != nil {
@@ -115,7 +377,7 @@ func (r *Runtime) executeStatement(ctx context.Context, stmt *Statement, input s
 	}
 
 	if err != nil {
-		return "", err
+		return value{}, err
 	}
 
 	// Follow the pipe chain
@@ -127,13 +389,13 @@ func (r *Runtime) executeStatement(ctx context.Context, stmt *Statement, input s
 }
 
 // executeParallel runs multiple branches concurrently
-func (r *Runtime) executeParallel(ctx context.Context, parallel *Parallel, input string) (string, error) {
+func (r *Runtime) executeParallel(ctx context.Context, parallel *Parallel, input value) (value, error) {
 	r.log("Executing PARALLEL with %d branches", len(parallel.Branches))
 
 	// Results from each branch
 	type branchResult struct {
 		index  int
-		result string
+		result value
 		err    error
 	}
 
@@ -157,57 +419,75 @@ func (r *Runtime) executeParallel(ctx context.Context, parallel *Parallel, input
 	}()
 
 	// Collect results in order
-	orderedResults := make([]string, len(parallel.Branches))
+	orderedResults := make([]value, len(parallel.Branches))
 	for res := range results {
 		if res.err != nil {
-			return "", fmt.Errorf("parallel branch %d failed: %w", res.index, res.err)
+			return value{}, fmt.Errorf("parallel branch %d failed: %w", res.index, res.err)
 		}
 		orderedResults[res.index] = res.result
 	}
 
-	// Combine results with clear separators
+	// Combine results with clear separators, keeping every branch's sources
 	var combined []string
+	var sources [][]Citation
 	for i, res := range orderedResults {
-		combined = append(combined, fmt.Sprintf("=== Branch %d ===\n%s", i+1, res))
+		combined = append(combined, fmt.Sprintf("=== Branch %d ===\n%s", i+1, res.text))
+		sources = append(sources, res.sources)
 	}
 
 	r.log("PARALLEL complete: %d branches finished", len(parallel.Branches))
-	return strings.Join(combined, "\n\n"), nil
+	return value{text: strings.Join(combined, "\n\n"), sources: mergeSources(sources...)}, nil
 }
 
 // executeCommand executes a single command
-func (r *Runtime) executeCommand(ctx context.Context, cmd *Command, input string) (string, error) {
+func (r *Runtime) executeCommand(ctx context.Context, cmd *Command, in value) (value, error) {
+	stepID := r.stepIDs[cmd]
+	if r.checkpoint != nil && stepID != "" {
+		if output, sources, ok := r.checkpoint.Lookup(stepID); ok {
+			fmt.Printf("⏭️  Skipping %s (restored from checkpoint)\n", stepID)
+			r.restoreSources(sources)
+			if cmd.Action == "feed" {
+				r.restoreSeen(cmd, in.text, output)
+			}
+			return value{text: output, sources: sources}, nil
+		}
+	}
+
+	input := in.text
 	r.log("Executing: %s %q (input: %d bytes)", cmd.Action, cmd.Arg, len(input))
+	ctx = withStep(ctx, cmd)
+	ctx, sources := withSources(ctx, in.sources)
 
 	var result string
 	var err error
 
 	switch cmd.Action {
 	case "search":
-		result, err = r.search(ctx, cmd.Arg)
+		result, err = r.search(ctx, cmd, cmd.Arg)
 	case "summarize":
-		result, err = r.geminiCall(ctx, "Summarize the following content concisely:\n\n"+input)
+		result, err = r.summarize(ctx, input)
 	case "ask":
-		prompt := cmd.Arg
-		if input != "" {
-			prompt = cmd.Arg + "\n\nContext:\n" + input
-		}
-		result, err = r.geminiCall(ctx, prompt)
+		result, err = r.ask(ctx, cmd.Arg, input)
 	case "analyze":
-		prompt := "Analyze the following"
-		if cmd.Arg != "" {
-			prompt += " focusing on " + cmd.Arg
-		}
-		prompt += ":\n\n" + input
-		result, err = r.geminiCall(ctx, prompt)
+		result, err = r.analyze(ctx, cmd.Arg, input)
 	case "save":
-		result, err = r.save(cmd.Arg, input)
+		result, err = r.save(ctx, cmd.Arg, input)
 	case "read":
-		result, err = r.read(cmd.Arg)
+		result, err = r.read(ctx, cmd, cmd.Arg)
+	case "fetch":
+		result, err = r.fetch(ctx, cmd, cmd.Arg, input)
+	case "crawl":
+		result, err = r.crawl(ctx, cmd, cmd.Arg, input)
+	case "feed":
+		result, err = r.feed(ctx, cmd, cmd.Arg, input)
+	case "index":
+		result, err = r.index(ctx, cmd, cmd.Arg)
+	case "retrieve":
+		result, err = r.retrieve(ctx, cmd, cmd.Arg, input)
 	case "stdin":
 		result, err = r.readStdin(cmd.Arg)
 	case "list":
-		result, err = r.list(cmd.Arg)
+		result, err = r.list(cmd, cmd.Arg)
 	case "merge":
 		// merge just passes through the input - it's used after parallel
 		// to signal that we want to combine results (which parallel already does)
@@ -252,6 +532,30 @@ func (r *Runtime) executeCommand(ctx context.Context, cmd *Command, input string
 		result, err = r.audioVideoMerge(ctx, cmd.Arg, input)
 	case "image_audio_merge":
 		result, err = r.imageAudioMerge(ctx, cmd.Arg, input)
+	case "extract":
+		result, err = r.extract(ctx, cmd.Arg, input)
+	case "jq":
+		result, err = r.jq(cmd.Arg, input)
+	case "grep":
+		result, err = r.grep(cmd.Arg, input, cmd.Flag("invert"))
+	case "filter":
+		result, err = r.filter(cmd.Arg, input, cmd.Flag("invert"))
+	case "head":
+		result, err = r.head(cmd.Arg, input)
+	case "tail":
+		result, err = r.tail(cmd.Arg, input)
+	case "split":
+		result, err = r.split(cmd.Arg, input)
+	case "join":
+		result, err = r.join(cmd.Arg, input)
+	case "replace":
+		result, err = r.replace(cmd.Arg, cmd.Args, input)
+	case "template":
+		result, err = r.renderTemplate(cmd.Arg, input)
+	case "csv_to_json":
+		result, err = r.csvToJSON(cmd.Arg, input)
+	case "json_to_csv":
+		result, err = r.jsonToCSV(cmd.Arg, input)
 	case "maps_trip":
 		result, err = r.mapsTrip(ctx, cmd.Arg, input)
 	case "form_create":
@@ -270,82 +574,89 @@ func (r *Runtime) executeCommand(ctx context.Context, cmd *Command, input string
 		result, err = r.githubPages(ctx, cmd.Arg, input)
 	case "github_pages_html":
 		result, err = r.githubPagesHTML(ctx, cmd.Arg, input)
+	case "assert_contains":
+		result, err = r.assertContains(cmd.Arg, input)
+	case "assert_regex":
+		result, err = r.assertRegex(cmd.Arg, input)
+	case "assert_json":
+		result, err = r.assertJSON(cmd.Arg, input)
+	case "assert_file":
+		result, err = r.assertFile(cmd.Arg, input)
+	case "assert_rubric":
+		result, err = r.assertRubric(ctx, cmd.Arg, input)
 	default:
 		err = fmt.Errorf("unknown action: %s", cmd.Action)
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("%s failed: %w", cmd.Action, err)
+		return value{}, fmt.Errorf("%s failed: %w", cmd.Action, err)
 	}
 
-	r.log("Result: %d bytes", len(result))
-	return result, nil
-}
-
-// geminiCall makes a call to the Gemini API
-func (r *Runtime) geminiCall(ctx context.Context, prompt string) (string, error) {
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY not set - required for this command")
+	out := value{text: result, sources: sources.output()}
+	if r.checkpoint != nil && stepID != "" {
+		if err := r.checkpoint.Save(stepID, cmd, out.text, out.sources); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to checkpoint %s: %v\n", stepID, err)
+		}
 	}
-	return r.gemini.GenerateContent(ctx, prompt)
+
+	r.log("Result: %d bytes", len(result))
+	return out, nil
 }
 
-// search performs a web search
-func (r *Runtime) search(ctx context.Context, query string) (string, error) {
-	// If no search API key, use Gemini to generate a response
-	if r.searchKey == "" {
-		return r.geminiCall(ctx, "Please provide information about: "+query)
-	}
+// streamable lists the commands whose reply is the text the user wants
+// to read, and so may be streamed when they end the program
+var streamable = map[string]bool{"ask": true, "summarize": true, "analyze": true, "translate": true}
 
-	// Use SerpAPI or similar
-	searchURL := fmt.Sprintf(
-		"https://serpapi.com/search.json?q=%s&api_key=%s",
-		url.QueryEscape(query),
-		r.searchKey,
-	)
+// llmCall sends a prompt to the current step's provider, streaming the
+// reply when the step is the program's final streamable step
+func (r *Runtime) llmCall(ctx context.Context, prompt string) (string, error) {
+	return r.llmCallFormat(ctx, prompt, "")
+}
 
-	resp, err := http.Get(searchURL)
+// llmCallFormat is llmCall for a prompt asking for a reply in a particular
+// format (see GenOptions.Format)
+func (r *Runtime) llmCallFormat(ctx context.Context, prompt, format string) (string, error) {
+	p, opts, err := r.llm(ctx)
 	if err != nil {
-		return "", fmt.Errorf("search request failed: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	opts.Format = format
+	prompt = r.citing(ctx, prompt)
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read search response: %w", err)
+	cmd := stepFrom(ctx)
+	if r.streamOut == nil || cmd == nil || cmd != r.streamCmd || !streamable[cmd.Action] {
+		return p.Generate(ctx, prompt, opts)
 	}
 
-	// Parse and extract relevant snippets
-	var searchResult map[string]any
-	if err := json.Unmarshal(body, &searchResult); err != nil {
-		return "", fmt.Errorf("failed to parse search response: %w", err)
+	text, err := p.Stream(ctx, prompt, opts, func(chunk string) {
+		r.streamed = true
+		fmt.Fprint(r.streamOut, chunk)
+	})
+	if r.streamed {
+		fmt.Fprintln(r.streamOut)
 	}
+	return text, err
+}
 
-	// Extract organic results
-	var snippets []string
-	if organic, ok := searchResult["organic_results"].([]any); ok {
-		for i, item := range organic {
-			if i >= 5 {
-				break
-			}
-			if result, ok := item.(map[string]any); ok {
-				title := result["title"]
-				snippet := result["snippet"]
-				link := result["link"]
-				snippets = append(snippets, fmt.Sprintf("- %v\n  %v\n  %v", title, snippet, link))
-			}
-		}
+// lastCommand returns the command whose output is the program's result,
+// or nil if the program ends with a parallel block
+func lastCommand(program *Program) *Command {
+	if len(program.Statements) == 0 {
+		return nil
 	}
-
-	if len(snippets) == 0 {
-		return string(body), nil
+	stmt := program.Statements[len(program.Statements)-1]
+	for stmt.Pipe != nil {
+		stmt = stmt.Pipe
 	}
-
-	return strings.Join(snippets, "\n\n"), nil
+	return stmt.Command
 }
 
 // save writes content to a file
-func (r *Runtime) save(path, content string) (string, error) {
+func (r *Runtime) save(ctx context.Context, path, content string) (string, error) {
+	if err := r.checkPath(path, "write"); err != nil {
+		return "", err
+	}
+
 	// Check if content is a temp image file from imageGenerate
 	if strings.HasPrefix(content, "IMAGEFILE:") {
 		tempPath := strings.TrimPrefix(content, "IMAGEFILE:")
@@ -365,8 +676,8 @@ func (r *Runtime) save(path, content string) (string, error) {
 		return path, nil
 	}
 
-	// Check if content is a Gemini file URI that needs downloading
-	if strings.HasPrefix(content, "https://generativelanguage.googleapis.com/") && strings.Contains(content, "/files/") {
+	// Check if content is a generated file URI that needs downloading
+	if (r.gemini != nil && r.gemini.IsFileURI(content)) || (*GeminiClient)(nil).IsFileURI(content) {
 		if r.gemini != nil {
 			fmt.Printf("📥 Downloading to %s...\n", path)
 			_, err := r.gemini.DownloadFile(context.Background(), content, path)
@@ -384,6 +695,9 @@ func (r *Runtime) save(path, content string) (string, error) {
 	content = strings.TrimSpace(content)
 	if _, err := os.Stat(content); err == nil {
 		// Content is an existing file path - move/copy it to destination
+		if err := r.checkPath(content, "move"); err != nil {
+			return "", err
+		}
 		if err := os.Rename(content, path); err != nil {
 			// If rename fails, try copy
 			data, err := os.ReadFile(content)
@@ -399,7 +713,8 @@ func (r *Runtime) save(path, content string) (string, error) {
 		return path, nil
 	}
 
-	// Regular file save (text content)
+	// Regular file save (text content), with references to its sources
+	content = r.withReferences(ctx, content, path)
 	dir := filepath.Dir(path)
 	if dir != "" && dir != "." {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -416,15 +731,6 @@ func (r *Runtime) save(path, content string) (string, error) {
 	return path, nil
 }
 
-// read reads content from a file
-func (r *Runtime) read(path string) (string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
-	}
-	return string(data), nil
-}
-
 // readStdin reads from standard input
 func (r *Runtime) readStdin(prompt string) (string, error) {
 	if prompt != "" {
@@ -440,29 +746,6 @@ func (r *Runtime) readStdin(prompt string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
-// list lists files in a directory
-func (r *Runtime) list(path string) (string, error) {
-	if path == "" {
-		path = "."
-	}
-
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to list directory: %w", err)
-	}
-
-	var lines []string
-	for _, entry := range entries {
-		prefix := "📄"
-		if entry.IsDir() {
-			prefix = "📁"
-		}
-		lines = append(lines, fmt.Sprintf("%s %s", prefix, entry.Name()))
-	}
-
-	return strings.Join(lines, "\n"), nil
-}
-
 // email sends an email via Gmail API
 func (r *Runtime) email(ctx context.Context, to string, content string) (string, error) {
 	r.log("EMAIL to: %s", to)
@@ -479,36 +762,16 @@ The HTML should:
 - Be mobile-responsive
 
 Content to include:
-%s
-
-Return ONLY valid JSON like: {"subject": "...", "html": "<html>...</html>"}`, content)
+%s`, content)
 
 	var subject, htmlBody string
 
-	if r.gemini != nil {
-		formatted, err := r.geminiCall(ctx, prompt)
-		if err == nil {
-			// Clean up response
-			formatted = strings.TrimSpace(formatted)
-			formatted = strings.TrimPrefix(formatted, "```json")
-			formatted = strings.TrimPrefix(formatted, "```")
-			formatted = strings.TrimSuffix(formatted, "```")
-			formatted = strings.TrimSpace(formatted)
-
-			var emailData struct {
-				Subject string `json:"subject"`
-				HTML    string `json:"html"`
-				Body    string `json:"body"` // fallback
-			}
-			if json.Unmarshal([]byte(formatted), &emailData) == nil && emailData.Subject != "" {
-				subject = emailData.Subject
-				if emailData.HTML != "" {
-					htmlBody = emailData.HTML
-				} else if emailData.Body != "" {
-					// Wrap plain body in basic HTML
-					htmlBody = wrapInHTMLEmail(emailData.Body)
-				}
-			}
+	if r.hasLLM(ctx) {
+		var formatted emailMessage
+		if err := r.generateJSON(ctx, prompt, &formatted); err != nil {
+			fmt.Printf("⚠️ Could not format email (%v) - sending plain content\n", err)
+		} else {
+			subject, htmlBody = formatted.Subject, formatted.HTML
 		}
 	}
 
@@ -516,6 +779,7 @@ Return ONLY valid JSON like: {"subject": "...", "html": "<html>...</html>"}`, co
 		subject = "AgentScript Report"
 		htmlBody = wrapInHTMLEmail(content)
 	}
+	htmlBody = r.htmlReferences(ctx, htmlBody)
 
 	// If Google client is available, send real email
 	if r.google != nil {
@@ -535,6 +799,12 @@ Return ONLY valid JSON like: {"subject": "...", "html": "<html>...</html>"}`, co
 	return fmt.Sprintf("Email simulated to %s", to), nil
 }
 
+// emailMessage is the model-formatted email
+type emailMessage struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+}
+
 // wrapInHTMLEmail wraps plain text in a nice HTML template
 func wrapInHTMLEmail(content string) string {
 	// Convert URLs to clickable button-style links
@@ -592,7 +862,7 @@ func (r *Runtime) calendar(ctx context.Context, eventInfo string, content string
 
 Parse this text and extract ALL events/meetings/tasks with times.
 
-Return ONLY a valid JSON array (no markdown, no explanation) where each object has:
+Return a JSON array where each object has:
 - summary: event title (string)
 - description: event description (string) 
 - start: start time in RFC3339 format with timezone offset (e.g., 2026-02-10T15:00:00-08:00 for PST)
@@ -608,43 +878,20 @@ Important:
 Text to parse:
 %s
 
-Return ONLY the JSON array like [{"summary":"...", "description":"...", "start":"...", "end":"..."}, ...]. Even if there's only one event, return it as an array.`, today, timezone, timezone, fullText)
-
-	type EventData struct {
-		Summary     string `json:"summary"`
-		Description string `json:"description"`
-		Start       string `json:"start"`
-		End         string `json:"end"`
-	}
-
-	var events []EventData
-
-	if r.gemini != nil {
-		parsed, err := r.geminiCall(ctx, prompt)
-		if err == nil {
-			// Clean up the response - remove markdown code blocks if present
-			parsed = strings.TrimSpace(parsed)
-			parsed = strings.TrimPrefix(parsed, "```json")
-			parsed = strings.TrimPrefix(parsed, "```")
-			parsed = strings.TrimSuffix(parsed, "```")
-			parsed = strings.TrimSpace(parsed)
-
-			if err := json.Unmarshal([]byte(parsed), &events); err != nil {
-				// Try single event fallback
-				var single EventData
-				if json.Unmarshal([]byte(parsed), &single) == nil && single.Summary != "" {
-					events = []EventData{single}
-				} else {
-					r.log("Failed to parse calendar JSON: %v\nResponse: %s", err, parsed)
-				}
-			}
+Even if there's only one event, return it as an array.`, today, timezone, timezone, fullText)
+
+	var events []calendarEvent
+
+	if r.hasLLM(ctx) {
+		if err := r.generateJSON(ctx, prompt, &events); err != nil {
+			return "", fmt.Errorf("failed to parse events: %w", err)
 		}
 	}
 
-	// Fallback if no events parsed
+	// Without a model, create a single event an hour from now
 	if len(events) == 0 {
 		now := time.Now()
-		events = []EventData{{
+		events = []calendarEvent{{
 			Summary:     eventInfo,
 			Description: content,
 			Start:       now.Add(1 * time.Hour).Format(time.RFC3339),
@@ -682,40 +929,48 @@ Return ONLY the JSON array like [{"summary":"...", "description":"...", "start":
 	return fmt.Sprintf("Calendar events simulated: %d events", len(events)), nil
 }
 
+// calendarEvent is an event parsed from free text by calendar and meet
+type calendarEvent struct {
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Start       string `json:"start" jsonschema:"format=date-time"`
+	End         string `json:"end" jsonschema:"format=date-time"`
+}
+
+// Validate rejects events that do not end after they start
+func (e *calendarEvent) Validate() error {
+	start, err1 := time.Parse(time.RFC3339, e.Start)
+	end, err2 := time.Parse(time.RFC3339, e.End)
+	if err1 == nil && err2 == nil && !end.After(start) {
+		return &ValidationError{"end", "must be after start"}
+	}
+	return nil
+}
+
 // meet creates a Google Meet event
 func (r *Runtime) meet(ctx context.Context, eventInfo string, content string) (string, error) {
 	r.log("MEET: %s", eventInfo)
 
 	// Use Gemini to parse event details
-	prompt := fmt.Sprintf(`Parse this meeting information and return ONLY a JSON object with these fields:
+	prompt := fmt.Sprintf(`Today is %s. Parse this meeting information into a JSON object with these fields:
 - summary: meeting title
 - description: meeting description/agenda
 - start: start time in RFC3339 format (e.g., 2024-01-15T10:00:00-08:00)
-- end: end time in RFC3339 format
+- end: end time in RFC3339 format (if not specified, assume 1 hour after start)
 
 Meeting info: %s
 
 Additional context:
-%s`, eventInfo, content)
+%s`, time.Now().Format("Monday 2006-01-02 -07:00"), eventInfo, content)
 
 	var summary, description, startTime, endTime string
 
-	if r.gemini != nil {
-		parsed, err := r.geminiCall(ctx, prompt)
-		if err == nil {
-			var eventData struct {
-				Summary     string `json:"summary"`
-				Description string `json:"description"`
-				Start       string `json:"start"`
-				End         string `json:"end"`
-			}
-			if json.Unmarshal([]byte(parsed), &eventData) == nil {
-				summary = eventData.Summary
-				description = eventData.Description
-				startTime = eventData.Start
-				endTime = eventData.End
-			}
+	if r.hasLLM(ctx) {
+		var event calendarEvent
+		if err := r.generateJSON(ctx, prompt, &event); err != nil {
+			return "", fmt.Errorf("failed to parse meeting: %w", err)
 		}
+		summary, description, startTime, endTime = event.Summary, event.Description, event.Start, event.End
 	}
 
 	if summary == "" {
@@ -775,6 +1030,7 @@ func (r *Runtime) driveSave(ctx context.Context, path string, content string) (s
 // docCreate creates a Google Doc
 func (r *Runtime) docCreate(ctx context.Context, title string, content string) (string, error) {
 	r.log("DOC_CREATE: %s", title)
+	content = r.withReferences(ctx, content, "")
 
 	if r.google != nil {
 		doc, err := r.google.CreateDoc(ctx, title, content)
@@ -806,6 +1062,9 @@ func (r *Runtime) sheetAppend(ctx context.Context, sheetRef string, content stri
 		sheetName = parts[1]
 	}
 
+	// JSON records (e.g. from extract) become one row each
+	content = sheetRows(content, false)
+
 	if r.google != nil {
 		err := r.google.AppendToSheet(ctx, spreadsheetID, sheetName, content)
 		if err != nil {
@@ -829,6 +1088,9 @@ func (r *Runtime) sheetAppend(ctx context.Context, sheetRef string, content stri
 func (r *Runtime) sheetCreate(ctx context.Context, title string, content string) (string, error) {
 	r.log("SHEET_CREATE: %s", title)
 
+	// JSON records (e.g. from extract) become a header row and one row each
+	content = sheetRows(content, true)
+
 	if r.google != nil {
 		sheet, err := r.google.CreateSheet(ctx, title)
 		if err != nil {
@@ -956,11 +1218,13 @@ func (r *Runtime) imageGenerate(ctx context.Context, prompt string, input string
 		fullPrompt = prompt + ". Context: " + input
 	}
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for image generation")
-	}
-
-	imageBytes, err := r.gemini.GenerateImage(ctx, fullPrompt)
+	imageBytes, err := tryChain(ctx, r, capImage, r.chain(capImage, ""), func(name string) ([]byte, error) {
+		m, err := r.media(name)
+		if err != nil {
+			return nil, err
+		}
+		return m.GenerateImage(ctx, fullPrompt)
+	})
 	if err != nil {
 		return "", fmt.Errorf("image generation failed: %w", err)
 	}
@@ -981,9 +1245,13 @@ func (r *Runtime) imageGenerate(ctx context.Context, prompt string, input string
 // imageAnalyze analyzes an image file
 func (r *Runtime) imageAnalyze(ctx context.Context, imagePath string, prompt string) (string, error) {
 	r.log("IMAGE_ANALYZE: %s", imagePath)
+	if err := r.checkPath(imagePath, "read"); err != nil {
+		return "", err
+	}
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for image analysis")
+	p, opts, err := r.llm(ctx)
+	if err != nil {
+		return "", fmt.Errorf("image analysis: %w", err)
 	}
 
 	// Default prompt if none provided
@@ -992,7 +1260,7 @@ func (r *Runtime) imageAnalyze(ctx context.Context, imagePath string, prompt str
 		analysisPrompt = "Describe this image in detail. What do you see?"
 	}
 
-	result, err := r.gemini.AnalyzeImage(ctx, imagePath, analysisPrompt)
+	result, err := p.GenerateWithFiles(ctx, analysisPrompt, []string{imagePath}, opts)
 	if err != nil {
 		return "", fmt.Errorf("image analysis failed: %w", err)
 	}
@@ -1003,9 +1271,13 @@ func (r *Runtime) imageAnalyze(ctx context.Context, imagePath string, prompt str
 // videoAnalyze analyzes a video file
 func (r *Runtime) videoAnalyze(ctx context.Context, videoPath string, prompt string) (string, error) {
 	r.log("VIDEO_ANALYZE: %s", videoPath)
+	if err := r.checkPath(videoPath, "read"); err != nil {
+		return "", err
+	}
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for video analysis")
+	p, opts, err := r.llm(ctx)
+	if err != nil {
+		return "", fmt.Errorf("video analysis: %w", err)
 	}
 
 	// Default prompt if none provided
@@ -1014,7 +1286,7 @@ func (r *Runtime) videoAnalyze(ctx context.Context, videoPath string, prompt str
 		analysisPrompt = "Describe what happens in this video. Summarize the key moments and content."
 	}
 
-	result, err := r.gemini.AnalyzeVideo(ctx, videoPath, analysisPrompt)
+	result, err := p.GenerateWithFiles(ctx, analysisPrompt, []string{videoPath}, opts)
 	if err != nil {
 		return "", fmt.Errorf("video analysis failed: %w", err)
 	}
@@ -1026,10 +1298,6 @@ func (r *Runtime) videoAnalyze(ctx context.Context, videoPath string, prompt str
 func (r *Runtime) videoGenerate(ctx context.Context, prompt string, input string) (string, error) {
 	r.log("VIDEO_GENERATE: %s", prompt)
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for video generation")
-	}
-
 	// Combine prompt with input context if available
 	fullPrompt := prompt
 	if input != "" {
@@ -1048,7 +1316,16 @@ func (r *Runtime) videoGenerate(ctx context.Context, prompt string, input string
 		fmt.Println("🎬 Generating video (this may take a few minutes)...")
 	}
 
-	videoURI, err := r.gemini.GenerateVideo(ctx, fullPrompt, isVertical)
+	videoURI, err := tryChain(ctx, r, capVideo, r.chain(capVideo, ""), func(name string) (string, error) {
+		if name == degradeToImage {
+			return r.degradeVideo(ctx, fullPrompt)
+		}
+		m, err := r.media(name)
+		if err != nil {
+			return "", err
+		}
+		return m.GenerateVideo(ctx, fullPrompt, isVertical)
+	})
 	if err != nil {
 		return "", fmt.Errorf("video generation failed: %w", err)
 	}
@@ -1117,6 +1394,11 @@ func (r *Runtime) imagesToVideo(ctx context.Context, imagesArg string, input str
 	if len(imagePaths) == 0 {
 		return "", fmt.Errorf("no image paths found. Use: images_to_video \"img1.png img2.png\" or pipe from parallel image generation")
 	}
+	for _, p := range imagePaths {
+		if err := r.checkPath(p, "read"); err != nil {
+			return "", err
+		}
+	}
 
 	// Use a default video prompt, or use piped input if it looks like a description
 	videoPrompt := "Create a smooth cinematic video transitioning between these images"
@@ -1167,10 +1449,6 @@ func (r *Runtime) imagesToVideo(ctx context.Context, imagesArg string, input str
 func (r *Runtime) textToSpeech(ctx context.Context, voice string, input string) (string, error) {
 	r.log("TEXT_TO_SPEECH: voice=%s, input=%d bytes", voice, len(input))
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for text-to-speech")
-	}
-
 	// Default voice if not specified
 	if voice == "" {
 		voice = "Kore"
@@ -1184,7 +1462,13 @@ func (r *Runtime) textToSpeech(ctx context.Context, voice string, input string)
 
 	fmt.Printf("🎙️ Converting text to speech (voice: %s)...\n", voice)
 
-	audioPath, err := r.gemini.TextToSpeech(ctx, text, voice)
+	audioPath, err := tryChain(ctx, r, capTTS, r.chain(capTTS, ""), func(name string) (string, error) {
+		m, err := r.media(name)
+		if err != nil {
+			return "", err
+		}
+		return m.TextToSpeech(ctx, text, voice)
+	})
 	if err != nil {
 		return "", fmt.Errorf("text-to-speech failed: %w", err)
 	}
@@ -1236,6 +1520,9 @@ func (r *Runtime) audioVideoMerge(ctx context.Context, outputName string, input
 	if !strings.HasSuffix(outputName, ".mp4") {
 		outputName = outputName + ".mp4"
 	}
+	if err := r.checkPaths(outputName, audioPath, videoPath); err != nil {
+		return "", err
+	}
 
 	fmt.Printf("🎬 Merging audio and video with ffmpeg...\n")
 	fmt.Printf("   Audio: %s\n", audioPath)
@@ -1299,7 +1586,11 @@ func (r *Runtime) imageAudioMerge(ctx context.Context, outputName string, input
 	if audioPath == "" {
 		return "", fmt.Errorf("no audio file found in input - need .wav, .mp3, or .m4a file")
 	}
+	return r.mergeImageAudio(ctx, outputName, imagePath, audioPath)
+}
 
+// mergeImageAudio renders a still image over an audio track as an MP4
+func (r *Runtime) mergeImageAudio(ctx context.Context, outputName, imagePath, audioPath string) (string, error) {
 	// Check files exist
 	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
 		return "", fmt.Errorf("image file not found: %s", imagePath)
@@ -1315,6 +1606,9 @@ func (r *Runtime) imageAudioMerge(ctx context.Context, outputName string, input
 	if !strings.HasSuffix(outputName, ".mp4") {
 		outputName = outputName + ".mp4"
 	}
+	if err := r.checkPaths(outputName, imagePath, audioPath); err != nil {
+		return "", err
+	}
 
 	fmt.Printf("🎬 Creating video from image + audio with ffmpeg...\n")
 	fmt.Printf("   Image: %s\n", imagePath)
@@ -1361,44 +1655,26 @@ func (r *Runtime) imageAudioMerge(ctx context.Context, outputName string, input
 func (r *Runtime) mapsTrip(ctx context.Context, tripName string, input string) (string, error) {
 	r.log("MAPS_TRIP: %s", tripName)
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for maps_trip")
+	if _, _, err := r.llm(ctx); err != nil {
+		return "", fmt.Errorf("maps_trip: %w", err)
 	}
 
 	// Use Gemini to extract places and coordinates
 	prompt := fmt.Sprintf(`From this text, extract all place names that can be visited.
-Return ONLY a JSON array of objects with "name" and "address" fields.
+Return a JSON array of objects with "name" and "address" fields.
 The address should be specific enough for Google Maps (include city/country).
 
 Example output:
 [{"name": "Dubrovnik Old Town", "address": "Dubrovnik, Croatia"}, {"name": "Kotor", "address": "Kotor, Montenegro"}]
 
 Text:
-%s
+%s`, input)
 
-Return ONLY the JSON array, nothing else.`, input)
-
-	parsed, err := r.geminiCall(ctx, prompt)
-	if err != nil {
+	var places []tripStop
+	if err := r.generateJSON(ctx, prompt, &places); err != nil {
 		return "", fmt.Errorf("failed to parse places: %w", err)
 	}
 
-	// Clean up response
-	parsed = strings.TrimSpace(parsed)
-	parsed = strings.TrimPrefix(parsed, "```json")
-	parsed = strings.TrimPrefix(parsed, "```")
-	parsed = strings.TrimSuffix(parsed, "```")
-	parsed = strings.TrimSpace(parsed)
-
-	var places []struct {
-		Name    string `json:"name"`
-		Address string `json:"address"`
-	}
-
-	if err := json.Unmarshal([]byte(parsed), &places); err != nil {
-		return "", fmt.Errorf("failed to parse places JSON: %w", err)
-	}
-
 	if len(places) == 0 {
 		return "", fmt.Errorf("no places found in input")
 	}
@@ -1430,18 +1706,24 @@ Return ONLY the JSON array, nothing else.`, input)
 	return result, nil
 }
 
+// tripStop is a place extracted by maps_trip
+type tripStop struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
 // formCreate creates a Google Form using LLM to generate questions
 func (r *Runtime) formCreate(ctx context.Context, formTitle string, input string) (string, error) {
 	r.log("FORM_CREATE: %s", formTitle)
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for form_create")
+	if _, _, err := r.llm(ctx); err != nil {
+		return "", fmt.Errorf("form_create: %w", err)
 	}
 
 	// Use Gemini to generate form questions from input
 	prompt := fmt.Sprintf(`Based on this context, create a survey/form with appropriate questions.
 
-Return ONLY a valid JSON object with this structure:
+Return a JSON object with this structure:
 {
   "title": "Form Title",
   "description": "Brief description of the form",
@@ -1455,37 +1737,13 @@ Return ONLY a valid JSON object with this structure:
 Question types: text, paragraph, multiple_choice, checkbox, dropdown
 
 Context: %s
-Form title hint: %s
+Form title hint: %s`, input, formTitle)
 
-Return ONLY the JSON, no explanation.`, input, formTitle)
-
-	parsed, err := r.geminiCall(ctx, prompt)
-	if err != nil {
+	var formData formSpec
+	if err := r.generateJSON(ctx, prompt, &formData); err != nil {
 		return "", fmt.Errorf("failed to generate form questions: %w", err)
 	}
 
-	// Clean up response
-	parsed = strings.TrimSpace(parsed)
-	parsed = strings.TrimPrefix(parsed, "```json")
-	parsed = strings.TrimPrefix(parsed, "```")
-	parsed = strings.TrimSuffix(parsed, "```")
-	parsed = strings.TrimSpace(parsed)
-
-	var formData struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		Questions   []struct {
-			Title    string   `json:"title"`
-			Type     string   `json:"type"`
-			Required bool     `json:"required"`
-			Options  []string `json:"options"`
-		} `json:"questions"`
-	}
-
-	if err := json.Unmarshal([]byte(parsed), &formData); err != nil {
-		return "", fmt.Errorf("failed to parse form JSON: %w\nResponse: %s", err, parsed)
-	}
-
 	if formTitle != "" {
 		formData.Title = formTitle
 	}
@@ -1532,6 +1790,28 @@ Return ONLY the JSON, no explanation.`, input, formTitle)
 	return result, nil
 }
 
+// formSpec is the form generated by form_create
+type formSpec struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Questions   []formQuestion `json:"questions" jsonschema:"minItems=1"`
+}
+
+type formQuestion struct {
+	Title    string   `json:"title"`
+	Type     string   `json:"type" jsonschema:"enum=text|paragraph|multiple_choice|checkbox|dropdown"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+}
+
+// Validate requires options for choice questions
+func (q *formQuestion) Validate() error {
+	if q.Type != "text" && q.Type != "paragraph" && len(q.Options) == 0 {
+		return &ValidationError{"options", q.Type + " questions need options"}
+	}
+	return nil
+}
+
 // formResponses retrieves responses from a Google Form
 func (r *Runtime) formResponses(ctx context.Context, formId string, input string) (string, error) {
 	r.log("FORM_RESPONSES: %s", formId)
@@ -1593,8 +1873,8 @@ func (r *Runtime) formResponses(ctx context.Context, formId string, input string
 func (r *Runtime) translate(ctx context.Context, targetLang string, input string) (string, error) {
 	r.log("TRANSLATE: to %s, input=%d bytes", targetLang, len(input))
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for translate")
+	if _, _, err := r.llm(ctx); err != nil {
+		return "", fmt.Errorf("translate: %w", err)
 	}
 
 	if input == "" {
@@ -1605,11 +1885,14 @@ func (r *Runtime) translate(ctx context.Context, targetLang string, input string
 		targetLang = "Spanish"
 	}
 
-	prompt := fmt.Sprintf("Translate the following text to %s. Return ONLY the translated text, nothing else:\n\n%s", targetLang, input)
+	instruction := fmt.Sprintf("Translate the following text to %s. Return ONLY the translated text, nothing else:\n\n", targetLang)
 
 	fmt.Printf("🌐 Translating to %s...\n", targetLang)
 
-	translated, err := r.geminiCall(ctx, prompt)
+	// Long texts are translated chunk by chunk and joined back together
+	translated, err := r.llmOverInput(ctx, instruction+input, input, mapReduce{
+		mapPrompt: func(chunk string, _, _ int) string { return instruction + chunk },
+	})
 	if err != nil {
 		return "", fmt.Errorf("translation failed: %w", err)
 	}
@@ -1622,8 +1905,8 @@ func (r *Runtime) translate(ctx context.Context, targetLang string, input string
 func (r *Runtime) placesSearch(ctx context.Context, query string, input string) (string, error) {
 	r.log("PLACES_SEARCH: %s", query)
 
-	if r.gemini == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY required for places_search")
+	if _, _, err := r.llm(ctx); err != nil {
+		return "", fmt.Errorf("places_search: %w", err)
 	}
 
 	// Combine query and input
@@ -1638,26 +1921,46 @@ func (r *Runtime) placesSearch(ctx context.Context, query string, input string)
 		return "", fmt.Errorf("no search query - provide query as argument or pipe location")
 	}
 
-	prompt := fmt.Sprintf(`Search for places: %s
-
-Return a list of 10 places with the following information for each:
-- Name
-- Address  
-- Rating (out of 5)
-- Brief description
-- Google Maps link (format: https://www.google.com/maps/search/PLACE+NAME+ADDRESS)
-
-Format as a numbered list.`, searchQuery)
-
 	fmt.Printf("📍 Searching for places: %s...\n", searchQuery)
 
-	result, err := r.geminiCall(ctx, prompt)
+	found, err := r.groundedSearch(ctx, fmt.Sprintf(`Search for places: %s
+
+Find up to 10 real places. For each give its name, full street address, Google rating out of 5 if known, and a one-sentence description.`, searchQuery))
 	if err != nil {
 		return "", fmt.Errorf("places search failed: %w", err)
 	}
 
-	fmt.Printf("✅ Found places\n")
-	return result, nil
+	var places []placeResult
+	if err := r.generateJSON(ctx, "List the places described below. Use only places and details that appear in the text.\n\n"+found.Text, &places); err != nil {
+		return "", fmt.Errorf("places search failed: %w", err)
+	}
+
+	// Map links are built here rather than by the model so they always work
+	var b strings.Builder
+	for i, p := range places {
+		fmt.Fprintf(&b, "%d. %s\n   Address: %s\n", i+1, p.Name, p.Address)
+		if p.Rating > 0 {
+			fmt.Fprintf(&b, "   Rating: %.1f/5\n", p.Rating)
+		}
+		if p.Description != "" {
+			fmt.Fprintf(&b, "   %s\n", p.Description)
+		}
+		fmt.Fprintf(&b, "   Map: %s\n\n", mapsSearchURL(p.Name+", "+p.Address))
+	}
+	if len(found.Sources) > 0 {
+		b.WriteString(formatSources(found.Sources))
+	}
+
+	fmt.Printf("✅ Found %d places\n", len(places))
+	return strings.TrimSpace(b.String()), nil
+}
+
+// placeResult is a place found by places_search
+type placeResult struct {
+	Name        string  `json:"name"`
+	Address     string  `json:"address"`
+	Rating      float64 `json:"rating,omitempty"`
+	Description string  `json:"description,omitempty"`
 }
 
 // videoScript converts content into a Veo-optimized video prompt with synchronized dialogue
@@ -1666,8 +1969,10 @@ Format as a numbered list.`, searchQuery)
 func (r *Runtime) videoScript(ctx context.Context, style string, input string) (string, error) {
 	r.log("VIDEO_SCRIPT: style=%s, input=%d bytes", style, len(input))
 
-	if r.gemini == nil && r.claude == nil {
-		return "", fmt.Errorf("GEMINI_API_KEY or CLAUDE_API_KEY required for video script generation")
+	// Claude writes the script unless the step picks a provider
+	p, opts, err := r.llmPreferring(ctx, "claude")
+	if err != nil {
+		return "", fmt.Errorf("video script generation: %w", err)
 	}
 
 	if input == "" {
@@ -1705,15 +2010,7 @@ Modern news studio with blue accent lighting, medium close-up shot, portrait 9:1
 
 NOW CONVERT THE CONTENT ABOVE:`, input, style)
 
-	var result string
-	var err error
-
-	if r.claude != nil {
-		result, err = r.claude.Chat(ctx, prompt)
-	} else {
-		result, err = r.geminiCall(ctx, prompt)
-	}
-
+	result, err := p.Generate(ctx, prompt, opts)
 	if err != nil {
 		return "", fmt.Errorf("video script generation failed: %w", err)
 	}
@@ -1745,6 +2042,9 @@ func (r *Runtime) youtubeUpload(ctx context.Context, title string, input string,
 	}
 
 	// Check if file exists
+	if err := r.checkPath(videoPath, "read"); err != nil {
+		return "", err
+	}
 	if _, err := os.Stat(videoPath); os.IsNotExist(err) {
 		return "", fmt.Errorf("video file not found: %s", videoPath)
 	}
@@ -1846,11 +2146,11 @@ func (r *Runtime) githubPages(ctx context.Context, title string, input string) (
 		if err != nil {
 			return "", fmt.Errorf("Claude React generation failed: %w", err)
 		}
-	} else if r.gemini != nil {
-		fmt.Printf("🎨 Generating React SPA with Gemini...\n")
+	} else if r.hasLLM(ctx) {
+		fmt.Printf("🎨 Generating React SPA...\n")
 		reactCode, err = r.generateReactSPA(ctx, title, input)
 		if err != nil {
-			return "", fmt.Errorf("Gemini React generation failed: %w", err)
+			return "", fmt.Errorf("React generation failed: %w", err)
 		}
 	} else {
 		fmt.Printf("\n❌ No AI API key configured for React SPA generation.\n")
@@ -1863,6 +2163,7 @@ func (r *Runtime) githubPages(ctx context.Context, title string, input string) (
 		return "", fmt.Errorf("CLAUDE_API_KEY or GEMINI_API_KEY required for github_pages")
 	}
 
+	reactCode = r.htmlReferences(ctx, reactCode)
 	fmt.Printf("🚀 Deploying to GitHub Pages: %s...\n", title)
 
 	pagesURL, err := r.github.DeployReactSPA(ctx, repoName, title, reactCode)
@@ -1900,7 +2201,7 @@ OUTPUT FORMAT:
 Return ONLY the HTML code starting with <!DOCTYPE html> and ending with </html>
 No markdown, no explanation, just the raw HTML/React code.`, title, content)
 
-	result, err := r.geminiCall(ctx, prompt)
+	result, err := r.llmCallFormat(ctx, prompt, "html")
 	if err != nil {
 		return "", err
 	}
@@ -1957,6 +2258,7 @@ func (r *Runtime) githubPagesHTML(ctx context.Context, title string, input strin
 	repoName = strings.ReplaceAll(repoName, "'", "")
 	repoName = strings.ReplaceAll(repoName, "\"", "")
 
+	input = r.htmlReferences(ctx, input)
 	fmt.Printf("🚀 Deploying simple HTML to GitHub Pages: %s...\n", title)
 
 	pagesURL, err := r.github.DeployToPages(ctx, repoName, title, input)
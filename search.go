@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default base URLs of the hosted search APIs
+const (
+	defaultBraveBaseURL = "https://api.search.brave.com/res/v1"
+	defaultBingBaseURL  = "https://api.bing.microsoft.com/v7.0"
+)
+
+// defaultSearchCount is how many results search returns without count=
+const defaultSearchCount = 5
+
+// SearchResult is one web search hit
+type SearchResult struct {
+	ID      int    `json:"id,omitempty"` // source id for citations
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+	Date    string `json:"date,omitempty"`
+}
+
+// SearchOptions narrow a search. Backends ignore what their API lacks.
+type SearchOptions struct {
+	Count     int      // results to return
+	Freshness string   // day, week, month or year
+	Sites     []string // only return results from these domains
+	Region    string   // country code such as "us" or "de"
+}
+
+// SearchBackend is a web search API
+type SearchBackend interface {
+	Name() string
+	Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error)
+}
+
+// searchBackends lists the names accepted in SEARCH_PROVIDER
+var searchBackends = []string{"serpapi", "brave", "bing", "searxng"}
+
+// NewSearchBackend creates the named backend. baseURL may be empty to use
+// the service's default; SearxNG is self-hosted and always needs one.
+func NewSearchBackend(name, apiKey, baseURL string) (SearchBackend, error) {
+	switch name {
+	case "", "serpapi":
+		if baseURL == "" {
+			baseURL = defaultSearchBaseURL
+		}
+		return &serpAPISearch{apiKey: apiKey, baseURL: baseURL}, nil
+	case "brave":
+		if baseURL == "" {
+			baseURL = defaultBraveBaseURL
+		}
+		return &braveSearch{apiKey: apiKey, baseURL: baseURL}, nil
+	case "bing":
+		if baseURL == "" {
+			baseURL = defaultBingBaseURL
+		}
+		return &bingSearch{apiKey: apiKey, baseURL: baseURL}, nil
+	case "searxng":
+		if baseURL == "" {
+			return nil, fmt.Errorf("SEARCH_BASE_URL must point at your SearxNG instance")
+		}
+		return &searxngSearch{baseURL: baseURL}, nil
+	}
+	return nil, fmt.Errorf("unknown search provider %q (expected %s)", name, strings.Join(searchBackends, ", "))
+}
+
+// searchOptions reads count=, freshness=, site= and region= from a step
+func searchOptions(cmd *Command) (SearchOptions, error) {
+	opts := SearchOptions{Count: defaultSearchCount}
+	if cmd == nil {
+		return opts, nil
+	}
+	if v, ok := cmd.Option("count"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("invalid count %q", v)
+		}
+		opts.Count = n
+	}
+	if v, ok := cmd.Option("freshness"); ok {
+		switch v {
+		case "day", "week", "month", "year":
+			opts.Freshness = v
+		default:
+			return opts, fmt.Errorf("invalid freshness %q (expected day, week, month or year)", v)
+		}
+	}
+	if v, ok := cmd.Option("site"); ok {
+		for _, site := range strings.Split(v, ",") {
+			if site = strings.TrimSpace(site); site != "" {
+				opts.Sites = append(opts.Sites, site)
+			}
+		}
+	}
+	if v, ok := cmd.Option("region"); ok {
+		opts.Region = strings.ToLower(v)
+	}
+	return opts, nil
+}
+
+// withSites adds site: operators to a query, which every backend supports
+func withSites(query string, sites []string) string {
+	if len(sites) == 0 {
+		return query
+	}
+	var ops []string
+	for _, site := range sites {
+		ops = append(ops, "site:"+site)
+	}
+	return query + " (" + strings.Join(ops, " OR ") + ")"
+}
+
+// getSearchJSON performs a search request and decodes the JSON response
+func getSearchJSON(ctx context.Context, service, endpoint string, headers map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create search request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read search response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{Provider: service, StatusCode: resp.StatusCode, Message: firstLine(string(body))}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse search response: %w", err)
+	}
+	return nil
+}
+
+// htmlTags matches the markup some APIs put in snippets
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes highlighting markup such as <strong> from a snippet
+func stripTags(s string) string {
+	return html.UnescapeString(htmlTags.ReplaceAllString(s, ""))
+}
+
+// serpAPISearch uses SerpAPI's Google results
+type serpAPISearch struct {
+	apiKey  string
+	baseURL string
+}
+
+func (s *serpAPISearch) Name() string { return "serpapi" }
+
+func (s *serpAPISearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":       {withSites(query, opts.Sites)},
+		"api_key": {s.apiKey},
+		"num":     {strconv.Itoa(opts.Count)},
+	}
+	if opts.Freshness != "" {
+		params.Set("tbs", "qdr:"+opts.Freshness[:1]) // d, w, m or y
+	}
+	if opts.Region != "" {
+		params.Set("gl", opts.Region)
+	}
+
+	var resp struct {
+		Error          string `json:"error"`
+		OrganicResults []struct {
+			Title   string `json:"title"`
+			Link    string `json:"link"`
+			Snippet string `json:"snippet"`
+			Date    string `json:"date"`
+		} `json:"organic_results"`
+	}
+	if err := getSearchJSON(ctx, "SerpAPI", s.baseURL+"/search.json?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" && len(resp.OrganicResults) == 0 && !strings.Contains(resp.Error, "hasn't returned any results") {
+		return nil, fmt.Errorf("SerpAPI error: %s", resp.Error)
+	}
+
+	var results []SearchResult
+	for _, r := range resp.OrganicResults {
+		results = append(results, SearchResult{Title: r.Title, URL: r.Link, Snippet: r.Snippet, Date: r.Date})
+	}
+	return results, nil
+}
+
+// braveSearch uses the Brave Search API
+type braveSearch struct {
+	apiKey  string
+	baseURL string
+}
+
+func (s *braveSearch) Name() string { return "brave" }
+
+func (s *braveSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":     {withSites(query, opts.Sites)},
+		"count": {strconv.Itoa(min(opts.Count, 20))}, // the API maximum
+	}
+	if opts.Freshness != "" {
+		params.Set("freshness", "p"+opts.Freshness[:1]) // pd, pw, pm or py
+	}
+	if opts.Region != "" {
+		params.Set("country", opts.Region)
+	}
+
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+				PageAge     string `json:"page_age"`
+				Age         string `json:"age"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	headers := map[string]string{"X-Subscription-Token": s.apiKey}
+	if err := getSearchJSON(ctx, "Brave Search", s.baseURL+"/web/search?"+params.Encode(), headers, &resp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range resp.Web.Results {
+		date := r.PageAge
+		if date == "" {
+			date = r.Age
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description), Date: date})
+	}
+	return results, nil
+}
+
+// bingSearch uses the Bing Web Search API
+type bingSearch struct {
+	apiKey  string
+	baseURL string
+}
+
+func (s *bingSearch) Name() string { return "bing" }
+
+func (s *bingSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":     {withSites(query, opts.Sites)},
+		"count": {strconv.Itoa(min(opts.Count, 50))}, // the API maximum
+	}
+	switch opts.Freshness {
+	case "day", "week", "month":
+		params.Set("freshness", strings.ToUpper(opts.Freshness[:1])+opts.Freshness[1:])
+	case "year":
+		// Bing has no year value, but takes a date range
+		now := time.Now()
+		params.Set("freshness", now.AddDate(-1, 0, 0).Format(time.DateOnly)+".."+now.Format(time.DateOnly))
+	}
+	if opts.Region != "" {
+		params.Set("cc", opts.Region)
+	}
+
+	var resp struct {
+		WebPages struct {
+			Value []struct {
+				Name            string `json:"name"`
+				URL             string `json:"url"`
+				Snippet         string `json:"snippet"`
+				DatePublished   string `json:"datePublished"`
+				DateLastCrawled string `json:"dateLastCrawled"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	headers := map[string]string{"Ocp-Apim-Subscription-Key": s.apiKey}
+	if err := getSearchJSON(ctx, "Bing", s.baseURL+"/search?"+params.Encode(), headers, &resp); err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range resp.WebPages.Value {
+		date := r.DatePublished
+		if date == "" {
+			date = r.DateLastCrawled
+		}
+		results = append(results, SearchResult{Title: r.Name, URL: r.URL, Snippet: r.Snippet, Date: date})
+	}
+	return results, nil
+}
+
+// searxngSearch uses a self-hosted SearxNG instance with its JSON output
+// format enabled (search.formats in settings.yml)
+type searxngSearch struct {
+	baseURL string
+}
+
+func (s *searxngSearch) Name() string { return "searxng" }
+
+func (s *searxngSearch) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchResult, error) {
+	params := url.Values{
+		"q":      {withSites(query, opts.Sites)},
+		"format": {"json"},
+	}
+	if opts.Freshness != "" {
+		params.Set("time_range", opts.Freshness)
+	}
+	if opts.Region != "" {
+		params.Set("language", "all-"+strings.ToUpper(opts.Region))
+	}
+
+	var resp struct {
+		Results []struct {
+			Title         string `json:"title"`
+			URL           string `json:"url"`
+			Content       string `json:"content"`
+			PublishedDate string `json:"publishedDate"`
+		} `json:"results"`
+	}
+	if err := getSearchJSON(ctx, "SearxNG", s.baseURL+"/search?"+params.Encode(), nil, &resp); err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("SearxNG refused JSON output - add json to search.formats in settings.yml")
+		}
+		return nil, err
+	}
+
+	var results []SearchResult
+	for _, r := range resp.Results {
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content, Date: r.PublishedDate})
+	}
+	return results, nil
+}
+
+// search runs a web search. With a search backend it returns the results
+// as a JSON array of {title, url, snippet, date}; without one, Gemini
+// searches with google_search grounding and returns a cited summary.
+func (r *Runtime) search(ctx context.Context, cmd *Command, query string) (string, error) {
+	opts, err := searchOptions(cmd)
+	if err != nil {
+		return "", err
+	}
+	if r.searcher != nil {
+		results, err := r.searcher.Search(ctx, query, opts)
+		if err == nil {
+			if len(results) > opts.Count {
+				results = results[:opts.Count]
+			}
+			fmt.Printf("🔎 %d results from %s\n", len(results), r.searcher.Name())
+			if results == nil {
+				results = []SearchResult{}
+			}
+			sources := make([]Citation, len(results))
+			for i, res := range results {
+				sources[i] = Citation{Title: res.Title, URL: res.URL}
+			}
+			for i, src := range r.addSources(ctx, sources) {
+				results[i].ID = src.ID
+			}
+			return toJSON(results), nil
+		}
+		if !shouldFallback(err) {
+			return "", fmt.Errorf("%s search failed: %w", r.searcher.Name(), err)
+		}
+		r.recordFallback(ctx, "search", r.searcher.Name(), "gemini grounding", err)
+	}
+
+	answer, err := r.groundedSearch(ctx, fmt.Sprintf(`Search the web for: %s%s
+
+Give a factual summary of what current sources say, with the key facts, figures, names and dates.`, query, describeSearchOptions(opts)))
+	if err != nil {
+		return "", err
+	}
+	return answer.String(), nil
+}
+
+// describeSearchOptions phrases the filters for a grounded search prompt
+func describeSearchOptions(opts SearchOptions) string {
+	var parts []string
+	if opts.Freshness != "" {
+		parts = append(parts, "published in the past "+opts.Freshness)
+	}
+	if len(opts.Sites) > 0 {
+		parts = append(parts, "from "+strings.Join(opts.Sites, " or "))
+	}
+	if opts.Region != "" {
+		parts = append(parts, "relevant to region "+strings.ToUpper(opts.Region))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "\nOnly use sources " + strings.Join(parts, ", ") + "."
+}
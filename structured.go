@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxStructuredAttempts is how many times a model is asked for valid JSON
+const maxStructuredAttempts = 3
+
+// StructuredOutputError is returned when a model's reply still does not
+// decode or validate after every attempt
+type StructuredOutputError struct {
+	Attempts int
+	Reply    string // the last reply
+	Err      error  // why the last reply was rejected
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("model returned invalid JSON after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error { return e.Err }
+
+// ValidationError describes a decoded value that breaks its schema
+type ValidationError struct {
+	Path    string // e.g. "events[0].start"
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// validator is implemented by result types with rules beyond the schema,
+// such as an event ending after it starts
+type validator interface {
+	Validate() error
+}
+
+// generateJSON asks the current step's provider for JSON matching the type
+// out points to, using the provider's JSON mode with a schema derived from
+// that type. The reply is decoded into out and validated; an invalid reply
+// is sent back to the model with the problem until it gets it right or
+// maxStructuredAttempts is reached.
+//
+// Struct fields are required unless their json tag has omitempty. A
+// jsonschema tag adds constraints, separated by commas:
+//
+//	Start string `json:"start" jsonschema:"format=date-time"`
+//	Type  string `json:"type" jsonschema:"enum=text|paragraph"`
+//	Stops []Stop `json:"stops" jsonschema:"minItems=1"`
+func (r *Runtime) generateJSON(ctx context.Context, prompt string, out any) error {
+	target := reflect.ValueOf(out)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("generateJSON needs a non-nil pointer, got %T", out)
+	}
+	return r.generateValid(ctx, prompt, schemaFor(target.Elem().Type()), func(reply string) error {
+		return decodeStructured(reply, out)
+	})
+}
+
+// generateSchemaJSON is generateJSON for a schema only known at run time,
+// such as one given to extract. It returns the validated reply as JSON.
+func (r *Runtime) generateSchemaJSON(ctx context.Context, prompt string, schema map[string]any) (string, error) {
+	var result string
+	err := r.generateValid(ctx, prompt, schema, func(reply string) error {
+		reply = stripCodeFence(reply)
+		if schema["type"] == "array" && strings.HasPrefix(reply, "{") {
+			reply = "[" + reply + "]"
+		}
+		var value any
+		if err := json.Unmarshal([]byte(reply), &value); err != nil {
+			return fmt.Errorf("not valid JSON: %w", err)
+		}
+		if err := validateSchema(value, schema, ""); err != nil {
+			return err
+		}
+		result = reply
+		return nil
+	})
+	return result, err
+}
+
+// generateValid asks for JSON matching schema until decode accepts the
+// reply, feeding each rejection back to the model
+func (r *Runtime) generateValid(ctx context.Context, prompt string, schema map[string]any, decode func(reply string) error) error {
+	p, opts, err := r.llm(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := prompt
+	for attempt := 1; ; attempt++ {
+		reply, err := p.GenerateStructured(ctx, request, schema, opts)
+		if err != nil {
+			return err
+		}
+
+		err = decode(reply)
+		if err == nil {
+			return nil
+		}
+		if attempt == maxStructuredAttempts {
+			return &StructuredOutputError{Attempts: attempt, Reply: reply, Err: err}
+		}
+
+		r.log("Invalid structured output (attempt %d): %v", attempt, err)
+		request = fmt.Sprintf(`%s
+
+Your previous reply was rejected: %v
+
+Previous reply:
+%s
+
+Reply again with corrected JSON only.`, prompt, err, reply)
+	}
+}
+
+// decodeStructured decodes and validates a model reply. A single object
+// is accepted where an array is expected.
+func decodeStructured(reply string, out any) error {
+	reply = stripCodeFence(reply)
+	target := reflect.ValueOf(out).Elem()
+
+	// Start from the zero value so a failed attempt leaves nothing behind
+	target.Set(reflect.Zero(target.Type()))
+	if target.Kind() == reflect.Slice && strings.HasPrefix(reply, "{") {
+		reply = "[" + reply + "]"
+	}
+	if err := json.Unmarshal([]byte(reply), out); err != nil {
+		return fmt.Errorf("not valid JSON for the schema: %w", err)
+	}
+	return validateValue(target, "")
+}
+
+// schemaFor derives a JSON schema from a Go type
+func schemaFor(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, optional, ok := jsonField(f)
+			if !ok {
+				continue
+			}
+			prop := schemaFor(f.Type)
+			for key, value := range schemaTag(f) {
+				switch key {
+				case "enum":
+					var values []any
+					for _, v := range strings.Split(value, "|") {
+						values = append(values, v)
+					}
+					prop["enum"] = values
+				case "minItems":
+					n, _ := strconv.Atoi(value)
+					prop["minItems"] = n
+				default:
+					prop[key] = value
+				}
+			}
+			props[name] = prop
+			if !optional {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// validateValue checks required fields and jsonschema tag constraints,
+// then any Validate method
+func validateValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return validateValue(v.Elem(), path)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, optional, ok := jsonField(f)
+			if !ok {
+				continue
+			}
+			fv := v.Field(i)
+			fieldPath := joinPath(path, name)
+			if !optional && isEmpty(fv) {
+				return &ValidationError{fieldPath, "is required"}
+			}
+			if err := checkConstraints(fv, fieldPath, schemaTag(f)); err != nil {
+				return err
+			}
+			if err := validateValue(fv, fieldPath); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v.CanAddr() {
+		if val, ok := v.Addr().Interface().(validator); ok {
+			if err := val.Validate(); err != nil {
+				var verr *ValidationError
+				if errors.As(err, &verr) {
+					return &ValidationError{joinPath(path, verr.Path), verr.Message}
+				}
+				return &ValidationError{path, err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSchema checks a decoded JSON value against the parts of JSON
+// Schema that models are asked to follow: type, properties, required,
+// items, enum, minItems, maxItems and the date and date-time formats.
+// Other keywords are ignored.
+func validateSchema(value any, schema map[string]any, path string) error {
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(value, e) {
+				found = true
+			}
+		}
+		if !found {
+			return &ValidationError{path, fmt.Sprintf("%v is not one of %v", value, enum)}
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return &ValidationError{path, "must be an object"}
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if key, ok := name.(string); ok && isMissing(obj[key]) {
+				return &ValidationError{joinPath(path, key), "is required"}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		for key, prop := range props {
+			propSchema, ok := prop.(map[string]any)
+			if v, present := obj[key]; ok && present && v != nil {
+				if err := validateSchema(v, propSchema, joinPath(path, key)); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return &ValidationError{path, "must be an array"}
+		}
+		if min, ok := schema["minItems"].(float64); ok && float64(len(items)) < min {
+			return &ValidationError{path, fmt.Sprintf("needs at least %d item(s)", int(min))}
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(items)) > max {
+			return &ValidationError{path, fmt.Sprintf("allows at most %d item(s)", int(max))}
+		}
+		itemSchema, _ := schema["items"].(map[string]any)
+		for i, item := range items {
+			if err := validateSchema(item, itemSchema, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return &ValidationError{path, "must be a string"}
+		}
+		layout := map[any]string{"date-time": time.RFC3339, "date": time.DateOnly}[schema["format"]]
+		if layout != "" && s != "" {
+			if _, err := time.Parse(layout, s); err != nil {
+				return &ValidationError{path, fmt.Sprintf("%q is not a %s", s, schema["format"])}
+			}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return &ValidationError{path, "must be a number"}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return &ValidationError{path, "must be an integer"}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return &ValidationError{path, "must be true or false"}
+		}
+	}
+	return nil
+}
+
+// isMissing reports whether a required JSON value is absent or blank
+func isMissing(v any) bool {
+	s, isString := v.(string)
+	return v == nil || isString && strings.TrimSpace(s) == ""
+}
+
+// checkConstraints applies enum, format and minItems to a field
+func checkConstraints(v reflect.Value, path string, tag map[string]string) error {
+	if enum, ok := tag["enum"]; ok && v.Kind() == reflect.String && v.String() != "" {
+		allowed := strings.Split(enum, "|")
+		found := false
+		for _, a := range allowed {
+			if v.String() == a {
+				found = true
+			}
+		}
+		if !found {
+			return &ValidationError{path, fmt.Sprintf("%q is not one of %s", v.String(), strings.Join(allowed, ", "))}
+		}
+	}
+	if tag["format"] == "date-time" && v.Kind() == reflect.String && v.String() != "" {
+		if _, err := time.Parse(time.RFC3339, v.String()); err != nil {
+			return &ValidationError{path, fmt.Sprintf("%q is not an RFC3339 time", v.String())}
+		}
+	}
+	if min, ok := tag["minItems"]; ok && v.Kind() == reflect.Slice {
+		if n, _ := strconv.Atoi(min); v.Len() < n {
+			return &ValidationError{path, fmt.Sprintf("needs at least %d item(s)", n)}
+		}
+	}
+	return nil
+}
+
+// jsonField returns a field's JSON name and whether it is optional
+func jsonField(f reflect.StructField) (name string, optional, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(opts, "omitempty"), true
+}
+
+// schemaTag parses a jsonschema:"key=value,key=value" tag
+func schemaTag(f reflect.StructField) map[string]string {
+	tag := map[string]string{}
+	for _, item := range strings.Split(f.Tag.Get("jsonschema"), ",") {
+		if key, value, ok := strings.Cut(item, "="); ok {
+			tag[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return tag
+}
+
+// isEmpty reports whether a required value is missing. False and zero are
+// legitimate values, so only strings, slices, maps and pointers count.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.IsNil()
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	switch {
+	case path == "":
+		return name
+	case name == "":
+		return path
+	}
+	return path + "." + name
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// agenda wraps events so validation paths start with a field name
+type agenda struct {
+	Events []calendarEvent `json:"events"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	got := schemaFor(reflect.TypeOf(formSpec{}))
+	want := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"title":       map[string]any{"type": "string"},
+			"description": map[string]any{"type": "string"},
+			"questions": map[string]any{
+				"type":     "array",
+				"minItems": 1,
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"title": map[string]any{"type": "string"},
+						"type": map[string]any{
+							"type": "string",
+							"enum": []any{"text", "paragraph", "multiple_choice", "checkbox", "dropdown"},
+						},
+						"required": map[string]any{"type": "boolean"},
+						"options":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					},
+					"required": []string{"title", "type", "required"},
+				},
+			},
+		},
+		"required": []string{"title", "questions"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("schemaFor(formSpec) =\n%s", gotJSON)
+	}
+
+	event := schemaFor(reflect.TypeOf(calendarEvent{}))
+	start := event["properties"].(map[string]any)["start"]
+	if want := map[string]any{"type": "string", "format": "date-time"}; !reflect.DeepEqual(start, want) {
+		t.Errorf("start schema = %v, want %v", start, want)
+	}
+}
+
+func TestDecodeStructured(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		out   any
+		err   string
+	}{
+		// required vs omitempty
+		{"omitempty field may be missing", `{"title": "Survey", "questions": [{"title": "Name?", "type": "text"}]}`, &formSpec{}, ""},
+		{"required field missing", `{"questions": [{"title": "Name?", "type": "text"}]}`, &formSpec{}, "title: is required"},
+		{"required field blank", `{"title": "  ", "questions": [{"title": "Name?", "type": "text"}]}`, &formSpec{}, "title: is required"},
+		{"false bool counts as present", `{"title": "Survey", "questions": [{"title": "Name?", "type": "text", "required": false}]}`, &formSpec{}, ""},
+		{"required slice missing", `{"title": "Survey"}`, &formSpec{}, "questions: is required"},
+
+		// jsonschema tags
+		{"minItems", `{"title": "Survey", "questions": []}`, &formSpec{}, "questions: needs at least 1 item(s)"},
+		{"enum", `{"title": "Survey", "questions": [{"title": "Name?", "type": "essay"}]}`, &formSpec{},
+			`questions[0].type: "essay" is not one of text, paragraph, multiple_choice, checkbox, dropdown`},
+		{"date-time", `{"summary": "Standup", "start": "tomorrow 9am", "end": "2026-03-02T09:15:00Z"}`, &calendarEvent{},
+			`start: "tomorrow 9am" is not an RFC3339 time`},
+
+		// object-to-array wrapping
+		{"object where array expected", `{"summary": "Standup", "start": "2026-03-02T09:00:00Z", "end": "2026-03-02T09:15:00Z"}`, &[]calendarEvent{}, ""},
+		{"fenced object where array expected", "```json\n{\"summary\": \"Standup\", \"start\": \"2026-03-02T09:00:00Z\", \"end\": \"2026-03-02T09:15:00Z\"}\n```", &[]calendarEvent{}, ""},
+		{"array where object expected", `[{"summary": "Standup"}]`, &calendarEvent{},
+			"not valid JSON for the schema: json: cannot unmarshal array into Go value of type main.calendarEvent"},
+
+		// nested paths and Validate
+		{"nested format", `{"events": [{"summary": "Standup", "start": "9am", "end": "2026-03-02T09:15:00Z"}]}`, &agenda{},
+			`events[0].start: "9am" is not an RFC3339 time`},
+		{"nested required", `{"events": [{"summary": "A", "start": "2026-03-02T09:00:00Z", "end": "2026-03-02T10:00:00Z"}, {"start": "2026-03-02T11:00:00Z", "end": "2026-03-02T12:00:00Z"}]}`, &agenda{},
+			"events[1].summary: is required"},
+		{"Validate on a slice element", `{"events": [{"summary": "Standup", "start": "2026-03-02T09:00:00Z", "end": "2026-03-02T08:00:00Z"}]}`, &agenda{},
+			"events[0].end: must be after start"},
+		{"Validate on a top-level element", `[{"summary": "Standup", "start": "2026-03-02T09:00:00Z", "end": "2026-03-02T09:00:00Z"}]`, &[]calendarEvent{},
+			"[0].end: must be after start"},
+		{"Validate on a nested struct", `{"title": "Survey", "questions": [{"title": "Name?", "type": "text"}, {"title": "Colour?", "type": "dropdown"}]}`, &formSpec{},
+			"questions[1].options: dropdown questions need options"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeStructured(tt.reply, tt.out)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.err {
+				t.Errorf("decodeStructured() error = %q, want %q", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeStructuredResets(t *testing.T) {
+	events := []calendarEvent{{Summary: "stale"}}
+	if err := decodeStructured(`not json`, &events); err == nil {
+		t.Fatal("decodeStructured() accepted invalid JSON")
+	}
+	if events != nil {
+		t.Errorf("failed decode left %v behind", events)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	// Decoded from JSON, so required arrives as []any and minItems as float64
+	var schema map[string]any
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["name", "tags"],
+		"properties": {
+			"name": {"type": "string"},
+			"count": {"type": "integer"},
+			"score": {"type": "number"},
+			"done": {"type": "boolean"},
+			"level": {"enum": ["low", "high"]},
+			"due": {"type": "string", "format": "date"},
+			"at": {"type": "string", "format": "date-time"},
+			"tags": {"type": "array", "minItems": 1, "maxItems": 2, "items": {"type": "string"}},
+			"owner": {
+				"type": "object",
+				"required": ["email"],
+				"properties": {"email": {"type": "string"}}
+			}
+		}
+	}`), &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"valid", `{"name": "x", "tags": ["a"], "count": 2, "score": 1.5, "done": false, "level": "low", "due": "2026-03-02", "at": "2026-03-02T09:00:00Z", "owner": {"email": "a@b.c"}}`, ""},
+		{"required missing", `{"tags": ["a"]}`, "name: is required"},
+		{"required blank", `{"name": " ", "tags": ["a"]}`, "name: is required"},
+		{"required null", `{"name": "x", "tags": null}`, "tags: is required"},
+		{"minItems", `{"name": "x", "tags": []}`, "tags: needs at least 1 item(s)"},
+		{"maxItems", `{"name": "x", "tags": ["a", "b", "c"]}`, "tags: allows at most 2 item(s)"},
+		{"item type", `{"name": "x", "tags": ["a", 3]}`, "tags[1]: must be a string"},
+		{"enum", `{"name": "x", "tags": ["a"], "level": "medium"}`, "level: medium is not one of [low high]"},
+		{"date", `{"name": "x", "tags": ["a"], "due": "next week"}`, `due: "next week" is not a date`},
+		{"date-time", `{"name": "x", "tags": ["a"], "at": "2026-03-02"}`, `at: "2026-03-02" is not a date-time`},
+		{"integer", `{"name": "x", "tags": ["a"], "count": 1.5}`, "count: must be an integer"},
+		{"number", `{"name": "x", "tags": ["a"], "score": "high"}`, "score: must be a number"},
+		{"boolean", `{"name": "x", "tags": ["a"], "done": "yes"}`, "done: must be true or false"},
+		{"nested required", `{"name": "x", "tags": ["a"], "owner": {}}`, "owner.email: is required"},
+		{"object", `["x"]`, "must be an object"},
+		{"array", `{"name": "x", "tags": "a"}`, "tags: must be an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := validateSchema(value, schema, "")
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.err {
+				t.Errorf("validateSchema() error = %q, want %q", got, tt.err)
+			}
+		})
+	}
+}
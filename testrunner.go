@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// testFileSuffix marks AgentScript test scripts
+const testFileSuffix = "_test.as"
+
+// testResult is the outcome of one test script
+type testResult struct {
+	Path     string
+	Mode     string // "fake", "replay" or "record"
+	Duration time.Duration
+	Err      error
+	Skipped  []string // assertions that could not be checked
+}
+
+// Failed reports whether an assertion did not hold
+func (t testResult) Failed() bool {
+	var assertErr *AssertionError
+	return errors.As(t.Err, &assertErr)
+}
+
+// Skip reports whether the test ran cleanly but left assertions unchecked
+func (t testResult) Skip() bool {
+	return t.Err == nil && len(t.Skipped) > 0
+}
+
+// runTests implements "agentscript test [patterns...]". Every *_test.as
+// file is run as one test. A test with a cassette next to it
+// (foo_test.as -> foo_test.cassette.json) replays it; any other test runs
+// against the fake provider. With update set, tests run against the real
+// providers and their cassettes are (re)recorded. It returns the process
+// exit code.
+//
+// Tests run one at a time: runTestFile swaps the process-wide httpTransport
+// and changes the working directory for the length of each test.
+func runTests(ctx context.Context, cfg RuntimeConfig, patterns []string, junitPath string, update bool) int {
+	files, err := findTests(patterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Println("No *_test.as files found.")
+		return 0
+	}
+
+	var results []testResult
+	for _, path := range files {
+		fmt.Printf("=== RUN   %s\n", path)
+		res := runTestFile(ctx, cfg, path, update)
+		results = append(results, res)
+
+		switch {
+		case res.Skip():
+			fmt.Printf("--- SKIP: %s [%s] (%.2fs)\n    %s\n", path, res.Mode, res.Duration.Seconds(), strings.Join(res.Skipped, "\n    "))
+		case res.Err == nil:
+			fmt.Printf("--- PASS: %s [%s] (%.2fs)\n", path, res.Mode, res.Duration.Seconds())
+		case res.Failed():
+			fmt.Printf("--- FAIL: %s [%s] (%.2fs)\n    %v\n", path, res.Mode, res.Duration.Seconds(), res.Err)
+		default:
+			fmt.Printf("--- ERROR: %s [%s] (%.2fs)\n    %v\n", path, res.Mode, res.Duration.Seconds(), res.Err)
+		}
+	}
+
+	passed, skipped := 0, 0
+	for _, res := range results {
+		switch {
+		case res.Skip():
+			skipped++
+		case res.Err == nil:
+			passed++
+		}
+	}
+
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JUnit report: %v\n", err)
+			return 1
+		}
+		fmt.Printf("📄 JUnit report written to %s\n", junitPath)
+	}
+
+	fmt.Println()
+	if passed+skipped == len(results) {
+		if skipped > 0 {
+			fmt.Printf("✅ ok - %d test(s) passed, %d skipped\n", passed, skipped)
+		} else {
+			fmt.Printf("✅ ok - %d test(s) passed\n", passed)
+		}
+		return 0
+	}
+	fmt.Printf("❌ FAIL - %d of %d test(s) failed\n", len(results)-passed-skipped, len(results))
+	return 1
+}
+
+// runTestFile executes a single test script from its own directory. It
+// changes process globals (httpTransport and the working directory) and
+// restores them on return, so it must not run concurrently.
+func runTestFile(ctx context.Context, cfg RuntimeConfig, path string, update bool) (res testResult) {
+	res = testResult{Path: path, Mode: "fake"}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	cassettePath := strings.TrimSuffix(absPath, ".as") + ".cassette.json"
+
+	// Each test gets a fresh runtime; responses are never served from the cache
+	cfg.Cache = nil
+	cfg.Cassette = nil
+	httpTransport = http.DefaultTransport
+	defer func() { httpTransport = http.DefaultTransport }()
+
+	switch {
+	case update:
+		res.Mode = "record"
+		cfg.Cassette = NewRecordingCassette(cassettePath)
+		httpTransport = cfg.Cassette
+		if cfg.Provider == "fake" {
+			cfg.Provider = ""
+		}
+	case fileExists(cassettePath):
+		res.Mode = "replay"
+		if cfg.Cassette, err = LoadCassette(cassettePath); err != nil {
+			res.Err = err
+			return res
+		}
+		httpTransport = cfg.Cassette
+		if cfg.Provider == "fake" {
+			cfg.Provider = ""
+		}
+	default:
+		cfg.Provider = "fake"
+	}
+
+	script, err := os.ReadFile(absPath)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	program, err := Parse(string(script))
+	if err != nil {
+		res.Err = fmt.Errorf("parse error: %w", err)
+		return res
+	}
+
+	// Relative paths in a test resolve against the test's directory
+	wd, err := os.Getwd()
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if err := os.Chdir(filepath.Dir(absPath)); err != nil {
+		res.Err = err
+		return res
+	}
+	defer os.Chdir(wd)
+
+	if cfg.Workspace == nil {
+		if cfg.Workspace, err = NewWorkspace(repoRoot(filepath.Dir(absPath)), nil, nil, outsideDeny); err != nil {
+			res.Err = err
+			return res
+		}
+	}
+
+	rt, err := NewRuntime(ctx, cfg)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	_, res.Err = rt.Execute(ctx, program)
+	res.Skipped = rt.Skipped()
+
+	if update {
+		if err := cfg.Cassette.Save(); err != nil && res.Err == nil {
+			res.Err = fmt.Errorf("failed to write cassette: %w", err)
+		}
+	}
+	return res
+}
+
+// findTests expands the command line patterns into test files. A pattern
+// ending in "/..." searches recursively, a directory matches the test
+// files directly inside it and anything else is taken as a file.
+func findTests(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if root, ok := strings.CutSuffix(pattern, "/..."); ok || pattern == "..." {
+			if root == "" || pattern == "..." {
+				root = "."
+			}
+			err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && strings.HasSuffix(path, testFileSuffix) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to search %s: %w", root, err)
+			}
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("no such test file or directory: %s", pattern)
+		}
+		if !info.IsDir() {
+			add(pattern)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(pattern, "*"+testFileSuffix))
+		for _, m := range matches {
+			add(m)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// JUnit XML report, one <testsuite> per directory
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport writes the results in JUnit XML format
+func writeJUnitReport(path string, results []testResult) error {
+	report := junitTestSuites{}
+	suites := make(map[string]*junitTestSuite)
+	durations := make(map[string]time.Duration)
+	var order []string
+	var total time.Duration
+
+	for _, res := range results {
+		dir := filepath.ToSlash(filepath.Dir(res.Path))
+		suite, ok := suites[dir]
+		if !ok {
+			suite = &junitTestSuite{Name: dir}
+			suites[dir] = suite
+			order = append(order, dir)
+		}
+
+		tc := junitTestCase{
+			Name:      strings.TrimSuffix(filepath.Base(res.Path), ".as"),
+			Classname: dir,
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+		if res.Skip() {
+			tc.Skipped = &junitSkipped{Message: strings.Join(res.Skipped, "; ")}
+			suite.Skipped++
+			report.Skipped++
+		}
+		if res.Err != nil {
+			problem := &junitProblem{Message: firstLine(res.Err.Error()), Text: res.Err.Error()}
+			if res.Failed() {
+				problem.Type = "AssertionError"
+				tc.Failure = problem
+				suite.Failures++
+				report.Failures++
+			} else {
+				problem.Type = "Error"
+				tc.Error = problem
+				suite.Errors++
+				report.Errors++
+			}
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		report.Tests++
+		durations[dir] += res.Duration
+		total += res.Duration
+	}
+
+	for _, dir := range order {
+		suite := suites[dir]
+		suite.Time = fmt.Sprintf("%.3f", durations[dir].Seconds())
+		report.Suites = append(report.Suites, *suite)
+	}
+	report.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	results := []testResult{
+		{Path: "examples/tests/pass_test.as", Mode: "fake", Duration: 1500 * time.Millisecond},
+		{Path: "examples/tests/fail_test.as", Mode: "replay", Duration: 250 * time.Millisecond,
+			Err: &AssertionError{"assert_contains", "expected \"done\"\nin output"}},
+		{Path: "examples/tests/skip_test.as", Mode: "fake", Duration: 0,
+			Skipped: []string{"assert_rubric \"polite\"", "assert_rubric \"short\""}},
+		{Path: "other/error_test.as", Mode: "fake", Duration: 2 * time.Second,
+			Err: errors.New("parse error: unexpected token")},
+	}
+
+	path := filepath.Join(t.TempDir(), "report.xml")
+	if err := writeJUnitReport(path, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("report does not start with the XML header:\n%s", data)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, data)
+	}
+	report.XMLName = xml.Name{}
+
+	want := junitTestSuites{
+		Tests: 4, Failures: 1, Errors: 1, Skipped: 1, Time: "3.750",
+		Suites: []junitTestSuite{
+			{
+				Name: "examples/tests", Tests: 3, Failures: 1, Skipped: 1, Time: "1.750",
+				Cases: []junitTestCase{
+					{Name: "pass_test", Classname: "examples/tests", Time: "1.500"},
+					{Name: "fail_test", Classname: "examples/tests", Time: "0.250",
+						Failure: &junitProblem{Message: `expected "done"`, Type: "AssertionError", Text: "expected \"done\"\nin output"}},
+					{Name: "skip_test", Classname: "examples/tests", Time: "0.000",
+						Skipped: &junitSkipped{Message: `assert_rubric "polite"; assert_rubric "short"`}},
+				},
+			},
+			{
+				Name: "other", Tests: 1, Errors: 1, Time: "2.000",
+				Cases: []junitTestCase{
+					{Name: "error_test", Classname: "other", Time: "2.000",
+						Error: &junitProblem{Message: "parse error: unexpected token", Type: "Error", Text: "parse error: unexpected token"}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report =\n%s", data)
+	}
+
+	for _, tag := range []string{"<testsuites ", "<testsuite ", "<failure ", "<error ", "<skipped "} {
+		if !strings.Contains(string(data), tag) {
+			t.Errorf("report has no %s element", strings.TrimSpace(tag))
+		}
+	}
+	// Passing tests carry no child elements
+	if !strings.Contains(string(data), `<testcase name="pass_test" classname="examples/tests" time="1.500"></testcase>`) {
+		t.Errorf("passing test case is not empty:\n%s", data)
+	}
+}
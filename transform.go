@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Transforms are deterministic, model-free steps for reshaping text and
+// JSON between other commands. Commands that take a list work on the
+// elements of a JSON array input and on lines otherwise.
+
+// grep keeps the lines matching a regular expression, or the lines that
+// do not match when invert is set
+func (r *Runtime) grep(pattern, input string, invert bool) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	var kept []string
+	for _, line := range strings.Split(input, "\n") {
+		if re.MatchString(line) != invert {
+			kept = append(kept, line)
+		}
+	}
+	r.log("GREP %q: kept %d line(s)", pattern, len(kept))
+	return strings.Join(kept, "\n"), nil
+}
+
+// filter is grep for lists: with a JSON array input it keeps the elements
+// whose text matches, otherwise it keeps matching lines
+func (r *Runtime) filter(pattern, input string, invert bool) (string, error) {
+	items, ok := jsonArray(input)
+	if !ok {
+		return r.grep(pattern, input, invert)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	kept := []any{}
+	for _, item := range items {
+		if re.MatchString(itemText(item)) != invert {
+			kept = append(kept, item)
+		}
+	}
+	r.log("FILTER %q: kept %d of %d item(s)", pattern, len(kept), len(items))
+	return toJSON(kept), nil
+}
+
+// head keeps the first n items or lines (10 by default)
+func (r *Runtime) head(count, input string) (string, error) {
+	return sliceList(count, input, func(n, total int) (int, int) { return 0, min(n, total) })
+}
+
+// tail keeps the last n items or lines (10 by default)
+func (r *Runtime) tail(count, input string) (string, error) {
+	return sliceList(count, input, func(n, total int) (int, int) { return max(total-n, 0), total })
+}
+
+func sliceList(count, input string, bounds func(n, total int) (int, int)) (string, error) {
+	n := 10
+	if count != "" {
+		var err error
+		if n, err = strconv.Atoi(strings.TrimSpace(count)); err != nil || n < 0 {
+			return "", fmt.Errorf("count must be a non-negative number, got %q", count)
+		}
+	}
+	if items, ok := jsonArray(input); ok {
+		from, to := bounds(n, len(items))
+		return toJSON(items[from:to]), nil
+	}
+	lines := strings.Split(strings.TrimRight(input, "\n"), "\n")
+	from, to := bounds(n, len(lines))
+	return strings.Join(lines[from:to], "\n"), nil
+}
+
+// split breaks the input on a separator (a newline by default) into a
+// JSON array of the non-empty, trimmed parts
+func (r *Runtime) split(sep, input string) (string, error) {
+	if sep == "" {
+		sep = "\n"
+	}
+	parts := []string{}
+	for _, part := range strings.Split(input, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return toJSON(parts), nil
+}
+
+// join joins the elements of a JSON array, or the input's lines, with a
+// separator (a newline by default)
+func (r *Runtime) join(sep, input string) (string, error) {
+	if sep == "" {
+		sep = "\n"
+	}
+	items, ok := jsonArray(input)
+	if !ok {
+		return strings.Join(strings.Split(strings.TrimRight(input, "\n"), "\n"), sep), nil
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = itemText(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// replace replaces every match of a regular expression. The replacement
+// may refer to groups as $1 or ${name}; without one, matches are removed.
+func (r *Runtime) replace(pattern string, args []string, input string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %w", err)
+	}
+	with := ""
+	if len(args) > 0 {
+		with = args[0]
+	}
+	return re.ReplaceAllString(input, with), nil
+}
+
+// templateFuncs are available to the template command
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"split": strings.Split,
+	"join": func(sep string, items []any) string {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = itemText(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"json": toJSON,
+}
+
+// renderTemplate executes a Go template (inline or a file path) with the
+// input as data: decoded when it is JSON, the plain text otherwise
+func (r *Runtime) renderTemplate(text, input string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		if _, err := os.Stat(text); err == nil {
+			if err := r.checkPath(text, "read"); err != nil {
+				return "", err
+			}
+		}
+		if data, err := os.ReadFile(text); err == nil {
+			text = string(data)
+		}
+	}
+	tmpl, err := template.New("template").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	var data any = input
+	var decoded any
+	if json.Unmarshal([]byte(stripCodeFence(input)), &decoded) == nil {
+		data = decoded
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("template failed: %w", err)
+	}
+	return out.String(), nil
+}
+
+// csvToJSON converts CSV with a header row into a JSON array of records,
+// keeping the column order. delimiter defaults to a comma.
+func (r *Runtime) csvToJSON(delimiter, input string) (string, error) {
+	reader := csv.NewReader(strings.NewReader(input))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if delimiter != "" {
+		reader.Comma = []rune(delimiter)[0]
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("invalid CSV: %w", err)
+	}
+	r.log("CSV_TO_JSON: %d record(s)", max(len(rows)-1, 0))
+	return recordsJSON(rows), nil
+}
+
+// recordsJSON turns a header row and data rows into an indented JSON array
+// of records, keeping the column order
+func recordsJSON(rows [][]string) string {
+	if len(rows) == 0 {
+		return "[]"
+	}
+
+	// Build the JSON by hand so fields stay in column order
+	header := rows[0]
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, row := range rows[1:] {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("{")
+		for j, name := range header {
+			if j > 0 {
+				buf.WriteString(",")
+			}
+			value := ""
+			if j < len(row) {
+				value = row[j]
+			}
+			key, _ := json.Marshal(name)
+			val, _ := json.Marshal(value)
+			buf.Write(key)
+			buf.WriteString(":")
+			buf.Write(val)
+		}
+		buf.WriteString("}")
+	}
+	buf.WriteString("]")
+
+	var out bytes.Buffer
+	json.Indent(&out, buf.Bytes(), "", "  ")
+	return out.String()
+}
+
+// jsonToCSV converts a JSON array of records (or one record) into CSV with
+// a header row, columns in the order fields first appear
+func (r *Runtime) jsonToCSV(delimiter, input string) (string, error) {
+	trimmed := stripCodeFence(input)
+	var records []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+		if !strings.HasPrefix(trimmed, "{") {
+			return "", fmt.Errorf("input is not a JSON array of objects")
+		}
+		records = []json.RawMessage{json.RawMessage(trimmed)}
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	rows := make([]map[string]any, len(records))
+	for i, raw := range records {
+		if err := json.Unmarshal(raw, &rows[i]); err != nil {
+			return "", fmt.Errorf("record %d is not an object", i)
+		}
+		for _, key := range objectKeys(raw) {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if delimiter != "" {
+		writer.Comma = []rune(delimiter)[0]
+	}
+	writer.Write(columns)
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			cells[i] = cellText(row[col])
+		}
+		writer.Write(cells)
+	}
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
+
+// jsonArray decodes input as a JSON array
+func jsonArray(input string) ([]any, bool) {
+	trimmed := stripCodeFence(input)
+	if !strings.HasPrefix(trimmed, "[") {
+		return nil, false
+	}
+	var items []any
+	if err := json.Unmarshal([]byte(trimmed), &items); err != nil {
+		return nil, false
+	}
+	return items, true
+}
+
+// itemText renders a JSON value as text: strings as they are, anything
+// else as compact JSON
+func itemText(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// toJSON encodes a value as indented JSON without HTML escaping
+func toJSON(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
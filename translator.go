@@ -8,28 +8,44 @@ import (
 
 // Translator converts natural language to AgentScript DSL
 type Translator struct {
-	gemini *GeminiClient
+	llm Provider
 }
 
-// NewTranslator creates a new Translator
-func NewTranslator(ctx context.Context, apiKey string) (*Translator, error) {
-	client := NewGeminiClient(apiKey, "")
+// NewTranslator creates a new Translator that uses one of the runtime's
+// providers, so it shares the same endpoint, cache and transport
+func NewTranslator(ctx context.Context, llm Provider) (*Translator, error) {
+	if llm == nil {
+		return nil, fmt.Errorf("no LLM provider configured - required for translation")
+	}
 
 	return &Translator{
-		gemini: client,
+		llm: llm,
 	}, nil
 }
 
 const systemPrompt = `You are a translator that converts natural language into AgentScript DSL.
 
 AgentScript is a simple command language with these commands:
-- search "query" - Search the web for information
+- search "query" - Search the web for information (options: count=N freshness=day|week|month|year site="a.com,b.org" region=us)
 - summarize - Summarize the input content
 - save "filename" - Save content to a file
-- read "filename" - Read content from a file
+- read "filename" - Read a file: PDF, DOCX and HTML become Markdown, CSV/TSV/XLSX a JSON array of records, JSON is validated; a glob such as "src/**/*.go" reads every matching file into a JSON array of {path, content} (options: max_files=100, format="csv", sheet="Q3", delimiter=";", inline=true to send a PDF to the model)
+- fetch "url" - Download a web page (or PDF) as readable text; without a URL it uses the first URL in the input
+- crawl "url" - Read a site section as a JSON array of {url, title, depth, markdown} pages (options: depth=2 max_pages=50 scope=prefix|domain)
+- feed "url" - Read an RSS or Atom feed as a JSON array of {id, title, url, published, author, summary} items, newest first; only items not returned by earlier runs (options: since="24h", since="7d" or since="2026-01-31"; limit=10; only_new=false)
+- index "path" - Embed the docs, code and PDFs under a directory into a named index (options: name="kb", chunk_size=300)
+- retrieve "question" - Return the passages of an index most relevant to the question, with file and line numbers, for ask to answer from (options: index="kb", k=8)
 - ask "question" - Ask a question, optionally with context from previous command
 - analyze "focus" - Analyze content with optional focus area
-- list "path" - List files in a directory
+- extract "name, price:number" - Extract JSON records with the given fields from the input
+- jq ".[] | .name" - Run a jq expression (full jq language) over JSON input
+- grep "regex" / filter "regex" - Keep matching lines (filter also works on JSON arrays)
+- head "n" / tail "n" - Keep the first or last n lines or items
+- split "sep" / join "sep" - Split text into a JSON array, or join one back into text
+- replace "regex" "replacement" - Regex replace in the input
+- template "{{.field}}" - Render JSON input with a Go template
+- csv_to_json / json_to_csv - Convert between CSV and JSON records
+- list "path" - List files with sizes and modification times (options: recursive=true, depth=N, match="*.go", format="json" for [{path, type, size, modified}], all=true to include hidden and .gitignored files)
 - merge - Combine results from parallel branches
 - email "address" - Send an email with the content
 - calendar "event" - Create a calendar event
@@ -63,6 +79,7 @@ Rules:
 5. Use parallel when comparing multiple items or doing independent research
 6. Always use merge after parallel to combine results
 7. All commands are lowercase
+8. Use relative file paths inside the current directory unless the user names another location
 
 Examples:
 - "find info about golang and save it" → search "golang" -> save "golang.txt"
@@ -87,7 +104,7 @@ Examples:
 func (t *Translator) Translate(ctx context.Context, naturalLanguage string) (string, error) {
 	prompt := fmt.Sprintf("%s\n\nConvert this to AgentScript:\n%s", systemPrompt, naturalLanguage)
 
-	result, err := t.gemini.GenerateContent(ctx, prompt)
+	result, err := t.llm.Generate(ctx, prompt, GenOptions{Format: "agentscript"})
 	if err != nil {
 		return "", fmt.Errorf("translation failed: %w", err)
 	}
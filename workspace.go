@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Outside-workspace policies
+const (
+	outsidePrompt = "prompt" // ask on a terminal, fail otherwise
+	outsideDeny   = "deny"
+	outsideAllow  = "allow"
+)
+
+// defaultDeny keeps secrets and repository internals out of reach; it
+// applies on top of any configured deny rules
+var defaultDeny = []string{".env", ".env.*", ".git"}
+
+// Workspace confines the files scripts read, write and list to a root
+// directory. Deny rules always win; allow rules restrict access inside the
+// root and can open up paths outside it.
+type Workspace struct {
+	root    string // absolute
+	real    string // root with symlinks resolved
+	allow   []string
+	deny    []string
+	outside string
+
+	mu       sync.Mutex
+	approved map[string]bool // directories allowed at the prompt
+}
+
+// NewWorkspace creates a workspace rooted at root. Patterns are globs
+// relative to the root, or absolute; "**" matches any number of
+// directories and a pattern without a slash matches a name at any depth.
+func NewWorkspace(root string, allow, deny []string, outside string) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace %s: %w", root, err)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace: %w", err)
+	}
+	if info, err := os.Stat(real); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("invalid workspace: %s is not a directory", root)
+	}
+	switch outside {
+	case "":
+		outside = outsidePrompt
+	case outsidePrompt, outsideDeny, outsideAllow:
+	default:
+		return nil, fmt.Errorf("invalid outside policy %q (expected prompt, deny or allow)", outside)
+	}
+	deny = append(append([]string{}, defaultDeny...), deny...)
+	for _, p := range append(append([]string{}, allow...), deny...) {
+		if _, err := path.Match(strings.ReplaceAll(filepath.ToSlash(p), "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid workspace rule %q: %w", p, err)
+		}
+	}
+	return &Workspace{
+		root:     abs,
+		real:     real,
+		allow:    expandHome(allow),
+		deny:     expandHome(deny),
+		outside:  outside,
+		approved: make(map[string]bool),
+	}, nil
+}
+
+// Root returns the workspace directory
+func (w *Workspace) Root() string {
+	if w == nil {
+		return ""
+	}
+	return w.root
+}
+
+// Check reports whether op ("read", "write" or "list") may touch p.
+// Scripts translated from natural language are never let outside the
+// workspace without asking, whatever the policy.
+func (w *Workspace) Check(p, op string, translated bool) error {
+	if w == nil {
+		return nil
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return fmt.Errorf("invalid path %s: %w", p, err)
+	}
+	real := resolveExisting(abs)
+
+	for _, candidate := range []string{abs, real} {
+		if rule, ok := w.match(w.deny, candidate); ok {
+			return fmt.Errorf("cannot %s %s: denied by workspace rule %q", op, p, rule)
+		}
+	}
+
+	inside := within(real, w.real)
+	_, allowed := w.match(w.allow, real)
+	if !allowed {
+		_, allowed = w.match(w.allow, abs)
+	}
+	if inside {
+		if len(w.allow) > 0 && !allowed && !(op == "list" && w.leadsToAllowed(real)) {
+			return fmt.Errorf("cannot %s %s: not matched by the workspace's allow rules", op, p)
+		}
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+	if within(abs, w.root) {
+		return fmt.Errorf("cannot %s %s: it links to %s, outside the workspace", op, p, real)
+	}
+
+	policy := w.outside
+	if translated && policy == outsideAllow {
+		policy = outsidePrompt
+	}
+	switch policy {
+	case outsideAllow:
+		return nil
+	case outsidePrompt:
+		if w.confirm(op, real) {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot %s %s: outside the workspace %s (use -workspace or -allow to permit it)", op, p, w.root)
+}
+
+// Visible reports whether list may show an entry: it is not denied and,
+// inside the workspace, it is allowed or a directory above allowed paths.
+// Unlike Check it never prompts.
+func (w *Workspace) Visible(p string) bool {
+	if w == nil {
+		return true
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	real := resolveExisting(abs)
+	for _, candidate := range []string{abs, real} {
+		if _, ok := w.match(w.deny, candidate); ok {
+			return false
+		}
+	}
+	if len(w.allow) == 0 || !within(real, w.real) {
+		return true
+	}
+	if _, ok := w.match(w.allow, real); ok {
+		return true
+	}
+	if _, ok := w.match(w.allow, abs); ok {
+		return true
+	}
+	return w.leadsToAllowed(real)
+}
+
+// leadsToAllowed reports whether dir is a directory that some allow rule
+// could match a path below, so the directories above allowed paths can
+// be listed
+func (w *Workspace) leadsToAllowed(dir string) bool {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return false
+	}
+	for _, pattern := range w.allow {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		var target string
+		switch {
+		case filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/"):
+			target = filepath.ToSlash(dir)
+		case within(dir, w.real):
+			rel, _ := filepath.Rel(w.real, dir)
+			target = filepath.ToSlash(rel)
+		default:
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			return true // matches a name at any depth
+		}
+		if matchPrefix(strings.Split(strings.Trim(pattern, "/"), "/"), splitPath(target)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether the leading segments of a pattern match
+// every segment of name, so the pattern may match something below it
+func matchPrefix(pattern, name []string) bool {
+	for i, segment := range name {
+		if i >= len(pattern) {
+			return false
+		}
+		if pattern[i] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[i], segment); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPath splits a slash-separated path into its names; "." and "/"
+// have none
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" || p == "." {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// match returns the first pattern matching an absolute path
+func (w *Workspace) match(patterns []string, abs string) (string, bool) {
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		var target string
+		switch {
+		case filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/"):
+			target = filepath.ToSlash(abs)
+		case within(abs, w.real):
+			rel, _ := filepath.Rel(w.real, abs)
+			target = filepath.ToSlash(rel)
+		case within(abs, w.root):
+			rel, _ := filepath.Rel(w.root, abs)
+			target = filepath.ToSlash(rel)
+		default:
+			continue // relative rules only apply inside the workspace
+		}
+		if matchPathOrParent(strings.TrimSuffix(pattern, "/"), target) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// confirm asks whether a path outside the workspace may be used,
+// remembering the answer for its directory. Without a terminal it refuses.
+func (w *Workspace) confirm(op, p string) bool {
+	if !interactive() {
+		return false
+	}
+	dir := p
+	if info, err := os.Stat(p); err != nil || !info.IsDir() {
+		dir = filepath.Dir(p)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.approved[dir] {
+		return true
+	}
+	fmt.Printf("\n⚠️  The script wants to %s %s, outside the workspace %s\n", op, p, w.root)
+	fmt.Printf("Allow access to %s for this run? [y/N]: ", dir)
+	var response string
+	fmt.Scanln(&response)
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response == "y" || response == "yes" {
+		w.approved[dir] = true
+		return true
+	}
+	return false
+}
+
+// interactive reports whether standard input is a terminal
+func interactive() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(stat, null)
+}
+
+// matchPathOrParent matches a slash-separated path, or any directory
+// above it, against a pattern; a pattern without a slash is matched
+// against each name in the path
+func matchPathOrParent(pattern, p string) bool {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		if strings.Contains(pattern, "/") {
+			if matchGlob(strings.TrimPrefix(pattern, "/"), strings.TrimPrefix(strings.Join(parts[:i+1], "/"), "/")) {
+				return true
+			}
+		} else if ok, _ := path.Match(pattern, parts[i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveExisting resolves the symlinks in the longest existing prefix of
+// an absolute path, so paths that are about to be created are checked
+// where they will really be written
+func resolveExisting(abs string) string {
+	rest := ""
+	for p := abs; ; p = filepath.Dir(p) {
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(real, rest)
+		}
+		if filepath.Dir(p) == p {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+	}
+}
+
+// repoRoot returns the repository directory containing dir, or dir itself
+// when it is not in one
+func repoRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// within reports whether p is dir or inside it
+func within(p, dir string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(patterns []string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return patterns
+	}
+	expanded := make([]string, len(patterns))
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "~/") {
+			p = filepath.Join(home, p[2:])
+		}
+		expanded[i] = p
+	}
+	return expanded
+}
+
+// splitRules splits a comma-separated list of workspace rules
+func splitRules(s string) []string {
+	var rules []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// checkPath applies the workspace rules to a path a command uses
+func (r *Runtime) checkPath(p, op string) error {
+	return r.workspace.Check(p, op, r.translated)
+}
+
+// checkPaths checks a command's output file and the files it reads
+func (r *Runtime) checkPaths(output string, inputs ...string) error {
+	for _, p := range inputs {
+		if err := r.checkPath(p, "read"); err != nil {
+			return err
+		}
+	}
+	return r.checkPath(output, "write")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// workspaceTree creates a workspace root and a sibling directory outside
+// it, with symlinks from the root to the outside
+func workspaceTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root = filepath.Join(base, "ws")
+	outside = filepath.Join(base, "out")
+	for _, dir := range []string{"docs/guide", "src", ".git"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{
+		filepath.Join(root, ".env"),
+		filepath.Join(root, ".git", "config"),
+		filepath.Join(root, "README.md"),
+		filepath.Join(root, "docs", "a.md"),
+		filepath.Join(root, "docs", "guide", "b.md"),
+		filepath.Join(root, "src", "x.go"),
+		filepath.Join(outside, "file.txt"),
+	} {
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "file.txt"), filepath.Join(root, "docs", "escape.md")); err != nil {
+		t.Fatal(err)
+	}
+	return root, outside
+}
+
+// noTerminal makes standard input a pipe for the rest of the test, so
+// the outside-workspace prompt refuses instead of waiting for an answer
+func noTerminal(t *testing.T) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+		w.Close()
+	})
+}
+
+func TestWorkspaceCheck(t *testing.T) {
+	root, outside := workspaceTree(t)
+	noTerminal(t)
+	in := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+
+	tests := []struct {
+		name        string
+		allow, deny []string
+		policy      string
+		translated  bool
+		path, op    string
+		want        string // error substring; "" for success
+	}{
+		{name: "file inside", path: in("src/x.go"), op: "read"},
+		{name: "new nested path", path: in("new/deep/file.txt"), op: "write"},
+		{name: "dot-dot staying inside", path: in("src/../docs/a.md"), op: "read"},
+		{name: "dot-dot leaving", path: in("../out/file.txt"), op: "read", want: "outside the workspace"},
+		{name: "symlinked directory outside", path: in("link/file.txt"), op: "read", want: "outside the workspace"},
+		{name: "symlinked file outside", path: in("docs/escape.md"), op: "read", want: "links to"},
+		{name: "new file in symlinked directory", path: in("link/new.txt"), op: "write", want: "links to"},
+		{name: "default deny .env", path: in(".env"), op: "read", want: `denied by workspace rule ".env"`},
+		{name: "default deny .env.*", path: in("src/.env.local"), op: "write", want: `denied by workspace rule ".env.*"`},
+		{name: "default deny .git", path: in(".git/config"), op: "read", want: `denied by workspace rule ".git"`},
+		{name: "deny rule", deny: []string{"src/**"}, path: in("src/x.go"), op: "read", want: `denied by workspace rule "src/**"`},
+		{name: "deny beats allow", allow: []string{"docs/**"}, deny: []string{"docs/guide"}, path: in("docs/guide/b.md"), op: "read", want: "denied"},
+		{name: "allowed inside", allow: []string{"docs/**"}, path: in("docs/a.md"), op: "read"},
+		{name: "allowed new nested path", allow: []string{"docs/**"}, path: in("docs/new/c.md"), op: "write"},
+		{name: "not allowed inside", allow: []string{"docs/**"}, path: in("src/x.go"), op: "read", want: "not matched by the workspace's allow rules"},
+		{name: "list above allowed", allow: []string{"docs/guide/*.md"}, path: root, op: "list"},
+		{name: "list between allowed", allow: []string{"docs/guide/*.md"}, path: in("docs"), op: "list"},
+		{name: "read above allowed", allow: []string{"docs/**"}, path: in("README.md"), op: "read", want: "not matched"},
+		{name: "list beside allowed", allow: []string{"docs/**"}, path: in("src"), op: "list", want: "not matched"},
+		{name: "allow rule outside", allow: []string{outside + "/**"}, policy: outsideDeny, path: filepath.Join(outside, "file.txt"), op: "read"},
+		{name: "allow rule outside is narrow", allow: []string{outside + "/**"}, policy: outsideDeny, path: filepath.Join(filepath.Dir(outside), "other.txt"), op: "write", want: "outside the workspace"},
+		{name: "outside allowed", policy: outsideAllow, path: filepath.Join(outside, "file.txt"), op: "read"},
+		{name: "translated outside allowed prompts", policy: outsideAllow, translated: true, path: filepath.Join(outside, "file.txt"), op: "read", want: "outside the workspace"},
+		{name: "prompt without a terminal", policy: outsidePrompt, path: filepath.Join(outside, "file.txt"), op: "read", want: "outside the workspace"},
+		{name: "deny outside", policy: outsideDeny, path: filepath.Join(outside, "file.txt"), op: "read", want: "outside the workspace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWorkspace(root, tt.allow, tt.deny, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = w.Check(tt.path, tt.op, tt.translated)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Check(%s, %s) = %v, want success", tt.path, tt.op, err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Check(%s, %s) = %v, want an error containing %q", tt.path, tt.op, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceVisible(t *testing.T) {
+	root, _ := workspaceTree(t)
+	w, err := NewWorkspace(root, []string{"docs/**"}, []string{"docs/guide"}, outsideDeny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		".":            true, // leads to docs
+		"docs":         true,
+		"docs/a.md":    true,
+		"docs/guide":   false,
+		"src":          false,
+		"README.md":    false,
+		".env":         false,
+		"link":         true, // outside, so left to Check
+		"docs/missing": true,
+	}
+	for p, want := range tests {
+		if got := w.Visible(filepath.Join(root, p)); got != want {
+			t.Errorf("Visible(%s) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestNewWorkspaceErrors(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		root, policy string
+		allow        []string
+		want         string
+	}{
+		{filepath.Join(root, "missing"), "", nil, "invalid workspace"},
+		{root, "sometimes", nil, "invalid outside policy"},
+		{root, "", []string{"docs/["}, "invalid workspace rule"},
+	}
+	for _, tt := range tests {
+		if _, err := NewWorkspace(tt.root, tt.allow, nil, tt.policy); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewWorkspace(%s, %q, %q) = %v, want %q", tt.root, tt.policy, tt.allow, err, tt.want)
+		}
+	}
+}
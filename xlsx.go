@@ -0,0 +1,298 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxRows reads one worksheet of an Excel workbook, the first one unless
+// sheet names another, as rows of cell text. Dates are written as
+// YYYY-MM-DD, with the time when there is one.
+func xlsxRows(data []byte, sheet string) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an XLSX file: %w", err)
+	}
+	workbookXML, err := zipFile(zr, "xl/workbook.xml")
+	if err != nil {
+		return nil, fmt.Errorf("not an XLSX file: %w", err)
+	}
+
+	var workbook struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string     `xml:"name,attr"`
+			Rels []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(workbookXML, &workbook); err != nil {
+		return nil, fmt.Errorf("failed to parse workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	chosen := -1
+	var names []string
+	for i, s := range workbook.Sheets {
+		names = append(names, s.Name)
+		if (sheet == "" && i == 0) || strings.EqualFold(s.Name, sheet) {
+			chosen = i
+		}
+	}
+	if chosen == -1 {
+		return nil, fmt.Errorf("no sheet %q (sheets: %s)", sheet, strings.Join(names, ", "))
+	}
+
+	var relID string
+	for _, a := range workbook.Sheets[chosen].Rels {
+		if a.Name.Local == "id" {
+			relID = a.Value
+		}
+	}
+	target := zipRelationships(zr, "xl/_rels/workbook.xml.rels")[relID]
+	if target == "" {
+		return nil, fmt.Errorf("sheet %q not found in workbook", workbook.Sheets[chosen].Name)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+	sheetXML, err := zipFile(zr, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %q: %w", workbook.Sheets[chosen].Name, err)
+	}
+
+	strs, err := xlsxSharedStrings(zr)
+	if err != nil {
+		return nil, err
+	}
+	dates := xlsxDateStyles(zr)
+	date1904 := workbook.Pr.Date1904 == "1" || workbook.Pr.Date1904 == "true"
+
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Style  int    `xml:"s,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text string `xml:",innerxml"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(sheetXML, &ws); err != nil {
+		return nil, fmt.Errorf("failed to parse sheet: %w", err)
+	}
+
+	// Cells may be omitted when empty, so place them by reference; empty
+	// rows are skipped
+	var rows [][]string
+	for _, row := range ws.Rows {
+		var cells []string
+		blank := true
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = xlsxColumn(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+
+			v := c.Value
+			switch c.Type {
+			case "s":
+				if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(strs) {
+					v = strs[n]
+				}
+			case "inlineStr":
+				v = xmlText(c.Inline.Text)
+			case "b":
+				v = strings.ToUpper(strconv.FormatBool(v == "1"))
+			case "", "n":
+				if dates[c.Style] {
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						v = excelDate(f, date1904)
+					}
+				}
+			}
+			cells[col] = v
+			blank = blank && strings.TrimSpace(v) == ""
+		}
+		if !blank {
+			rows = append(rows, cells)
+		}
+	}
+
+	// Pad every row to the same width
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	for i := range rows {
+		for len(rows[i]) < width {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows, nil
+}
+
+// xlsxMaxColumns is the width of a worksheet: columns run from A to XFD
+const xlsxMaxColumns = 16384
+
+var cellRef = regexp.MustCompile(`^([A-Z]+)\d*$`)
+
+// xlsxColumn converts a cell reference such as "AB12" to a column index
+func xlsxColumn(ref string) (int, error) {
+	m := cellRef.FindStringSubmatch(strings.ToUpper(ref))
+	if m == nil {
+		return 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	n := 0
+	for _, c := range m[1] {
+		n = n*26 + int(c-'A'+1)
+		if n > xlsxMaxColumns {
+			return 0, fmt.Errorf("invalid cell reference %q: columns end at XFD", ref)
+		}
+	}
+	return n - 1, nil
+}
+
+// xlsxColumnName converts a column index to its letters, e.g. 27 -> "AB"
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxSharedStrings reads the workbook's string table
+func xlsxSharedStrings(zr *zip.Reader) ([]string, error) {
+	data, err := zipFile(zr, "xl/sharedStrings.xml")
+	if err != nil {
+		return nil, nil // workbooks without text have none
+	}
+	var sst struct {
+		Items []struct {
+			XML string `xml:",innerxml"`
+		} `xml:"si"`
+	}
+	if err := xml.Unmarshal(data, &sst); err != nil {
+		return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+	}
+	strs := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		strs[i] = xmlText(item.XML)
+	}
+	return strs, nil
+}
+
+// xmlText concatenates the <t> elements of rich text, skipping phonetic
+// guides (<rPh>)
+func xmlText(inner string) string {
+	dec := xml.NewDecoder(strings.NewReader(inner))
+	var b strings.Builder
+	skip := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return b.String()
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "rPh":
+				skip++
+			case t.Name.Local == "t" && skip == 0:
+				var text string
+				if dec.DecodeElement(&text, &t) == nil {
+					b.WriteString(text)
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "rPh" {
+				skip--
+			}
+		}
+	}
+}
+
+// xlsxDateStyles returns the cell styles that display numbers as dates
+func xlsxDateStyles(zr *zip.Reader) map[int]bool {
+	dates := make(map[int]bool)
+	data, err := zipFile(zr, "xl/styles.xml")
+	if err != nil {
+		return dates
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if xml.Unmarshal(data, &styles) != nil {
+		return dates
+	}
+
+	custom := make(map[int]bool)
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = isDateFormat(f.Code)
+	}
+	for i, xf := range styles.CellXfs {
+		id := xf.NumFmtID
+		if isDate, ok := custom[id]; ok {
+			dates[i] = isDate
+		} else {
+			// Built-in date and time formats
+			dates[i] = (id >= 14 && id <= 22) || (id >= 45 && id <= 47)
+		}
+	}
+	return dates
+}
+
+// dateFormatNoise matches the parts of a number format that are not
+// date or time codes: quoted text, escapes, colours and conditions
+var dateFormatNoise = regexp.MustCompile(`"[^"]*"|\\.|\[[^\]]*\]`)
+
+func isDateFormat(code string) bool {
+	code = strings.ToLower(dateFormatNoise.ReplaceAllString(code, ""))
+	return strings.ContainsAny(code, "dmyhs") && !strings.Contains(code, "general")
+}
+
+// excelDate converts an Excel serial date to text
+func excelDate(serial float64, date1904 bool) string {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	if seconds == 0 {
+		return t.Format(time.DateOnly)
+	}
+	if days == 0 && !date1904 {
+		return t.Format(time.TimeOnly)
+	}
+	return t.Format(time.DateTime)
+}
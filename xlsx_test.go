@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXLSXRows(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sales.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sheet string
+		want  [][]string
+	}{
+		{"", [][]string{
+			{"Region", "Date", "Revenue", "Paid"},
+			{"North", "2026-01-01", "1250.5", "TRUE"},
+			{"South", "2026-01-02 12:00:00", "", "FALSE"},
+			{"Café", "", "99", ""},
+		}},
+		{"notes", [][]string{{"", "Checked by Ana"}}},
+	}
+	for _, tt := range tests {
+		got, err := xlsxRows(data, tt.sheet)
+		if err != nil {
+			t.Errorf("xlsxRows(%q): %v", tt.sheet, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("xlsxRows(%q) = %q, want %q", tt.sheet, got, tt.want)
+		}
+	}
+
+	if _, err := xlsxRows(data, "Missing"); err == nil || !strings.Contains(err.Error(), "sheets: Sales, Notes") {
+		t.Errorf("xlsxRows(Missing) error = %v, want the sheet list", err)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"z9", 25},
+		{"AA10", 26},
+		{"AB12", 27},
+		{"XFD1048576", xlsxMaxColumns - 1},
+	}
+	for _, tt := range tests {
+		got, err := xlsxColumn(tt.ref)
+		if err != nil || got != tt.want {
+			t.Errorf("xlsxColumn(%q) = %d, %v; want %d", tt.ref, got, err, tt.want)
+		}
+		if name := xlsxColumnName(got); !strings.HasPrefix(strings.ToUpper(tt.ref), name) {
+			t.Errorf("xlsxColumnName(%d) = %q, want a prefix of %q", got, name, tt.ref)
+		}
+	}
+
+	for _, ref := range []string{"", "1A", "A-1", "XFE1", "ZZZZZZZZZZZZZZZZZZZZ1"} {
+		if got, err := xlsxColumn(ref); err == nil {
+			t.Errorf("xlsxColumn(%q) = %d, want an error", ref, got)
+		}
+	}
+}
+
+func TestXLSXRowsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not a zip", []byte("plain text"), "not an XLSX file"},
+		{"no workbook", zipArchive(t, map[string]string{"a.txt": "x"}), "not an XLSX file"},
+		{"beyond XFD", xlsxWorkbook(t, `<row><c r="XFE1" t="inlineStr"><is><t>x</t></is></c></row>`), "columns end at XFD"},
+		{"huge column", xlsxWorkbook(t, `<row><c r="ZZZZZZZZZZZZZZZ1"><v>1</v></c></row>`), "columns end at XFD"},
+		{"bad sheet XML", xlsxWorkbook(t, `<row><c>`), "failed to parse sheet"},
+	}
+	for _, tt := range tests {
+		if _, err := xlsxRows(tt.data, ""); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// xlsxWorkbook builds a one-sheet workbook around the given rows
+func xlsxWorkbook(t *testing.T, rows string) []byte {
+	return zipArchive(t, map[string]string{
+		"xl/workbook.xml":            `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml":   `<worksheet><sheetData>` + rows + `</sheetData></worksheet>`,
+	})
+}
+
+// zipArchive returns a zip archive holding the given files
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}